@@ -0,0 +1,1163 @@
+package jet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// bundleMagic starts every bundle written by ExportBundle().
+const bundleMagic = "\x00jetbundle"
+
+// bundleVersion is the version of the encoding of bundles. It must be incremented whenever the encoding or
+// the syntax tree changes, since bundles of other versions are rejected instead of being decoded wrongly.
+const bundleVersion = 2
+
+// Tags of the values encoded in a bundle where a node is expected. The tags are part of the encoding, so new
+// ones must only be added at the end.
+const (
+	bundleNil = iota // nil node
+	bundleRef        // node encoded before, referenced by its index
+	bundleList
+	bundleText
+	bundlePipe
+	bundleAction
+	bundleCommand
+	bundleIdentifier
+	bundleUnderscore
+	bundleNilValue
+	bundleField
+	bundleChain
+	bundleBool
+	bundleNumber
+	bundleString
+	bundleSet
+	bundleIf
+	bundleRange
+	bundleBlockParameters
+	bundleBlock
+	bundleYield
+	bundleInclude
+	bundleAdditiveExpr
+	bundleMultiplicativeExpr
+	bundleLogicalExpr
+	bundleComparativeExpr
+	bundleNumericComparativeExpr
+	bundleNotExpr
+	bundleCallExpr
+	bundleTernaryExpr
+	bundleIndexExpr
+	bundleSliceExpr
+	bundleReturn
+	bundleTry
+	bundleCatch
+)
+
+// ExportBundle writes the parsed templates at templatePaths, together with the templates they extend,
+// import and include by constant names, to w. Included templates that fail to load are left out, since only
+// executing the include statement fails then. The bundle holds the syntax trees of the templates, the
+// extends/imports graph and the blocks available to each template, so a Set using it (see ReadBundle() and
+// WithBundle()) can execute the templates without lexing or parsing them. Templates are loaded and parsed
+// first if needed. Without templatePaths, ExportBundle writes all templates cached by the Set so far, which
+// is only possible when the Set uses the default cache.
+//
+// Templates are stored as parsed by s, so they are optimized already if s optimizes templates (see
+// WithOptimization()).
+func (s *Set) ExportBundle(w io.Writer, templatePaths ...string) error {
+	var roots []*Template
+	if len(templatePaths) == 0 {
+		c, ok := s.cache.(*cache)
+		if !ok {
+			return errors.New("jet: ExportBundle() needs the paths of the templates to export when the Set doesn't use the default cache")
+		}
+		c.m.Range(func(_, t interface{}) bool {
+			roots = append(roots, t.(*Template))
+			return true
+		})
+	}
+	for _, templatePath := range templatePaths {
+		t, err := s.GetTemplate(templatePath)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, t)
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Name < roots[j].Name })
+
+	e := &bundleEncoder{
+		stringIDs: map[string]int{},
+		nodeIDs:   map[Node]int{},
+		templates: map[string]int{},
+	}
+	var templates []*Template
+	var visit func(t *Template) error
+	visit = func(t *Template) error {
+		if _, ok := e.templates[t.Name]; ok {
+			return nil
+		}
+		// templates a template depends on are encoded before it; -1 marks the template as being visited
+		e.templates[t.Name] = -1
+		if t.extends != nil {
+			if err := visit(t.extends); err != nil {
+				return err
+			}
+		}
+		for _, _import := range t.imports {
+			if err := visit(_import); err != nil {
+				return err
+			}
+		}
+		e.templates[t.Name] = len(templates)
+		templates = append(templates, t)
+
+		var included []*Template
+		walk(t.Root, func(n Node) bool {
+			include, ok := n.(*IncludeNode)
+			if !ok {
+				return true
+			}
+			if name, ok := include.Name.(*StringNode); ok {
+				// a template failing to load only fails the include statement when it's executed, which the
+				// template may catch; the Set using the bundle then loads it through its Loader
+				if t, err := s.getSiblingTemplate(name.Text, include.TemplatePath, true); err == nil {
+					included = append(included, t)
+				}
+			}
+			return true
+		})
+		for _, t := range included {
+			if err := visit(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, t := range roots {
+		if err := visit(t); err != nil {
+			return err
+		}
+	}
+
+	e.uint(uint64(len(templates)))
+	for _, t := range templates {
+		e.template(t)
+	}
+	header := append([]byte(bundleMagic), make([]byte, binary.MaxVarintLen64)...)
+	header = header[:len(bundleMagic)+binary.PutUvarint(header[len(bundleMagic):], bundleVersion)]
+	sum := sha256.Sum256(e.buf.Bytes())
+	if _, err := w.Write(append(header, sum[:]...)); err != nil {
+		return err
+	}
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+// bundleEncoder encodes templates for a bundle. Strings are written once and referenced by their index
+// afterwards; the same goes for nodes, so nodes shared by several templates (like blocks defined in a
+// template and available to all templates extending it) are shared again after decoding.
+type bundleEncoder struct {
+	buf       bytes.Buffer
+	stringIDs map[string]int
+	nodeIDs   map[Node]int
+	templates map[string]int // index of each template in the bundle, by name
+	scratch   [binary.MaxVarintLen64]byte
+}
+
+func (e *bundleEncoder) uint(v uint64) {
+	e.buf.Write(e.scratch[:binary.PutUvarint(e.scratch[:], v)])
+}
+
+func (e *bundleEncoder) int(v int64) {
+	e.buf.Write(e.scratch[:binary.PutVarint(e.scratch[:], v)])
+}
+
+func (e *bundleEncoder) bool(v bool) {
+	if v {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *bundleEncoder) float(v float64) {
+	binary.LittleEndian.PutUint64(e.scratch[:8], math.Float64bits(v))
+	e.buf.Write(e.scratch[:8])
+}
+
+func (e *bundleEncoder) bytes(b []byte) {
+	e.uint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+// string writes the index of s in the string table, followed by s itself if it's new to the table.
+func (e *bundleEncoder) string(s string) {
+	if i, ok := e.stringIDs[s]; ok {
+		e.uint(uint64(i))
+		return
+	}
+	e.stringIDs[s] = len(e.stringIDs)
+	e.uint(uint64(len(e.stringIDs) - 1))
+	e.bytes([]byte(s))
+}
+
+func (e *bundleEncoder) stringSlice(s []string) {
+	e.uint(uint64(len(s)))
+	for _, s := range s {
+		e.string(s)
+	}
+}
+
+func (e *bundleEncoder) template(t *Template) {
+	e.string(t.Name)
+	e.string(t.ParseName)
+	e.string(t.text)
+	if t.extends != nil {
+		e.uint(uint64(e.templates[t.extends.Name] + 1))
+	} else {
+		e.uint(0)
+	}
+	e.uint(uint64(len(t.imports)))
+	for _, _import := range t.imports {
+		e.uint(uint64(e.templates[_import.Name]))
+	}
+	e.node(t.Root)
+	e.blocks(t.passedBlocks)
+	e.blocks(t.processedBlocks)
+	e.stringSlice(t.dependencies)
+}
+
+func (e *bundleEncoder) blocks(blocks map[string]*BlockNode) {
+	names := make([]string, 0, len(blocks))
+	for name := range blocks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.uint(uint64(len(names)))
+	for _, name := range names {
+		e.string(name)
+		e.node(blocks[name])
+	}
+}
+
+func (e *bundleEncoder) base(base *NodeBase) {
+	e.string(base.TemplatePath)
+	e.int(int64(base.Line))
+	e.uint(uint64(base.NodeType))
+	e.int(int64(base.Pos))
+}
+
+func (e *bundleEncoder) item(i item) {
+	e.uint(uint64(i.typ))
+	e.int(int64(i.pos))
+	e.string(i.val)
+}
+
+func (e *bundleEncoder) exprs(exprs []Expression) {
+	e.bool(exprs != nil)
+	e.uint(uint64(len(exprs)))
+	for _, expr := range exprs {
+		e.node(expr)
+	}
+}
+
+func (e *bundleEncoder) args(args *CallArgs) {
+	e.exprs(args.Exprs)
+	e.bool(args.HasPipeSlot)
+}
+
+func (e *bundleEncoder) binary(tag uint64, node *binaryExprNode) {
+	e.uint(tag)
+	e.base(&node.NodeBase)
+	e.item(node.Operator)
+	e.node(node.Left)
+	e.node(node.Right)
+}
+
+func (e *bundleEncoder) branch(tag uint64, node *BranchNode) {
+	e.uint(tag)
+	e.base(&node.NodeBase)
+	e.node(node.Set)
+	e.node(node.Expression)
+	e.node(node.List)
+	e.node(node.ElseList)
+}
+
+// node writes node, which may be nil or a nil pointer.
+func (e *bundleEncoder) node(node Node) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		e.uint(bundleNil)
+		return
+	}
+	if i, ok := e.nodeIDs[node]; ok {
+		e.uint(bundleRef)
+		e.uint(uint64(i))
+		return
+	}
+	e.nodeIDs[node] = len(e.nodeIDs)
+
+	switch n := node.(type) {
+	case *ListNode:
+		e.uint(bundleList)
+		e.base(&n.NodeBase)
+		e.uint(uint64(len(n.Nodes)))
+		for _, node := range n.Nodes {
+			e.node(node)
+		}
+	case *TextNode:
+		e.uint(bundleText)
+		e.base(&n.NodeBase)
+		e.bytes(n.Text)
+	case *PipeNode:
+		e.uint(bundlePipe)
+		e.base(&n.NodeBase)
+		e.uint(uint64(len(n.Cmds)))
+		for _, cmd := range n.Cmds {
+			e.node(cmd)
+		}
+	case *ActionNode:
+		e.uint(bundleAction)
+		e.base(&n.NodeBase)
+		e.node(n.Set)
+		e.node(n.Pipe)
+	case *CommandNode:
+		e.uint(bundleCommand)
+		e.base(&n.NodeBase)
+		e.base(&n.CallExprNode.NodeBase)
+		e.node(n.BaseExpr)
+		e.args(&n.CallArgs)
+	case *IdentifierNode:
+		e.uint(bundleIdentifier)
+		e.base(&n.NodeBase)
+		e.string(n.Ident)
+	case *UnderscoreNode:
+		e.uint(bundleUnderscore)
+		e.base(&n.NodeBase)
+	case *NilNode:
+		e.uint(bundleNilValue)
+		e.base(&n.NodeBase)
+	case *FieldNode:
+		e.uint(bundleField)
+		e.base(&n.NodeBase)
+		e.stringSlice(n.Ident)
+	case *ChainNode:
+		e.uint(bundleChain)
+		e.base(&n.NodeBase)
+		e.node(n.Node)
+		e.stringSlice(n.Field)
+	case *BoolNode:
+		e.uint(bundleBool)
+		e.base(&n.NodeBase)
+		e.bool(n.True)
+	case *NumberNode:
+		e.uint(bundleNumber)
+		e.base(&n.NodeBase)
+		e.bool(n.IsInt)
+		e.bool(n.IsUint)
+		e.bool(n.IsFloat)
+		e.bool(n.IsComplex)
+		e.int(n.Int64)
+		e.uint(n.Uint64)
+		e.float(n.Float64)
+		e.float(real(n.Complex128))
+		e.float(imag(n.Complex128))
+		e.string(n.Text)
+	case *StringNode:
+		e.uint(bundleString)
+		e.base(&n.NodeBase)
+		e.string(n.Quoted)
+		e.string(n.Text)
+	case *SetNode:
+		e.uint(bundleSet)
+		e.base(&n.NodeBase)
+		e.bool(n.Let)
+		e.bool(n.IndexExprGetLookup)
+		e.exprs(n.Left)
+		e.exprs(n.Right)
+	case *IfNode:
+		e.branch(bundleIf, &n.BranchNode)
+	case *RangeNode:
+		e.branch(bundleRange, &n.BranchNode)
+	case *BlockParameterList:
+		e.uint(bundleBlockParameters)
+		e.base(&n.NodeBase)
+		e.uint(uint64(len(n.List)))
+		for _, p := range n.List {
+			e.string(p.Identifier)
+			e.node(p.Expression)
+		}
+	case *BlockNode:
+		e.uint(bundleBlock)
+		e.base(&n.NodeBase)
+		e.string(n.Name)
+		e.node(n.Parameters)
+		e.node(n.Expression)
+		e.node(n.List)
+		e.node(n.Content)
+	case *YieldNode:
+		e.uint(bundleYield)
+		e.base(&n.NodeBase)
+		e.string(n.Name)
+		e.node(n.Parameters)
+		e.node(n.Expression)
+		e.node(n.Content)
+		e.bool(n.IsContent)
+	case *IncludeNode:
+		e.uint(bundleInclude)
+		e.base(&n.NodeBase)
+		e.node(n.Name)
+		e.node(n.Context)
+	case *AdditiveExprNode:
+		e.binary(bundleAdditiveExpr, &n.binaryExprNode)
+	case *MultiplicativeExprNode:
+		e.binary(bundleMultiplicativeExpr, &n.binaryExprNode)
+	case *LogicalExprNode:
+		e.binary(bundleLogicalExpr, &n.binaryExprNode)
+	case *ComparativeExprNode:
+		e.binary(bundleComparativeExpr, &n.binaryExprNode)
+	case *NumericComparativeExprNode:
+		e.binary(bundleNumericComparativeExpr, &n.binaryExprNode)
+	case *NotExprNode:
+		e.uint(bundleNotExpr)
+		e.base(&n.NodeBase)
+		e.node(n.Expr)
+	case *CallExprNode:
+		e.uint(bundleCallExpr)
+		e.base(&n.NodeBase)
+		e.node(n.BaseExpr)
+		e.args(&n.CallArgs)
+	case *TernaryExprNode:
+		e.uint(bundleTernaryExpr)
+		e.base(&n.NodeBase)
+		e.node(n.Boolean)
+		e.node(n.Left)
+		e.node(n.Right)
+	case *IndexExprNode:
+		e.uint(bundleIndexExpr)
+		e.base(&n.NodeBase)
+		e.node(n.Base)
+		e.node(n.Index)
+	case *SliceExprNode:
+		e.uint(bundleSliceExpr)
+		e.base(&n.NodeBase)
+		e.node(n.Base)
+		e.node(n.Index)
+		e.node(n.EndIndex)
+	case *ReturnNode:
+		e.uint(bundleReturn)
+		e.base(&n.NodeBase)
+		e.node(n.Value)
+	case *TryNode:
+		e.uint(bundleTry)
+		e.base(&n.NodeBase)
+		e.node(n.List)
+		e.node(n.Catch)
+	case *catchNode:
+		e.uint(bundleCatch)
+		e.base(&n.NodeBase)
+		e.node(n.Err)
+		e.node(n.List)
+	default:
+		panic(fmt.Errorf("jet: can't encode node of type %T", node))
+	}
+}
+
+// Bundle holds templates exported by Set.ExportBundle(). A Bundle is a Loader serving the sources of its
+// templates; to execute the templates without parsing them, pass it to WithBundle().
+type Bundle struct {
+	data         []byte              // encoded templates, following the header
+	sources      map[string]string   // source of each template, by name
+	dependencies map[string][]string // dependencies of each template, by name
+	names        []string            // names of the templates, sorted
+}
+
+// compile time check that we implement Loader
+var _ Loader = (*Bundle)(nil)
+
+// ReadBundle reads a bundle written by Set.ExportBundle(). It fails if the bundle is corrupt or was written
+// by a version of Jet using a different encoding.
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(bundleMagic)) {
+		return nil, errors.New("jet: not a template bundle")
+	}
+	data = data[len(bundleMagic):]
+	version, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errors.New("jet: invalid template bundle: truncated header")
+	}
+	if version != bundleVersion {
+		return nil, fmt.Errorf("jet: template bundle has format version %d, but this version of Jet reads version %d", version, bundleVersion)
+	}
+	data = data[n:]
+	if len(data) < sha256.Size {
+		return nil, errors.New("jet: invalid template bundle: truncated header")
+	}
+	// the checksum rejects corrupted bundles, which could decode to syntax trees the parser never produces
+	if sum := sha256.Sum256(data[sha256.Size:]); !bytes.Equal(sum[:], data[:sha256.Size]) {
+		return nil, errors.New("jet: invalid template bundle: checksum mismatch")
+	}
+	b := &Bundle{data: data[sha256.Size:], sources: map[string]string{}, dependencies: map[string][]string{}}
+
+	// decoding the templates once makes sure decoding them for a Set later on can't fail
+	templates, err := b.decode(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range templates {
+		b.sources[t.Name] = t.text
+		b.dependencies[t.Name] = t.dependencies
+		b.names = append(b.names, t.Name)
+	}
+	sort.Strings(b.names)
+	return b, nil
+}
+
+// Templates returns the names of the templates in the bundle, in lexical order.
+func (b *Bundle) Templates() []string {
+	return append([]string(nil), b.names...)
+}
+
+// Exists returns whether the bundle holds a template named templatePath.
+func (b *Bundle) Exists(templatePath string) bool {
+	_, ok := b.sources[templatePath]
+	return ok
+}
+
+// Open returns the source of the template named templatePath. Sets using the bundle via WithBundle() only
+// parse it in development mode.
+func (b *Bundle) Open(templatePath string) (io.ReadCloser, error) {
+	src, ok := b.sources[templatePath]
+	if !ok {
+		return nil, fmt.Errorf("%s does not exist", templatePath)
+	}
+	return ioutil.NopCloser(strings.NewReader(src)), nil
+}
+
+// decode decodes the templates of the bundle for set, in the order they were encoded.
+func (b *Bundle) decode(set *Set) (templates []*Template, err error) {
+	d := &bundleDecoder{data: b.data, set: set}
+	defer func() {
+		if e := recover(); e != nil {
+			decodeErr, ok := e.(bundleError)
+			if !ok {
+				panic(e)
+			}
+			templates, err = nil, fmt.Errorf("jet: invalid template bundle: %s", string(decodeErr))
+		}
+	}()
+
+	d.templates = make([]*Template, d.len())
+	for i := range d.templates {
+		d.templates[i] = d.template(i)
+	}
+	if len(d.data) > 0 {
+		d.errorf("%d bytes of trailing data", len(d.data))
+	}
+	return d.templates, nil
+}
+
+// bundleError is the panic value of a bundleDecoder failing to decode invalid data.
+type bundleError string
+
+// bundleDecoder decodes the templates encoded by a bundleEncoder.
+type bundleDecoder struct {
+	data      []byte
+	set       *Set
+	strings   []string
+	nodes     []Node
+	templates []*Template
+}
+
+func (d *bundleDecoder) errorf(format string, v ...interface{}) {
+	panic(bundleError(fmt.Sprintf(format, v...)))
+}
+
+func (d *bundleDecoder) uint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.errorf("truncated data")
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *bundleDecoder) int() int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.errorf("truncated data")
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// len reads a length, which can't exceed the number of bytes left since every element takes at least one byte.
+func (d *bundleDecoder) len() int {
+	v := d.uint()
+	if v > uint64(len(d.data)) {
+		d.errorf("length %d exceeds the data left", v)
+	}
+	return int(v)
+}
+
+func (d *bundleDecoder) bool() bool {
+	return d.next(1)[0] != 0
+}
+
+func (d *bundleDecoder) float() float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(d.next(8)))
+}
+
+func (d *bundleDecoder) next(n int) []byte {
+	if n > len(d.data) {
+		d.errorf("truncated data")
+	}
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *bundleDecoder) bytes() []byte {
+	return append([]byte(nil), d.next(d.len())...)
+}
+
+func (d *bundleDecoder) string() string {
+	i := d.uint()
+	if i < uint64(len(d.strings)) {
+		return d.strings[i]
+	}
+	if i != uint64(len(d.strings)) {
+		d.errorf("string %d referenced before being defined", i)
+	}
+	s := string(d.next(d.len()))
+	d.strings = append(d.strings, s)
+	return s
+}
+
+func (d *bundleDecoder) stringSlice() []string {
+	n := d.len()
+	if n == 0 {
+		return nil
+	}
+	s := make([]string, n)
+	for i := range s {
+		s[i] = d.string()
+	}
+	return s
+}
+
+// templateRef reads the index of a template decoded before the template at index i.
+func (d *bundleDecoder) templateRef(i int) *Template {
+	ref := d.uint()
+	if ref >= uint64(i) {
+		d.errorf("template %d depends on template %d, which isn't decoded yet", i, ref)
+	}
+	return d.templates[ref]
+}
+
+func (d *bundleDecoder) template(i int) *Template {
+	t := &Template{set: d.set}
+	t.Name = d.string()
+	t.ParseName = d.string()
+	t.text = d.string()
+	if extends := d.uint(); extends > 0 {
+		if extends > uint64(i) {
+			d.errorf("template %d extends template %d, which isn't decoded yet", i, extends-1)
+		}
+		t.extends = d.templates[extends-1]
+	}
+	if n := d.len(); n > 0 {
+		t.imports = make([]*Template, n)
+		for j := range t.imports {
+			t.imports[j] = d.templateRef(i)
+		}
+	}
+	t.Root = d.list()
+	t.passedBlocks = d.blocks()
+	t.processedBlocks = d.blocks()
+	t.dependencies = d.stringSlice()
+	return t
+}
+
+func (d *bundleDecoder) blocks() map[string]*BlockNode {
+	n := d.len()
+	blocks := make(map[string]*BlockNode, n)
+	for i := 0; i < n; i++ {
+		name := d.string()
+		block, ok := d.node().(*BlockNode)
+		if !ok {
+			d.errorf("block %s is not a block node", name)
+		}
+		blocks[name] = block
+	}
+	return blocks
+}
+
+func (d *bundleDecoder) base(base *NodeBase) {
+	base.TemplatePath = d.string()
+	base.Line = int(d.int())
+	base.NodeType = NodeType(d.uint())
+	base.Pos = Pos(d.int())
+}
+
+func (d *bundleDecoder) item() item {
+	return item{typ: itemType(d.uint()), pos: Pos(d.int()), val: d.string()}
+}
+
+func (d *bundleDecoder) expr() Expression {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	expr, ok := node.(Expression)
+	if !ok {
+		d.errorf("%T is not an expression", node)
+	}
+	return expr
+}
+
+func (d *bundleDecoder) exprs() []Expression {
+	isNil := !d.bool()
+	n := d.len()
+	if isNil {
+		return nil
+	}
+	exprs := make([]Expression, n)
+	for i := range exprs {
+		exprs[i] = d.expr()
+	}
+	return exprs
+}
+
+func (d *bundleDecoder) args(args *CallArgs) {
+	args.Exprs = d.exprs()
+	args.HasPipeSlot = d.bool()
+}
+
+func (d *bundleDecoder) binary(node *binaryExprNode) {
+	d.base(&node.NodeBase)
+	node.Operator = d.item()
+	node.Left = d.expr()
+	node.Right = d.expr()
+}
+
+func (d *bundleDecoder) branch(node *BranchNode) {
+	d.base(&node.NodeBase)
+	node.Set = d.setNode()
+	node.Expression = d.expr()
+	node.List = d.list()
+	node.ElseList = d.list()
+}
+
+func (d *bundleDecoder) list() *ListNode {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	list, ok := node.(*ListNode)
+	if !ok {
+		d.errorf("%T is not a list", node)
+	}
+	return list
+}
+
+func (d *bundleDecoder) setNode() *SetNode {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	set, ok := node.(*SetNode)
+	if !ok {
+		d.errorf("%T is not a set node", node)
+	}
+	return set
+}
+
+func (d *bundleDecoder) parameters() *BlockParameterList {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	params, ok := node.(*BlockParameterList)
+	if !ok {
+		d.errorf("%T is not a block parameter list", node)
+	}
+	return params
+}
+
+// node reads a node. Nodes are added to the decoded nodes before their children are decoded, in the same
+// order the encoder numbers them.
+func (d *bundleDecoder) node() Node {
+	tag := d.uint()
+	switch tag {
+	case bundleNil:
+		return nil
+	case bundleRef:
+		i := d.uint()
+		if i >= uint64(len(d.nodes)) {
+			d.errorf("node %d referenced before being defined", i)
+		}
+		return d.nodes[i]
+	}
+
+	switch tag {
+	case bundleList:
+		n := &ListNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		if count := d.len(); count > 0 {
+			n.Nodes = make([]Node, count)
+			for i := range n.Nodes {
+				n.Nodes[i] = d.node()
+			}
+		}
+		return n
+	case bundleText:
+		n := &TextNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Text = d.bytes()
+		return n
+	case bundlePipe:
+		n := &PipeNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		if count := d.len(); count > 0 {
+			n.Cmds = make([]*CommandNode, count)
+			for i := range n.Cmds {
+				cmd, ok := d.node().(*CommandNode)
+				if !ok {
+					d.errorf("pipeline command is not a command node")
+				}
+				n.Cmds[i] = cmd
+			}
+		}
+		return n
+	case bundleAction:
+		n := &ActionNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Set = d.setNode()
+		if node := d.node(); node != nil {
+			pipe, ok := node.(*PipeNode)
+			if !ok {
+				d.errorf("%T is not a pipeline", node)
+			}
+			n.Pipe = pipe
+		}
+		return n
+	case bundleCommand:
+		n := &CommandNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		d.base(&n.CallExprNode.NodeBase)
+		n.BaseExpr = d.expr()
+		d.args(&n.CallArgs)
+		return n
+	case bundleIdentifier:
+		n := &IdentifierNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Ident = d.string()
+		return n
+	case bundleUnderscore:
+		n := &UnderscoreNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		return n
+	case bundleNilValue:
+		n := &NilNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		return n
+	case bundleField:
+		n := &FieldNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Ident = d.stringSlice()
+		return n
+	case bundleChain:
+		n := &ChainNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		if n.Node = d.node(); n.Node == nil {
+			d.errorf("chain without a base node")
+		}
+		n.Field = d.stringSlice()
+		return n
+	case bundleBool:
+		n := &BoolNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.True = d.bool()
+		return n
+	case bundleNumber:
+		n := &NumberNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.IsInt = d.bool()
+		n.IsUint = d.bool()
+		n.IsFloat = d.bool()
+		n.IsComplex = d.bool()
+		n.Int64 = d.int()
+		n.Uint64 = d.uint()
+		n.Float64 = d.float()
+		n.Complex128 = complex(d.float(), d.float())
+		n.Text = d.string()
+		return n
+	case bundleString:
+		n := &StringNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Quoted = d.string()
+		n.Text = d.string()
+		return n
+	case bundleSet:
+		n := &SetNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Let = d.bool()
+		n.IndexExprGetLookup = d.bool()
+		n.Left = d.exprs()
+		n.Right = d.exprs()
+		return n
+	case bundleIf:
+		n := &IfNode{}
+		d.nodes = append(d.nodes, n)
+		d.branch(&n.BranchNode)
+		return n
+	case bundleRange:
+		n := &RangeNode{}
+		d.nodes = append(d.nodes, n)
+		d.branch(&n.BranchNode)
+		return n
+	case bundleBlockParameters:
+		n := &BlockParameterList{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		if count := d.len(); count > 0 {
+			n.List = make([]BlockParameter, count)
+			for i := range n.List {
+				n.List[i].Identifier = d.string()
+				n.List[i].Expression = d.expr()
+			}
+		}
+		return n
+	case bundleBlock:
+		n := &BlockNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Name = d.string()
+		n.Parameters = d.parameters()
+		n.Expression = d.expr()
+		n.List = d.list()
+		n.Content = d.list()
+		return n
+	case bundleYield:
+		n := &YieldNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Name = d.string()
+		n.Parameters = d.parameters()
+		n.Expression = d.expr()
+		n.Content = d.list()
+		n.IsContent = d.bool()
+		return n
+	case bundleInclude:
+		n := &IncludeNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Name = d.expr()
+		n.Context = d.expr()
+		return n
+	case bundleAdditiveExpr:
+		n := &AdditiveExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.binary(&n.binaryExprNode)
+		return n
+	case bundleMultiplicativeExpr:
+		n := &MultiplicativeExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.binary(&n.binaryExprNode)
+		return n
+	case bundleLogicalExpr:
+		n := &LogicalExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.binary(&n.binaryExprNode)
+		return n
+	case bundleComparativeExpr:
+		n := &ComparativeExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.binary(&n.binaryExprNode)
+		return n
+	case bundleNumericComparativeExpr:
+		n := &NumericComparativeExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.binary(&n.binaryExprNode)
+		return n
+	case bundleNotExpr:
+		n := &NotExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Expr = d.expr()
+		return n
+	case bundleCallExpr:
+		n := &CallExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.BaseExpr = d.expr()
+		d.args(&n.CallArgs)
+		return n
+	case bundleTernaryExpr:
+		n := &TernaryExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Boolean = d.expr()
+		n.Left = d.expr()
+		n.Right = d.expr()
+		return n
+	case bundleIndexExpr:
+		n := &IndexExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Base = d.expr()
+		n.Index = d.expr()
+		return n
+	case bundleSliceExpr:
+		n := &SliceExprNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Base = d.expr()
+		n.Index = d.expr()
+		n.EndIndex = d.expr()
+		return n
+	case bundleReturn:
+		n := &ReturnNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.Value = d.expr()
+		return n
+	case bundleTry:
+		n := &TryNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		n.List = d.list()
+		if node := d.node(); node != nil {
+			catch, ok := node.(*catchNode)
+			if !ok {
+				d.errorf("%T is not a catch node", node)
+			}
+			n.Catch = catch
+		}
+		return n
+	case bundleCatch:
+		n := &catchNode{}
+		d.nodes = append(d.nodes, n)
+		d.base(&n.NodeBase)
+		if node := d.node(); node != nil {
+			ident, ok := node.(*IdentifierNode)
+			if !ok {
+				d.errorf("%T is not an identifier", node)
+			}
+			n.Err = ident
+		}
+		n.List = d.list()
+		return n
+	}
+	d.errorf("unknown node tag %d", tag)
+	return nil
+}
+
+// WithBundle returns an option function that makes the Set use the templates of b instead of parsing them:
+// looking up a template held by b returns the template decoded from b, while all other templates are
+// loaded, parsed and cached as usual. The templates are decoded for the Set when the first template is
+// looked up; templates are then optimized and compiled like parsed ones if the Set does so.
+//
+// In development mode, the Set bypasses the bundle like any cache. Passing b as the Set's Loader, too, makes
+// the Set parse the templates' sources bundled in b then.
+func WithBundle(b *Bundle) Option {
+	return func(s *Set) {
+		s.bundle = b
+	}
+}
+
+// bundleCache returns the templates decoded from a Bundle for a Set, and forwards lookups of all other
+// templates to the Set's cache.
+type bundleCache struct {
+	Cache
+	bundle    *Bundle
+	set       *Set
+	once      sync.Once
+	mu        sync.RWMutex
+	templates map[string]*Template // guarded by mu once decoded
+	err       error                // error decoding the bundle for the Set, see decodeErr()
+}
+
+// compile-time check that bundleCache implements Cache and Evicter
+var (
+	_ Cache   = (*bundleCache)(nil)
+	_ Evicter = (*bundleCache)(nil)
+)
+
+func (c *bundleCache) Get(templatePath string) *Template {
+	c.once.Do(c.decode)
+	c.mu.RLock()
+	t, ok := c.templates[templatePath]
+	c.mu.RUnlock()
+	if ok {
+		return t
+	}
+	return c.Cache.Get(templatePath)
+}
+
+// Evict removes a template from the bundled templates, making the Set load it through its Loader from now on,
+// and from the Set's cache if that can evict templates.
+func (c *bundleCache) Evict(templatePath string) {
+	c.once.Do(c.decode)
+	c.mu.Lock()
+	delete(c.templates, templatePath)
+	c.mu.Unlock()
+	if evicter, ok := c.Cache.(Evicter); ok {
+		evicter.Evict(templatePath)
+	}
+}
+
+// decodeErr decodes the bundle if that didn't happen yet, and returns the error decoding it. The bundle was
+// decoded by ReadBundle() already, so this only fails if the Bundle was changed or built otherwise; the Set
+// then reports the error instead of returning templates.
+func (c *bundleCache) decodeErr() error {
+	c.once.Do(c.decode)
+	return c.err
+}
+
+func (c *bundleCache) decode() {
+	templates, err := c.bundle.decode(c.set)
+	if err != nil {
+		c.err = err
+		return
+	}
+	c.templates = make(map[string]*Template, len(templates))
+	for _, t := range templates {
+		// same as after parsing, see Set.parse()
+		resolveVariables(t.Root)
+		constants := t.markConstants()
+		if c.set.optimizeTemplates {
+			t.optimize(constants)
+		}
+		if c.set.compileTemplates {
+			t.compile()
+		}
+		c.templates[t.Name] = t
+	}
+}
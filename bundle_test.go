@@ -0,0 +1,213 @@
+package jet
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// noLoader is a Loader without templates, to make sure a Set doesn't parse any.
+type noLoader struct{}
+
+func (noLoader) Exists(string) bool { return false }
+
+func (noLoader) Open(templatePath string) (io.ReadCloser, error) {
+	panic("unexpected Open(" + templatePath + ")")
+}
+
+func newBundleTestLoader() *InMemLoader {
+	loader := NewInMemLoader()
+	loader.Set("/layout.jet", `<html>{{ block body() }}default{{ end }}|{{ block footer() }}(c) {{ year }}{{ end }}</html>`)
+	loader.Set("/macros.jet", `{{ block greet(name="world") }}Hello, {{ name }}!{{ end }}`)
+	loader.Set("/views/page.jet", `{{ extends "../layout.jet" }}{{ import "/macros.jet" }}
+{{- block body() -}}
+	{{ yield greet(name=.Name) }} {{ yield greet() }}
+	{{ range i, v := .Items }}{{ i }}={{ v * 2 }};{{ else }}none{{ end }}
+	{{ try }}{{ missing() }}{{ catch err }}caught{{ end }}
+	{{ include "partial.jet" .Name }} {{ try }}{{ include "/missing.jet" }}{{ catch }}no include{{ end }}
+	{{ x := 3.5 }}{{ x > 2 ? "big" : "small" }} {{ .Items[1:] }} {{ "a" + "b" | upper }} {{ !true || len(.Items) == 3 }}
+	{{ if y := 1; y < 0 }}negative{{ else if .Name != "" }}named{{ end }}
+	{{- return "ignored" -}}
+{{- end }}`)
+	loader.Set("/views/partial.jet", `[{{ . }}]`)
+	return loader
+}
+
+func TestBundle(t *testing.T) {
+	source := NewSet(newBundleTestLoader())
+	source.AddGlobal("year", 2026)
+
+	var buf bytes.Buffer
+	if err := source.ExportBundle(&buf, "/views/page.jet"); err != nil {
+		t.Fatalf("exporting bundle: %v", err)
+	}
+	b, err := ReadBundle(&buf)
+	if err != nil {
+		t.Fatalf("reading bundle: %v", err)
+	}
+	if want := []string{"/layout.jet", "/macros.jet", "/views/page.jet", "/views/partial.jet"}; !reflect.DeepEqual(b.Templates(), want) {
+		t.Errorf("bundled templates: expected %v, got %v", want, b.Templates())
+	}
+
+	context := struct {
+		Name  string
+		Items []int
+	}{"Jet", []int{1, 2, 3}}
+
+	parsed, err := source.GetTemplate("/views/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected bytes.Buffer
+	if err := parsed.Execute(&expected, nil, context); err != nil {
+		t.Fatal(err)
+	}
+
+	sets := map[string]*Set{
+		"bundle":             NewSet(noLoader{}, WithBundle(b)),
+		"compiled bundle":    NewSet(noLoader{}, WithBundle(b), WithCompilation()),
+		"optimized bundle":   NewSet(noLoader{}, WithBundle(b), WithOptimization()),
+		"bundle as a loader": NewSet(b, WithBundle(b), InDevelopmentMode()),
+	}
+	for name, set := range sets {
+		set.AddGlobal("year", 2026)
+		tt, err := set.GetTemplate("/views/page")
+		if err != nil {
+			t.Errorf("%s: getting template: %v", name, err)
+			continue
+		}
+		if !set.optimizeTemplates && tt.String() != parsed.String() {
+			t.Errorf("%s: expected tree %q, got %q", name, parsed.String(), tt.String())
+		}
+		var got bytes.Buffer
+		if err := tt.Execute(&got, nil, context); err != nil {
+			t.Errorf("%s: executing template: %v", name, err)
+			continue
+		}
+		if got.String() != expected.String() {
+			t.Errorf("%s: expected %q, got %q", name, expected.String(), got.String())
+		}
+	}
+
+	// blocks shared by templates are shared after decoding, too
+	set := NewSet(noLoader{}, WithBundle(b))
+	layout, _ := set.GetTemplate("/layout.jet")
+	page, _ := set.GetTemplate("/views/page.jet")
+	if layout.Blocks()["footer"] != page.Blocks()["footer"] || page.Extends() != layout {
+		t.Errorf("decoded templates don't share the blocks and templates they extend")
+	}
+}
+
+func TestBundleRuntimeError(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/broken.jet", "line 1\n{{ .Missing }}")
+	var buf bytes.Buffer
+	if err := NewSet(loader).ExportBundle(&buf, "/broken.jet"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadBundle(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt, err := NewSet(noLoader{}, WithBundle(b)).GetTemplate("/broken.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tt.Execute(ioutil.Discard, nil, struct{}{})
+	jetErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error, got %v", err)
+	}
+	if jetErr.Line != 2 || !strings.Contains(jetErr.Excerpt, ".Missing") {
+		t.Errorf("expected the error to point into the bundled source, got line %d, excerpt %q", jetErr.Line, jetErr.Excerpt)
+	}
+}
+
+func TestBundleDecodeError(t *testing.T) {
+	b := &Bundle{data: []byte{1}}
+	if _, err := NewSet(noLoader{}, WithBundle(b)).GetTemplate("/page.jet"); err == nil || !strings.Contains(err.Error(), "invalid template bundle") {
+		t.Errorf("expected an error decoding the bundle, got %v", err)
+	}
+}
+
+func TestExportBundleCachedTemplates(t *testing.T) {
+	set := NewSet(newBundleTestLoader())
+	if _, err := set.GetTemplate("/macros.jet"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := set.ExportBundle(&buf); err != nil {
+		t.Fatalf("exporting bundle: %v", err)
+	}
+	b, err := ReadBundle(&buf)
+	if err != nil {
+		t.Fatalf("reading bundle: %v", err)
+	}
+	if want := []string{"/macros.jet"}; !reflect.DeepEqual(b.Templates(), want) {
+		t.Errorf("bundled templates: expected %v, got %v", want, b.Templates())
+	}
+
+	withCache := NewSet(newBundleTestLoader(), WithCache(struct{ Cache }{&cache{}}))
+	if err := withCache.ExportBundle(&buf); err == nil {
+		t.Errorf("expected an error exporting the cached templates of a Set with a custom cache")
+	}
+}
+
+func TestReadBundleErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewSet(newBundleTestLoader()).ExportBundle(&buf, "/views/page.jet"); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	corrupted := append([]byte(nil), valid...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	tests := map[string]struct {
+		data  string
+		error string
+	}{
+		"empty":     {"", "not a template bundle"},
+		"other":     {"<html></html>", "not a template bundle"},
+		"version":   {bundleMagic + "\x63", "format version 99"},
+		"header":    {string(valid[:len(bundleMagic)+10]), "truncated header"},
+		"truncated": {string(valid[:len(valid)-10]), "checksum mismatch"},
+		"trailing":  {string(valid) + "\x00", "checksum mismatch"},
+		"corrupted": {string(corrupted), "checksum mismatch"},
+	}
+	for name, test := range tests {
+		_, err := ReadBundle(strings.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, test.error, err)
+		}
+	}
+}
+
+func BenchmarkGetTemplateFromBundle(b *testing.B) {
+	var buf bytes.Buffer
+	if err := NewSet(newBundleTestLoader()).ExportBundle(&buf, "/views/page.jet"); err != nil {
+		b.Fatal(err)
+	}
+	bundle, err := ReadBundle(&buf)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewSet(newBundleTestLoader()).GetTemplate("/views/page.jet"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("bundle", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewSet(noLoader{}, WithBundle(bundle)).GetTemplate("/views/page.jet"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -13,13 +13,30 @@ type Cache interface {
 	Put(templatePath string, t *Template)
 }
 
+// Evicter is an optional interface for Caches that can remove templates, as needed by Set.Invalidate().
+type Evicter interface {
+	// Evict removes the template stored under templatePath, if any.
+	Evict(templatePath string)
+}
+
+// removalNotifier is implemented by caches removing templates on their own, like LRUCache, so a Set using
+// the cache can drop the removed templates from its dependency graph.
+type removalNotifier interface {
+	// notifyRemoval registers fn to be called with the path of every template removed from the cache, or
+	// not stored by Put(). fn is called before the template can be stored again, and must not use the cache.
+	notifyRemoval(fn func(templatePath string))
+}
+
 // cache is the cache used by default in a new Set.
 type cache struct {
 	m sync.Map
 }
 
-// compile-time check that cache implements Cache
-var _ Cache = (*cache)(nil)
+// compile-time check that cache implements Cache and Evicter
+var (
+	_ Cache   = (*cache)(nil)
+	_ Evicter = (*cache)(nil)
+)
 
 func (c *cache) Get(templatePath string) *Template {
 	_t, ok := c.m.Load(templatePath)
@@ -32,3 +49,70 @@ func (c *cache) Get(templatePath string) *Template {
 func (c *cache) Put(templatePath string, t *Template) {
 	c.m.Store(templatePath, t)
 }
+
+func (c *cache) Evict(templatePath string) {
+	c.m.Delete(templatePath)
+}
+
+// VersionedCache is a concurrency-safe in-memory Cache that checks whether a template is still up to date
+// whenever it's read: if the version of the template or of a template it extends or imports (directly or
+// indirectly) changed since it was loaded, the template is evicted and Get() returns nil, making the Set
+// load and parse the template again. Unlike development mode, which parses templates on every lookup,
+// this only costs a call to Version() for every template involved as long as the templates don't change.
+//
+// The Versioner is usually the Loader of the Set using the cache. Templates whose version can't be determined
+// any more (e.g. because they were deleted) are evicted as well.
+type VersionedCache struct {
+	versioner Versioner
+	m         sync.Map
+}
+
+// compile-time check that VersionedCache implements Cache and Evicter
+var (
+	_ Cache   = (*VersionedCache)(nil)
+	_ Evicter = (*VersionedCache)(nil)
+)
+
+// NewVersionedCache returns a VersionedCache checking the versions of templates with v.
+func NewVersionedCache(v Versioner) *VersionedCache {
+	return &VersionedCache{versioner: v}
+}
+
+func (c *VersionedCache) Get(templatePath string) *Template {
+	_t, ok := c.m.Load(templatePath)
+	if !ok {
+		return nil
+	}
+	t := _t.(*Template)
+	if !c.upToDate(t) {
+		c.m.Delete(templatePath)
+		return nil
+	}
+	return t
+}
+
+// upToDate reports whether t and the templates it extends and imports are still at the versions they were
+// loaded at.
+func (c *VersionedCache) upToDate(t *Template) bool {
+	version, err := c.versioner.Version(t.Name)
+	if err != nil || version != t.version {
+		return false
+	}
+	if t.extends != nil && !c.upToDate(t.extends) {
+		return false
+	}
+	for _, _import := range t.imports {
+		if !c.upToDate(_import) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *VersionedCache) Put(templatePath string, t *Template) {
+	c.m.Store(templatePath, t)
+}
+
+func (c *VersionedCache) Evict(templatePath string) {
+	c.m.Delete(templatePath)
+}
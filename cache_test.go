@@ -0,0 +1,60 @@
+package jet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVersionedCache(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/layout.jet", `<html>{{ block body() }}{{ end }}</html>`)
+	loader.Set("/macros.jet", `{{ block greet() }}hello{{ end }}`)
+	loader.Set("/page.jet", `{{ extends "layout.jet" }}{{ import "macros.jet" }}{{ block body() }}{{ yield greet() }}{{ end }}`)
+	set := NewSet(loader, WithCache(NewVersionedCache(loader)))
+
+	render := func() (*Template, string) {
+		t.Helper()
+		tt, err := set.GetTemplate("/page.jet")
+		if err != nil {
+			t.Fatalf("getting template: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tt.Execute(&buf, nil, nil); err != nil {
+			t.Fatalf("executing template: %v", err)
+		}
+		return tt, buf.String()
+	}
+
+	first, out := render()
+	if out != "<html>hello</html>" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if again, _ := render(); again != first {
+		t.Errorf("unchanged template was parsed again")
+	}
+
+	changes := []struct {
+		templatePath, contents, expected string
+	}{
+		{"/page.jet", `{{ extends "layout.jet" }}{{ import "macros.jet" }}{{ block body() }}{{ yield greet() }}!{{ end }}`, "<html>hello!</html>"},
+		{"/layout.jet", `<body>{{ block body() }}{{ end }}</body>`, "<body>hello!</body>"},
+		{"/macros.jet", `{{ block greet() }}hi{{ end }}`, "<body>hi!</body>"},
+	}
+	previous := first
+	for _, change := range changes {
+		loader.Set(change.templatePath, change.contents)
+		tt, out := render()
+		if tt == previous {
+			t.Errorf("changing %s didn't invalidate the cached template", change.templatePath)
+		}
+		if out != change.expected {
+			t.Errorf("after changing %s: expected %q, got %q", change.templatePath, change.expected, out)
+		}
+		previous = tt
+	}
+
+	loader.Delete("/macros.jet")
+	if _, err := set.GetTemplate("/page.jet"); err == nil {
+		t.Errorf("expected an error getting a template importing a deleted template")
+	}
+}
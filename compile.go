@@ -0,0 +1,597 @@
+package jet
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/CloudyKit/fastprinter"
+)
+
+// evalFunc evaluates a compiled expression.
+type evalFunc func(st *Runtime) reflect.Value
+
+// execFunc executes a compiled list of nodes. Like executeList(), it returns the value of the list's last
+// if, range, try, include or return node.
+type execFunc func(st *Runtime) reflect.Value
+
+// branchFunc executes a compiled if or range node. Like executeList(), it only replaces returnValue, the value
+// of the list so far, when it executes one of its lists, and a range doesn't iterate once returnValue is set.
+type branchFunc func(st *Runtime, returnValue reflect.Value) reflect.Value
+
+// pipeFunc evaluates a compiled pipeline or command. The bool result reports whether a SafeWriter consumed the value.
+type pipeFunc func(st *Runtime) (reflect.Value, bool)
+
+// compile turns every list of nodes in the template into a tree of closures that executeList() dispatches to.
+// The closures mirror the interpreter in eval.go: node kinds are switched on once, constants are converted once,
+// and pipelines are split into their commands once, instead of on every execution. Nodes that can't be compiled
+// any better (blocks, yields, includes, ...) are handed back to the interpreter, whose nested lists are compiled
+// in turn.
+func (t *Template) compile() {
+	walk(t.Root, func(n Node) bool {
+		if list, ok := n.(*ListNode); ok {
+			compileList(list)
+		}
+		return true
+	})
+}
+
+func compileList(list *ListNode) execFunc {
+	if list.exec != nil {
+		return list.exec
+	}
+
+	type statement struct {
+		exec    execFunc
+		returns bool       // whether the statement's result becomes the list's return value
+		branch  branchFunc // used instead of exec for if and range nodes
+	}
+	statements := make([]statement, 0, len(list.Nodes))
+	inNewScope := false // to use just one scope for multiple actions with variable declarations
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *TextNode:
+			statements = append(statements, statement{exec: compileText(node)})
+		case *ActionNode:
+			newScope := node.Set != nil && node.Set.Let && !inNewScope
+			if newScope {
+				inNewScope = true
+			}
+			var vars []string
+			if newScope {
+				vars = list.vars
+			}
+			statements = append(statements, statement{exec: compileAction(node, vars, newScope)})
+		case *IfNode:
+			statements = append(statements, statement{branch: compileIf(node)})
+		case *RangeNode:
+			statements = append(statements, statement{branch: compileRange(node)})
+		case *TryNode:
+			statements = append(statements, statement{exec: func(st *Runtime) reflect.Value {
+				return st.executeTry(node)
+			}, returns: true})
+		case *YieldNode:
+			statements = append(statements, statement{exec: compileYield(node)})
+		case *BlockNode:
+			statements = append(statements, statement{exec: func(st *Runtime) reflect.Value {
+				block, has := st.getBlock(node.Name)
+				if has == false {
+					block = node
+				}
+				st.executeYieldBlock(node.Line, block, block.Parameters, block.Parameters, block.Expression, block.Content)
+				return reflect.Value{}
+			}})
+		case *IncludeNode:
+			statements = append(statements, statement{exec: func(st *Runtime) reflect.Value {
+				return st.executeInclude(node)
+			}, returns: true})
+		case *ReturnNode:
+			value := compileExpression(node.Value)
+			statements = append(statements, statement{exec: execFunc(value), returns: true})
+		}
+	}
+
+	list.exec = func(st *Runtime) (returnValue reflect.Value) {
+		for i := range statements {
+			if statements[i].branch != nil {
+				returnValue = statements[i].branch(st, returnValue)
+				continue
+			}
+			v := statements[i].exec(st)
+			if statements[i].returns {
+				returnValue = v
+			}
+		}
+		// not deferred, so the variables are still in scope when a panic reaches recover()
+		if inNewScope {
+			st.releaseScope()
+		}
+		return returnValue
+	}
+	return list.exec
+}
+
+func compileText(node *TextNode) execFunc {
+	text := node.Text
+	return func(st *Runtime) reflect.Value {
+		if _, err := st.Writer.Write(text); err != nil {
+			node.error(err)
+		}
+		return reflect.Value{}
+	}
+}
+
+// compileAction compiles an action; if newScope is set, the action pushes the scope of its list, with a slot for each of vars.
+func compileAction(node *ActionNode, vars []string, newScope bool) execFunc {
+	var set func(st *Runtime)
+	if node.Set != nil {
+		set = compileSetList(node.Set)
+	}
+	if node.Pipe == nil {
+		if set == nil {
+			return func(*Runtime) reflect.Value { return reflect.Value{} }
+		}
+		return func(st *Runtime) reflect.Value {
+			if newScope {
+				st.newScope(vars)
+			}
+			set(st)
+			return reflect.Value{}
+		}
+	}
+
+	pipe := compilePipeline(node.Pipe)
+	return func(st *Runtime) reflect.Value {
+		if newScope {
+			st.newScope(vars)
+		}
+		if set != nil {
+			set(st)
+		}
+		v, safeWriter := pipe(st)
+		if !safeWriter && v.IsValid() {
+			if v.Type().Implements(rendererType) {
+				v.Interface().(Renderer).Render(st)
+			} else {
+				_, err := fastprinter.PrintValue(st.escapeeWriter, v)
+				if err != nil {
+					node.error(err)
+				}
+			}
+		}
+		return reflect.Value{}
+	}
+}
+
+// compileSetList compiles the assignments or variable declarations in set, see executeSetList() and executeLetList().
+func compileSetList(set *SetNode) func(st *Runtime) {
+	assign := func(st *Runtime, i int, value reflect.Value) {
+		st.executeSet(set.Left[i], value)
+	}
+	if set.Let {
+		assign = func(st *Runtime, i int, value reflect.Value) {
+			st.letIdent(set.Left[i], value)
+		}
+	}
+
+	if set.IndexExprGetLookup {
+		right := compileExpression(set.Right[0])
+		assignValue, assignOk := set.Left[0].Type() != NodeUnderscore, set.Left[1].Type() != NodeUnderscore
+		return func(st *Runtime) {
+			value := right(st)
+			if assignValue {
+				assign(st, 0, value)
+			}
+			if assignOk {
+				if value.IsValid() {
+					assign(st, 1, valueBoolTRUE)
+				} else {
+					assign(st, 1, valueBoolFALSE)
+				}
+			}
+		}
+	}
+
+	right := make([]evalFunc, len(set.Left))
+	for i := range set.Left {
+		right[i] = compileExpression(set.Right[i])
+	}
+	return func(st *Runtime) {
+		for i := range right {
+			value := right[i](st)
+			if set.Left[i].Type() != NodeUnderscore {
+				assign(st, i, value)
+			}
+		}
+	}
+}
+
+func compileIf(node *IfNode) branchFunc {
+	var set func(st *Runtime)
+	if node.Set != nil {
+		set = compileSetList(node.Set)
+	}
+	isLet := node.Set != nil && node.Set.Let
+	condition := compileExpression(node.Expression)
+	then := compileList(node.List)
+	var otherwise execFunc
+	if node.ElseList != nil {
+		otherwise = compileList(node.ElseList)
+	}
+
+	return func(st *Runtime, returnValue reflect.Value) reflect.Value {
+		if isLet {
+			st.newScope(node.vars)
+		}
+		if set != nil {
+			set(st)
+		}
+		if isTrue(condition(st)) {
+			returnValue = then(st)
+		} else if otherwise != nil {
+			returnValue = otherwise(st)
+		}
+		if isLet {
+			st.releaseScope()
+		}
+		return returnValue
+	}
+}
+
+func compileRange(node *RangeNode) branchFunc {
+	isSet := node.Set != nil
+	isLet := isSet && node.Set.Let
+	var expression evalFunc
+	if isSet {
+		expression = compileExpression(node.Set.Right[0])
+	} else {
+		expression = compileExpression(node.Expression)
+	}
+	list := compileList(node.List)
+	var otherwise execFunc
+	if node.ElseList != nil {
+		otherwise = compileList(node.ElseList)
+	}
+	assign := func(st *Runtime, slot int, value reflect.Value) {
+		if isLet {
+			st.letIdent(node.Set.Left[slot], value)
+		} else {
+			st.executeSet(node.Set.Left[slot], value)
+		}
+	}
+
+	return func(st *Runtime, returnValue reflect.Value) reflect.Value {
+		keyVarSlot := 0
+		valVarSlot := -1
+		if isSet && len(node.Set.Left) > 1 {
+			valVarSlot = 1
+		}
+
+		context := st.context
+		value := expression(st)
+		if isLet {
+			st.newScope(node.vars)
+		}
+
+		ranger, cleanup, err := getRanger(value)
+		if err != nil {
+			node.error(err)
+		}
+		if !ranger.ProvidesIndex() {
+			if isSet && len(node.Set.Left) > 1 {
+				// two-vars assignment with ranger that doesn't provide an index
+				node.error(errors.New("two-var range over ranger that does not provide an index"))
+			} else if isSet {
+				keyVarSlot, valVarSlot = -1, 0
+			}
+		}
+
+		indexValue, rangeValue, end := ranger.Range()
+		if !end {
+			for !end && !returnValue.IsValid() {
+				if isSet {
+					if keyVarSlot >= 0 {
+						assign(st, keyVarSlot, indexValue)
+					}
+					if valVarSlot >= 0 {
+						assign(st, valVarSlot, rangeValue)
+					}
+				}
+				if valVarSlot < 0 {
+					st.context = rangeValue
+				}
+				returnValue = list(st)
+				indexValue, rangeValue, end = ranger.Range()
+			}
+		} else if otherwise != nil {
+			returnValue = otherwise(st)
+		}
+		cleanup()
+		st.context = context
+		if isLet {
+			st.releaseScope()
+		}
+		return returnValue
+	}
+}
+
+func compileYield(node *YieldNode) execFunc {
+	if node.IsContent {
+		return func(st *Runtime) reflect.Value {
+			if st.content != nil {
+				st.frames[len(st.frames)-1].Line = node.Line
+				st.content(st, node.Expression)
+			}
+			return reflect.Value{}
+		}
+	}
+	return func(st *Runtime) reflect.Value {
+		block, has := st.getBlock(node.Name)
+		if has == false || block == nil {
+			node.errorf("unresolved block %q!!%s", node.Name, didYouMean(node.Name, st.scope.blockNames()))
+		}
+		st.executeYieldBlock(node.Line, block, block.Parameters, node.Parameters, node.Expression, node.Content)
+		return reflect.Value{}
+	}
+}
+
+func compilePipeline(node *PipeNode) pipeFunc {
+	first := compileCommand(node.Cmds[0])
+	if len(node.Cmds) == 1 {
+		return first
+	}
+
+	rest := make([]func(st *Runtime, value reflect.Value) (reflect.Value, bool), len(node.Cmds)-1)
+	for i, cmd := range node.Cmds[1:] {
+		rest[i] = compilePipeCommand(cmd)
+	}
+	return func(st *Runtime) (reflect.Value, bool) {
+		value, safeWriter := first(st)
+		for i := range rest {
+			if safeWriter {
+				node.Cmds[i+1].errorf("unexpected command %s, writer command should be the last command", node.Cmds[i+1])
+			}
+			value, safeWriter = rest[i](st, value)
+		}
+		return value, safeWriter
+	}
+}
+
+// compileCommand compiles the first command of a pipeline, see evalCommandExpression().
+func compileCommand(node *CommandNode) pipeFunc {
+	term := compileExpression(node.BaseExpr)
+	if node.Exprs == nil {
+		return func(st *Runtime) (reflect.Value, bool) {
+			return term(st), false
+		}
+	}
+
+	node.CallArgs.compiled = compileArgs(node.Exprs)
+	return func(st *Runtime) (reflect.Value, bool) {
+		v := term(st)
+		if !v.IsValid() {
+			return v, false
+		}
+		if v.Kind() == reflect.Func {
+			if v.Type() == safeWriterType {
+				st.evalSafeWriter(v, node)
+				return reflect.Value{}, true
+			}
+			ret, err := st.evalCallExpression(v, node.CallArgs)
+			if err != nil {
+				node.BaseExpr.error(err)
+			}
+			return ret, false
+		}
+		node.Exprs[0].errorf("command %q has arguments but is %s, not a function", node.Exprs[0], v.Type())
+		return v, false
+	}
+}
+
+// compilePipeCommand compiles a command the value of the previous command is piped into, see evalCommandPipeExpression().
+func compilePipeCommand(node *CommandNode) func(st *Runtime, value reflect.Value) (reflect.Value, bool) {
+	term := compileExpression(node.BaseExpr)
+	node.CallArgs.compiled = compileArgs(node.Exprs)
+	return func(st *Runtime, value reflect.Value) (reflect.Value, bool) {
+		v := term(st)
+		if !v.IsValid() {
+			node.errorf("base expression of command pipe node is invalid value")
+		}
+		if v.Kind() != reflect.Func {
+			node.BaseExpr.errorf("pipe command %q must be a function, but is %s", node.BaseExpr, v.Type())
+		}
+
+		if v.Type() == safeWriterType {
+			st.evalSafeWriter(v, node, value)
+			return reflect.Value{}, true
+		}
+
+		ret, err := st.evalPipeCallExpression(v, node.CallArgs, &value)
+		if err != nil {
+			node.BaseExpr.error(err)
+		}
+		return ret, false
+	}
+}
+
+func compileArgs(exprs []Expression) []evalFunc {
+	if len(exprs) == 0 {
+		return nil
+	}
+	compiled := make([]evalFunc, len(exprs))
+	for i, expr := range exprs {
+		if expr.Type() != NodeUnderscore {
+			compiled[i] = compileExpression(expr)
+		}
+	}
+	return compiled
+}
+
+// compileExpression compiles an expression of the primary expression group, see evalPrimaryExpressionGroup().
+func compileExpression(node Expression) evalFunc {
+	switch node := node.(type) {
+	case *AdditiveExprNode:
+		right := compileExpression(node.Right)
+		if node.Left == nil {
+			return func(st *Runtime) reflect.Value {
+				return additive(node, reflect.Value{}, right(st))
+			}
+		}
+		left := compileExpression(node.Left)
+		return func(st *Runtime) reflect.Value {
+			return additive(node, left(st), right(st))
+		}
+	case *MultiplicativeExprNode:
+		left, right := compileExpression(node.Left), compileExpression(node.Right)
+		return func(st *Runtime) reflect.Value {
+			return multiplicative(node, left(st), right(st))
+		}
+	case *ComparativeExprNode:
+		left, right := compileExpression(node.Left), compileExpression(node.Right)
+		notEquals := node.Operator.typ == itemNotEquals
+		return func(st *Runtime) reflect.Value {
+			equal := checkEquality(left(st), right(st))
+			if notEquals {
+				return reflect.ValueOf(!equal)
+			}
+			return reflect.ValueOf(equal)
+		}
+	case *NumericComparativeExprNode:
+		left, right := compileExpression(node.Left), compileExpression(node.Right)
+		return func(st *Runtime) reflect.Value {
+			return numericComparative(node, left(st), right(st))
+		}
+	case *LogicalExprNode:
+		left, right := compileExpression(node.Left), compileExpression(node.Right)
+		if node.Operator.typ == itemAnd {
+			return func(st *Runtime) reflect.Value {
+				return reflect.ValueOf(isTrue(left(st)) && isTrue(right(st)))
+			}
+		}
+		return func(st *Runtime) reflect.Value {
+			return reflect.ValueOf(isTrue(left(st)) || isTrue(right(st)))
+		}
+	case *NotExprNode:
+		expr := compileExpression(node.Expr)
+		return func(st *Runtime) reflect.Value {
+			return reflect.ValueOf(!isTrue(expr(st)))
+		}
+	case *TernaryExprNode:
+		boolean, left, right := compileExpression(node.Boolean), compileExpression(node.Left), compileExpression(node.Right)
+		return func(st *Runtime) reflect.Value {
+			if isTrue(boolean(st)) {
+				return left(st)
+			}
+			return right(st)
+		}
+	case *CallExprNode:
+		base := compileBaseExpression(node.BaseExpr)
+		node.CallArgs.compiled = compileArgs(node.Exprs)
+		return func(st *Runtime) reflect.Value {
+			baseExpr := base(st)
+			if baseExpr.Kind() != reflect.Func {
+				node.errorf("node %q is not func kind %q", node.BaseExpr, baseExpr.Type())
+			}
+			ret, err := st.evalCallExpression(baseExpr, node.CallArgs)
+			if err != nil {
+				node.error(err)
+			}
+			return ret
+		}
+	case *IndexExprNode:
+		base, index := compileExpression(node.Base), compileExpression(node.Index)
+		return func(st *Runtime) reflect.Value {
+			resolved, err := resolveIndex(base(st), index(st), "")
+			if err != nil {
+				node.error(err)
+			}
+			return resolved
+		}
+	case *SliceExprNode:
+		base := compileExpression(node.Base)
+		index, endIndex := compileOptionalExpression(node.Index), compileOptionalExpression(node.EndIndex)
+		return func(st *Runtime) reflect.Value {
+			return slice(node, base(st), index(st), endIndex(st))
+		}
+	}
+	return compileBaseExpression(node)
+}
+
+// compileOptionalExpression compiles node, or returns a function returning the invalid reflect.Value if node is nil.
+func compileOptionalExpression(node Expression) evalFunc {
+	if node == nil {
+		return func(*Runtime) reflect.Value { return reflect.Value{} }
+	}
+	return compileExpression(node)
+}
+
+// compileBaseExpression compiles an expression of the base expression group, see evalBaseExpressionGroup().
+func compileBaseExpression(node Node) evalFunc {
+	switch node := node.(type) {
+	case *NilNode:
+		return constant(reflect.ValueOf(nil))
+	case *BoolNode:
+		if node.True {
+			return constant(valueBoolTRUE)
+		}
+		return constant(valueBoolFALSE)
+	case *StringNode:
+		return constant(reflect.ValueOf(&node.Text).Elem())
+	case *NumberNode:
+		switch {
+		case node.IsFloat:
+			return constant(reflect.ValueOf(&node.Float64).Elem())
+		case node.IsInt:
+			return constant(reflect.ValueOf(&node.Int64).Elem())
+		case node.IsUint:
+			return constant(reflect.ValueOf(&node.Uint64).Elem())
+		}
+	case *IdentifierNode:
+		if node.static {
+			return func(st *Runtime) reflect.Value {
+				return indirectEface(st.slotOf(node).value)
+			}
+		}
+		return func(st *Runtime) reflect.Value {
+			resolved, err := st.resolveIdentifier(node)
+			if err != nil {
+				node.error(err)
+			}
+			return resolved
+		}
+	case *FieldNode:
+		return func(st *Runtime) reflect.Value {
+			resolved := st.context
+			for i := 0; i < len(node.Ident); i++ {
+				field, err := resolveIndex(resolved, reflect.Value{}, node.Ident[i])
+				if err != nil {
+					node.errorf("%v", err)
+				}
+				if !field.IsValid() {
+					node.errorf("there is no field or method '%s' in %s (.%s)%s", node.Ident[i], getTypeString(resolved), strings.Join(node.Ident, "."), didYouMean(node.Ident[i], memberNames(resolved)))
+				}
+				resolved = field
+			}
+			return resolved
+		}
+	case *ChainNode:
+		base := compileExpression(node.Node)
+		return func(st *Runtime) reflect.Value {
+			resolved, err := resolveChain(node, base(st))
+			if err != nil {
+				node.error(err)
+			}
+			return resolved
+		}
+	}
+	// leave anything else (and its error reporting) to the interpreter
+	return func(st *Runtime) reflect.Value {
+		return st.evalBaseExpressionGroup(node)
+	}
+}
+
+func constant(v reflect.Value) evalFunc {
+	return func(*Runtime) reflect.Value {
+		return v
+	}
+}
@@ -91,23 +91,29 @@ func init() {
 				return hiddenFalse
 			}
 
-			a.runtime.newScope()
-			defer a.runtime.releaseScope()
+			// evaluate the context before pushing a scope, since variables were resolved to slots of the caller's scopes
+			c := a.runtime.context
+			context := c
+			if a.NumOfArguments() > 1 {
+				context = a.Get(1)
+			}
+
+			a.runtime.newScope(nil)
+			a.runtime.context = context
 
 			a.runtime.blocks = t.processedBlocks
 			root := t.Root
 			if t.extends != nil {
-				root = t.extends.Root
-			}
-
-			if a.NumOfArguments() > 1 {
-				c := a.runtime.context
-				defer func() { a.runtime.context = c }()
-				a.runtime.context = a.Get(1)
+				t = t.extends
+				root = t.Root
 			}
 
+			a.runtime.enterFrame(a.line(), t.Name, "")
 			a.runtime.executeList(root)
+			a.runtime.leaveFrame()
 
+			a.runtime.context = c
+			a.runtime.releaseScope()
 			return hiddenTrue
 		})),
 		"exec": reflect.ValueOf(Func(func(a Arguments) (result reflect.Value) {
@@ -117,8 +123,15 @@ func init() {
 				panic(fmt.Errorf("exec(%s, %v): %w", a.Get(0), a.Get(1), err))
 			}
 
-			a.runtime.newScope()
-			defer a.runtime.releaseScope()
+			// evaluate the context before pushing a scope, since variables were resolved to slots of the caller's scopes
+			c := a.runtime.context
+			context := c
+			if a.NumOfArguments() > 1 {
+				context = a.Get(1)
+			}
+
+			a.runtime.newScope(nil)
+			a.runtime.context = context
 
 			w := a.runtime.Writer
 			defer func() { a.runtime.Writer = w }()
@@ -127,16 +140,15 @@ func init() {
 			a.runtime.blocks = t.processedBlocks
 			root := t.Root
 			if t.extends != nil {
-				root = t.extends.Root
-			}
-
-			if a.NumOfArguments() > 1 {
-				c := a.runtime.context
-				defer func() { a.runtime.context = c }()
-				a.runtime.context = a.Get(1)
+				t = t.extends
+				root = t.Root
 			}
+			a.runtime.enterFrame(a.line(), t.Name, "")
 			result = a.runtime.executeList(root)
+			a.runtime.leaveFrame()
 
+			a.runtime.context = c
+			a.runtime.releaseScope()
 			return result
 		})),
 		"ints": reflect.ValueOf(Func(func(a Arguments) (result reflect.Value) {
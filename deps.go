@@ -0,0 +1,174 @@
+package jet
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// Dependencies returns the paths of the templates t depends on directly: the template it extends, the
+// templates it imports and the templates it includes by constant names like {{ include "footer.jet" }}, in
+// this order. Templates included by names computed while executing t aren't known in advance and are missing.
+func (t *Template) Dependencies() []string {
+	return append([]string(nil), t.dependencies...)
+}
+
+// findDependencies returns the paths of the templates t depends on, see Dependencies().
+func (t *Template) findDependencies() []string {
+	var dependencies []string
+	seen := map[string]bool{}
+	add := func(templatePath string) {
+		if !seen[templatePath] {
+			seen[templatePath] = true
+			dependencies = append(dependencies, templatePath)
+		}
+	}
+	if t.extends != nil {
+		add(t.extends.Name)
+	}
+	for _, _import := range t.imports {
+		add(_import.Name)
+	}
+	walk(t.Root, func(n Node) bool {
+		if include, ok := n.(*IncludeNode); ok {
+			if name, ok := include.Name.(*StringNode); ok {
+				add(t.set.resolveTemplatePath(name.Text, include.TemplatePath))
+			}
+		}
+		return true
+	})
+	return dependencies
+}
+
+// resolveTemplatePath returns the path of the template found at templatePath relative to siblingPath
+// (trying all extensions like getSiblingTemplate() does) without loading it. Only the Loader is asked, since
+// looking the template up in the cache could count as using it, or revalidate it. If no such template
+// exists, the absolute path without extension is returned.
+func (s *Set) resolveTemplatePath(templatePath, siblingPath string) string {
+	templatePath = s.SiblingTemplatePath(templatePath, siblingPath)
+	for _, extension := range s.extensions {
+		if s.loader.Exists(templatePath + extension) {
+			return templatePath + extension
+		}
+	}
+	return templatePath
+}
+
+// recordDependencies adds the dependencies of t, which was just cached, to the dependency graph of the Set,
+// replacing the dependencies of a template cached under the same name before.
+func (s *Set) recordDependencies(t *Template) {
+	s.depsMutex.Lock()
+	defer s.depsMutex.Unlock()
+	if s.deps == nil {
+		s.deps = map[string][]string{}
+	}
+	s.deps[t.Name] = t.dependencies
+}
+
+// forgetDependencies drops the template at templatePath, which was removed from the cache, from the dependency
+// graph of the Set.
+func (s *Set) forgetDependencies(templatePath string) {
+	s.depsMutex.Lock()
+	defer s.depsMutex.Unlock()
+	delete(s.deps, templatePath)
+}
+
+// Dependents returns the paths of the cached templates depending on the template at templatePath directly
+// or indirectly, i.e. the templates that are outdated once that template changes, in lexical order. The
+// path is looked up with all extensions of the Set, like GetTemplate() does, and in all layers of a Layered
+// Loader; templates depending on an included template are only known for includes with constant names (see
+// Template.Dependencies()).
+func (s *Set) Dependents(templatePath string) []string {
+	names := s.templateNames(templatePath)
+	s.depsMutex.Lock()
+	defer s.depsMutex.Unlock()
+	return s.dependents(names)
+}
+
+// dependents returns the dependents of the templates named by names. It must be called with depsMutex held.
+func (s *Set) dependents(names []string) []string {
+	reverse := map[string][]string{}
+	for name, dependencies := range s.deps {
+		for _, dependency := range dependencies {
+			reverse[dependency] = append(reverse[dependency], name)
+		}
+	}
+
+	found := map[string]bool{}
+	queue := append([]string(nil), names...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, dependent := range reverse[name] {
+			if !found[dependent] {
+				found[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	for _, name := range names {
+		// a template depending on itself (through an include) isn't its own dependent
+		delete(found, name)
+	}
+
+	dependents := make([]string, 0, len(found))
+	for name := range found {
+		dependents = append(dependents, name)
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// templateNames returns the names templatePath may refer to, one for each extension of the Set. With a
+// Layered Loader, the names of the templates they override in the lower layers (see Layered.Parent()) are
+// included, since the template at templatePath may have changed in any of the layers.
+func (s *Set) templateNames(templatePath string) []string {
+	templatePath = path.Join("/", filepath.ToSlash(templatePath))
+	names := make([]string, len(s.extensions))
+	for i, extension := range s.extensions {
+		names[i] = templatePath + extension
+	}
+	if layered, ok := s.loader.(Layered); ok {
+		seen := map[string]bool{}
+		for _, name := range names {
+			for parent, ok := layered.Parent(name); ok && !seen[parent]; parent, ok = layered.Parent(parent) {
+				seen[parent] = true
+				names = append(names, parent)
+			}
+		}
+	}
+	return names
+}
+
+// CanInvalidate reports whether Invalidate() can evict templates from the Set's cache, which is the case if the
+// Cache implements Evicter.
+func (s *Set) CanInvalidate() bool {
+	_, ok := s.cache.(Evicter)
+	return ok
+}
+
+// Invalidate evicts the template at templatePath and all templates depending on it (see Dependents())
+// from the Set's cache, so they are loaded and parsed again when they are used next. The path is looked up
+// with all extensions of the Set, like GetTemplate() does, and in all layers of a Layered Loader (see
+// Dependents()). Templates remembered as missing (see
+// WithNegativeCache()) are forgotten. The Set's Cache must implement Evicter.
+func (s *Set) Invalidate(templatePath string) error {
+	evicter, ok := s.cache.(Evicter)
+	if !ok {
+		return fmt.Errorf("jet: Invalidate() needs a Cache implementing Evicter, %T doesn't", s.cache)
+	}
+	names := s.templateNames(templatePath)
+	s.depsMutex.Lock()
+	names = append(names, s.dependents(names)...)
+	for _, name := range names {
+		delete(s.deps, name)
+	}
+	s.depsMutex.Unlock()
+
+	for _, name := range names {
+		evicter.Evict(name)
+	}
+	s.forgetMissing()
+	return nil
+}
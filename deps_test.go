@@ -0,0 +1,198 @@
+package jet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func newDepsTestLoader() *InMemLoader {
+	loader := NewInMemLoader()
+	loader.Set("/base.jet", `<html>{{ block body() }}{{ end }}{{ include "footer" }}</html>`)
+	loader.Set("/footer.jet", `footer`)
+	loader.Set("/macros.jet", `{{ block greet() }}Hello{{ end }}`)
+	loader.Set("/child.jet", `{{ extends "base.jet" }}{{ import "macros.jet" }}{{ block body() }}{{ yield greet() }}{{ include .Name }}{{ end }}`)
+	loader.Set("/grandchild.jet", `{{ extends "child.jet" }}`)
+	loader.Set("/other.jet", `{{ include "/footer.jet" }}`)
+	return loader
+}
+
+func TestDependencies(t *testing.T) {
+	set := NewSet(newDepsTestLoader())
+	tests := map[string][]string{
+		"/base.jet":       {"/footer.jet"},
+		"/footer.jet":     nil,
+		"/child.jet":      {"/base.jet", "/macros.jet"},
+		"/grandchild.jet": {"/child.jet"},
+	}
+	for templatePath, expected := range tests {
+		tt, err := set.GetTemplate(templatePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tt.Dependencies(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("dependencies of %s: expected %v, got %v", templatePath, expected, got)
+		}
+	}
+}
+
+// countingCache counts the lookups of templates it holds.
+type countingCache struct {
+	cache
+	hits int
+}
+
+func (c *countingCache) Get(templatePath string) *Template {
+	t := c.cache.Get(templatePath)
+	if t != nil {
+		c.hits++
+	}
+	return t
+}
+
+func TestDependenciesDontTouchCache(t *testing.T) {
+	cache := &countingCache{}
+	set := NewSet(newDepsTestLoader(), WithCache(cache))
+	if _, err := set.GetTemplate("/footer.jet"); err != nil {
+		t.Fatal(err)
+	}
+	before := cache.hits
+	// resolving the include of /footer.jet must not count as a use of the cached template
+	if _, err := set.GetTemplate("/other.jet"); err != nil {
+		t.Fatal(err)
+	}
+	if cache.hits != before {
+		t.Errorf("expected no cache hits finding the dependencies of /other.jet, got %d", cache.hits-before)
+	}
+}
+
+func TestDependenciesOfEvictedTemplates(t *testing.T) {
+	set := NewSet(newDepsTestLoader(), WithCache(NewLRUCache(WithMaxEntries(1))))
+	for _, templatePath := range []string{"/base.jet", "/footer.jet", "/macros.jet", "/other.jet"} {
+		if _, err := set.GetTemplate(templatePath); err != nil {
+			t.Fatal(err)
+		}
+		set.depsMutex.Lock()
+		n := len(set.deps)
+		set.depsMutex.Unlock()
+		if n > 1 {
+			t.Errorf("after loading %s: expected the dependencies of at most 1 template, got %d", templatePath, n)
+		}
+	}
+	if want := []string{"/other.jet"}; !reflect.DeepEqual(set.Dependents("/footer.jet"), want) {
+		t.Errorf("dependents of /footer.jet: expected %v, got %v", want, set.Dependents("/footer.jet"))
+	}
+
+	// templates too big to be cached aren't recorded either
+	set = NewSet(newDepsTestLoader(), WithCache(NewLRUCache(WithMaxBytes(1))))
+	if _, err := set.GetTemplate("/other.jet"); err != nil {
+		t.Fatal(err)
+	}
+	if got := set.Dependents("/footer.jet"); len(got) > 0 {
+		t.Errorf("dependents of /footer.jet: expected none, got %v", got)
+	}
+}
+
+func TestDependents(t *testing.T) {
+	set := NewSet(newDepsTestLoader())
+	for _, templatePath := range []string{"/grandchild.jet", "/other.jet"} {
+		if _, err := set.GetTemplate(templatePath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string][]string{
+		"/footer":         {"/base.jet", "/child.jet", "/grandchild.jet", "/other.jet"},
+		"base.jet":        {"/child.jet", "/grandchild.jet"},
+		"/macros.jet":     {"/child.jet", "/grandchild.jet"},
+		"/grandchild.jet": {},
+		"/unknown.jet":    {},
+	}
+	for templatePath, expected := range tests {
+		if got := set.Dependents(templatePath); !reflect.DeepEqual(got, expected) {
+			t.Errorf("dependents of %s: expected %v, got %v", templatePath, expected, got)
+		}
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	loader := newDepsTestLoader()
+	set := NewSet(loader)
+	templates := map[string]*Template{}
+	for _, templatePath := range []string{"/grandchild.jet", "/other.jet", "/macros.jet"} {
+		tt, err := set.GetTemplate(templatePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		templates[templatePath] = tt
+	}
+
+	loader.Set("/base.jet", `<html>changed{{ block body() }}{{ end }}</html>`)
+	if err := set.Invalidate("/base"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"/grandchild.jet": true,
+		"/other.jet":      false,
+		"/macros.jet":     false,
+	}
+	for templatePath, evicted := range tests {
+		tt, err := set.GetTemplate(templatePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tt != templates[templatePath]; got != evicted {
+			t.Errorf("%s: expected evicted %v, got %v", templatePath, evicted, got)
+		}
+	}
+
+	tt, _ := set.GetTemplate("/grandchild.jet")
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, nil, struct{ Name string }{"/footer.jet"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<html>changedHellofooter</html>"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	if want := []string{"/child.jet", "/grandchild.jet"}; !reflect.DeepEqual(set.Dependents("/macros.jet"), want) {
+		t.Errorf("dependents after invalidating: expected %v, got %v", want, set.Dependents("/macros.jet"))
+	}
+
+	if !set.CanInvalidate() {
+		t.Errorf("expected a Set with the default cache to be able to invalidate templates")
+	}
+	withCache := NewSet(loader, WithCache(struct{ Cache }{&cache{}}))
+	if withCache.CanInvalidate() {
+		t.Errorf("expected a Set with a cache that can't evict not to be able to invalidate templates")
+	}
+	if err := withCache.Invalidate("/base.jet"); err == nil {
+		t.Errorf("expected an error invalidating templates of a Set with a cache that can't evict")
+	}
+}
+
+func TestBundleDependencies(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewSet(newDepsTestLoader()).ExportBundle(&buf, "/grandchild.jet"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadBundle(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := NewSet(noLoader{}, WithBundle(b))
+	if want := []string{"/base.jet", "/child.jet", "/grandchild.jet"}; !reflect.DeepEqual(set.Dependents("/footer.jet"), want) {
+		t.Errorf("dependents: expected %v, got %v", want, set.Dependents("/footer.jet"))
+	}
+	if err := set.Invalidate("/footer.jet"); err != nil {
+		t.Fatal(err)
+	}
+	tt, err := set.GetTemplate("/macros.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string(nil); !reflect.DeepEqual(tt.Dependencies(), want) {
+		t.Errorf("dependencies: expected %v, got %v", want, tt.Dependencies())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 )
 
 // dumpAll returns
@@ -14,32 +15,39 @@ import (
 //  - everything in Runtime.blocks
 func dumpAll(a Arguments, depth int) reflect.Value {
 	var b bytes.Buffer
-	var vars VarMap
+	dumpRuntime(&b, a.runtime, depth)
+	return reflect.ValueOf(b.String())
+}
 
-	ctx := a.runtime.context
-	fmt.Fprintln(&b, "Context:")
-	fmt.Fprintf(&b, "\t%s %#v\n", ctx.Type(), ctx)
+// dumpRuntime prints the context, the variables in the current scope and up to depth parent scopes,
+// the globals, and the blocks of rnt.
+func dumpRuntime(w io.Writer, rnt *Runtime, depth int) {
+	ctx := rnt.context
+	fmt.Fprintln(w, "Context:")
+	if ctx.IsValid() {
+		fmt.Fprintf(w, "\t%s %#v\n", ctx.Type(), ctx)
+	} else {
+		fmt.Fprintln(w, "\t<nil>")
+	}
 
-	dumpScopeVars(&b, a.runtime.scope, 0)
-	dumpScopeVarsToDepth(&b, a.runtime.parent, depth)
+	dumpScopeVars(w, rnt.scope, 0)
+	dumpScopeVarsToDepth(w, rnt.parent, depth)
 
-	vars = a.runtime.set.globals
+	vars := rnt.set.loadGlobals()
 	for i, name := range vars.SortedKeys() {
 		if i == 0 {
-			fmt.Fprintln(&b, "Globals:")
+			fmt.Fprintln(w, "Globals:")
 		}
 		val := vars[name]
-		fmt.Fprintf(&b, "\t%s:=%#v // %s\n", name, val, val.Type())
+		fmt.Fprintf(w, "\t%s:=%#v // %s\n", name, val, val.Type())
 	}
 
-	blockKeys := a.runtime.scope.sortedBlocks()
-	fmt.Fprintln(&b, "Blocks:")
+	blockKeys := rnt.scope.sortedBlocks()
+	fmt.Fprintln(w, "Blocks:")
 	for _, k := range blockKeys {
-		block := a.runtime.blocks[k]
-		dumpBlock(&b, block)
+		block := rnt.blocks[k]
+		dumpBlock(w, block)
 	}
-
-	return reflect.ValueOf(b.String())
 }
 
 // dumpScopeVarsToDepth prints all variables in the scope, and all parent scopes,
@@ -64,9 +72,11 @@ func dumpScopeVars(w io.Writer, scope *scope, lvl int) {
 	} else {
 		fmt.Fprintf(w, "Variables in scope %d level(s) up:\n", lvl)
 	}
-	vars := scope.variables
-	for _, k := range vars.SortedKeys() {
-		fmt.Fprintf(w, "\t%s=%#v\n", k, vars[k])
+	names := scope.variableNames()
+	sort.Strings(names)
+	for _, k := range names {
+		v, _ := scope.lookup(k)
+		fmt.Fprintf(w, "\t%s=%#v\n", k, v)
 	}
 }
 
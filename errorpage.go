@@ -0,0 +1,203 @@
+package jet
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// errorPageContext is the number of source lines shown before and after the failing line on the error page.
+const errorPageContext = 5
+
+// RenderError writes an HTML page describing err to w. For Sets in development mode, the page shows, for every
+// template error found in err, the failing template source with the failing line highlighted, the template call
+// stack, the variables in scope at the time of the failure and the chain of templates extended and imported.
+// Outside of development mode, a generic error page without any details is written.
+func (s *Set) RenderError(w io.Writer, err error) error {
+	if !s.developmentMode {
+		return errorPageTemplate.Execute(w, errorPage{})
+	}
+	page := errorPage{Development: true}
+	var parseErrs ParseErrors
+	var e *Error
+	switch {
+	case errors.As(err, &parseErrs):
+		for _, e := range parseErrs {
+			page.Errors = append(page.Errors, newErrorPageEntry(e, e.Error()))
+		}
+	case errors.As(err, &e):
+		page.Errors = append(page.Errors, newErrorPageEntry(e, err.Error()))
+	case err != nil:
+		page.Errors = append(page.Errors, errorPageEntry{Message: err.Error()})
+	}
+	return errorPageTemplate.Execute(w, page)
+}
+
+// ErrorHandler returns an http.Handler responding with status 500 and the page written by RenderError().
+func (s *Set) ErrorHandler(err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		s.RenderError(w, err)
+	})
+}
+
+type errorPage struct {
+	Development bool
+	Errors      []errorPageEntry
+}
+
+type errorPageEntry struct {
+	Message      string
+	TemplatePath string
+	Line         int
+	Column       int
+	Source       []errorPageLine
+	Stack        []Frame
+	Vars         string
+	Chain        []errorPageChainEntry
+}
+
+// errorPageLine is a line of template source. The failing line is split around the failing column.
+type errorPageLine struct {
+	Number  int
+	Text    string
+	Failing bool
+	Before  string
+	At      string
+	After   string
+}
+
+// errorPageChainEntry is an entry in the chain of templates extended and imported by the template that failed.
+type errorPageChainEntry struct {
+	Path     string
+	Relation string // "extends" or "imports", empty for the template the chain starts from
+	Depth    int
+	Failing  bool // whether the error occurred in this template
+}
+
+func newErrorPageEntry(e *Error, message string) errorPageEntry {
+	entry := errorPageEntry{
+		Message:      message,
+		TemplatePath: e.TemplatePath,
+		Line:         e.Line,
+		Column:       e.Column,
+		Stack:        e.Stack,
+		Vars:         e.vars,
+	}
+
+	if e.source != "" && e.Line > 0 {
+		lines := strings.Split(e.source, "\n")
+		first, last := e.Line-errorPageContext, e.Line+errorPageContext
+		if first < 1 {
+			first = 1
+		}
+		if last > len(lines) {
+			last = len(lines)
+		}
+		for n := first; n <= last; n++ {
+			line := errorPageLine{Number: n, Text: strings.TrimRight(lines[n-1], "\r")}
+			if n == e.Line {
+				line.Failing = true
+				line.Before, line.At, line.After = splitAtColumn(line.Text, e.Column)
+			}
+			entry.Source = append(entry.Source, line)
+		}
+	}
+
+	var chain func(t *Template, relation string, depth int)
+	chain = func(t *Template, relation string, depth int) {
+		if t == nil {
+			return
+		}
+		entry.Chain = append(entry.Chain, errorPageChainEntry{Path: t.Name, Relation: relation, Depth: depth, Failing: t.Name == e.TemplatePath})
+		chain(t.extends, "extends", depth+1)
+		for _, _import := range t.imports {
+			chain(_import, "imports", depth+1)
+		}
+	}
+	chain(e.template, "", 0)
+
+	return entry
+}
+
+// splitAtColumn splits line into the text before the 1-based rune column, the rune at column, and the rest.
+func splitAtColumn(line string, column int) (before, at, after string) {
+	if column < 1 {
+		return "", "", line
+	}
+	i := 0
+	for n := 1; n < column && i < len(line); n++ {
+		_, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+	}
+	if i >= len(line) {
+		return line, "", ""
+	}
+	_, size := utf8.DecodeRuneInString(line[i:])
+	return line[:i], line[i : i+size], line[i+size:]
+}
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ if .Development }}Jet template error{{ else }}Internal Server Error{{ end }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { color: #b00; }
+section { margin-bottom: 3em; }
+pre { background: #f6f6f6; padding: 1em; overflow-x: auto; tab-size: 4; }
+.source span.line { display: block; }
+.source span.failing { background: #fdd; }
+.source span.number { display: inline-block; width: 3em; color: #999; user-select: none; }
+.source mark { background: #f66; color: #fff; }
+.message { font-family: monospace; font-size: 1.1em; white-space: pre-wrap; }
+.failing-template { font-weight: bold; color: #b00; }
+</style>
+</head>
+<body>
+{{- if not .Development }}
+<h1>Internal Server Error</h1>
+{{- else }}
+<h1>Jet template error</h1>
+{{- range .Errors }}
+<section>
+<p class="message">{{ .Message }}</p>
+{{- if .TemplatePath }}
+<h2>{{ .TemplatePath }}{{ if .Line }}:{{ .Line }}{{ if .Column }}:{{ .Column }}{{ end }}{{ end }}</h2>
+{{- end }}
+{{- if .Source }}
+<pre class="source">
+{{- range .Source }}<span class="line{{ if .Failing }} failing{{ end }}"><span class="number">{{ .Number }}</span>{{ if .Failing }}{{ .Before }}<mark>{{ .At }}</mark>{{ .After }}{{ else }}{{ .Text }}{{ end }}</span>{{ end -}}
+</pre>
+{{- end }}
+{{- if .Stack }}
+<h3>Call stack</h3>
+<ol class="stack">
+{{- range .Stack }}
+<li>{{ . }}</li>
+{{- end }}
+</ol>
+{{- end }}
+{{- if .Vars }}
+<h3>Variables in scope</h3>
+<pre class="vars">{{ .Vars }}</pre>
+{{- end }}
+{{- if .Chain }}
+<h3>Templates extended and imported</h3>
+<ul class="chain">
+{{- range .Chain }}
+<li style="margin-left: {{ .Depth }}em"{{ if .Failing }} class="failing-template"{{ end }}>{{ if .Relation }}{{ .Relation }} {{ end }}{{ .Path }}</li>
+{{- end }}
+</ul>
+{{- end }}
+</section>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
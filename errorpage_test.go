@@ -0,0 +1,76 @@
+package jet
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderError(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/base.jet", "<html>{{ block body() }}{{ end }}</html>")
+	loader.Set("/lib.jet", "{{ block card(title) }}<div>{{ title }}</div>{{ end }}")
+	loader.Set("/page.jet", "{{ extends \"/base.jet\" }}\n{{ import \"/lib.jet\" }}\n{{ block body() }}\n{{ user := \"<b>jet</b>\" }}\n<p>{{ user.Nmae }}</p>\n{{ end }}")
+	set := NewSet(loader, InDevelopmentMode())
+
+	tt, err := set.GetTemplate("/page.jet")
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	err = tt.Execute(ioutil.Discard, nil, nil)
+	if err == nil {
+		t.Fatal("expected execution to fail")
+	}
+
+	var b bytes.Buffer
+	if err := set.RenderError(&b, err); err != nil {
+		t.Fatalf("rendering error page: %v", err)
+	}
+	page := b.String()
+	for _, expected := range []string{
+		`<h2>/page.jet:5:`,
+		`<span class="line failing"><span class="number">5</span>&lt;p&gt;{{ user<mark>.</mark>Nmae }}&lt;/p&gt;</span>`, // source with the failing node highlighted
+		`<li>/page.jet:5 (block body)</li>`,       // call stack
+		`user=&#34;&lt;b&gt;jet&lt;/b&gt;&#34;`,   // variables in scope, escaped
+		`class="failing-template">/page.jet</li>`, // extends/imports chain
+		`>extends /base.jet</li>`,
+		`>imports /lib.jet</li>`,
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected error page to contain %q, got:\n%s", expected, page)
+		}
+	}
+
+	// all errors are listed when parsing with error recovery
+	set = NewSet(loader, InDevelopmentMode(), WithParseErrorRecovery())
+	_, err = set.Parse("/broken.jet", "{{ if }}{{ end }}\n{{ range }}{{ end }}")
+	var parseErrs ParseErrors
+	if !errors.As(err, &parseErrs) {
+		t.Fatalf("expected ParseErrors, got %T: %v", err, err)
+	}
+	b.Reset()
+	set.RenderError(&b, err)
+	if n := strings.Count(b.String(), "<section>"); n != len(parseErrs) {
+		t.Errorf("expected %d errors on the page, got %d", len(parseErrs), n)
+	}
+}
+
+func TestErrorHandlerOutsideDevelopmentMode(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/secret.jet", "{{ password := \"hunter2\" }}{{ missing }}")
+	set := NewSet(loader)
+	tt, _ := set.GetTemplate("/secret.jet")
+	err := tt.Execute(ioutil.Discard, nil, nil)
+
+	rec := httptest.NewRecorder()
+	set.ErrorHandler(err).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 500 {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "secret.jet") || strings.Contains(body, "hunter2") {
+		t.Errorf("error page leaks details outside of development mode:\n%s", body)
+	}
+}
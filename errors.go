@@ -0,0 +1,152 @@
+package jet
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error is returned (possibly wrapped) for parse and execution failures that can be attributed to a position
+// in a template's source. Use errors.As() to retrieve it from an error returned by the Set or by Template.Execute().
+type Error struct {
+	TemplatePath string  // path of the template the error occurred in
+	Line         int     // 1-based line number, 0 if unknown
+	Column       int     // 1-based column (in runes), 0 if unknown
+	Pos          Pos     // byte offset into the template's source
+	Node         Node    // node that failed to execute; nil for parse errors
+	Err          error   // underlying cause
+	Excerpt      string  // the offending source line and a caret pointing at Column; empty if unknown
+	Stack        []Frame // template call stack leading to an execution failure, outermost frame first
+
+	runtime  bool      // whether the error occurred while executing rather than parsing
+	base     *NodeBase // base of the failing node, used to look up Node
+	source   string    // text of the template the error occurred in, for the error page
+	template *Template // template being parsed or executed, for the error page's extends/imports chain
+	vars     string    // dump of the runtime state at the time of the error, in development mode only
+}
+
+func (e *Error) Error() string {
+	if e.runtime {
+		if len(e.Stack) > 1 {
+			return fmt.Sprintf("Jet Runtime Error (%q:%d): %s (trace: %s)", e.TemplatePath, e.Line, e.Err, e.Trace())
+		}
+		return fmt.Sprintf("Jet Runtime Error (%q:%d): %s", e.TemplatePath, e.Line, e.Err)
+	}
+	return fmt.Sprintf("template: %s:%d: %s", e.TemplatePath, e.Line, e.Err)
+}
+
+// Trace formats the template call stack leading to the error, e.g. `/layouts/app.jet:12 > /partials/nav.jet:4 (block menu)`.
+// It returns an empty string if no call stack was recorded.
+func (e *Error) Trace() string {
+	frames := make([]string, len(e.Stack))
+	for i, f := range e.Stack {
+		frames[i] = f.String()
+	}
+	return strings.Join(frames, " > ")
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsRuntime reports whether the error occurred while executing a template (as opposed to while parsing it).
+func (e *Error) IsRuntime() bool {
+	return e.runtime
+}
+
+// locate fills in the line (if unknown), column and source excerpt using the text the template was parsed from.
+func (e *Error) locate(text string) {
+	if int(e.Pos) > len(text) {
+		return
+	}
+	e.source = text
+	lineStart := strings.LastIndexByte(text[:e.Pos], '\n') + 1
+	lineEnd := strings.IndexByte(text[lineStart:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(text)
+	} else {
+		lineEnd += lineStart
+	}
+	if e.Line == 0 {
+		e.Line = 1 + strings.Count(text[:lineStart], "\n")
+	}
+	e.Column = 1 + utf8.RuneCountInString(text[lineStart:e.Pos])
+
+	line := strings.TrimRight(text[lineStart:lineEnd], "\r")
+	// keep tabs in the caret line so the caret lines up with the source line
+	caret := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, text[lineStart:e.Pos])
+	e.Excerpt = fmt.Sprintf("%d | %s\n%s | %s^", e.Line, line, strings.Repeat(" ", len(fmt.Sprint(e.Line))), caret)
+}
+
+// annotate completes err if it is an *Error that occurred while executing t or one of the templates t extends or imports.
+func (t *Template) annotate(err error) {
+	e, ok := err.(*Error)
+	if !ok || e.Excerpt != "" {
+		return
+	}
+	e.template = t
+	src := t.lookup(e.TemplatePath)
+	if src == nil {
+		if t.set == nil {
+			return
+		}
+		if src = t.set.cache.Get(e.TemplatePath); src == nil {
+			return
+		}
+	}
+	e.locate(src.text)
+	if e.Node == nil && e.base != nil {
+		walk(src.Root, func(n Node) bool {
+			if n.base() == e.base {
+				e.Node = n
+			}
+			return e.Node == nil
+		})
+	}
+}
+
+// lookup finds the template parsed from templatePath among t and the templates it extends or imports.
+func (t *Template) lookup(templatePath string) *Template {
+	if t == nil {
+		return nil
+	}
+	if t.Name == templatePath {
+		return t
+	}
+	if found := t.extends.lookup(templatePath); found != nil {
+		return found
+	}
+	for _, _import := range t.imports {
+		if found := _import.lookup(templatePath); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// ParseErrors is the error returned when parsing a template fails on a Set using WithParseErrorRecovery().
+// It holds all syntax errors found in the template, in source order.
+type ParseErrors []*Error
+
+func (errs ParseErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the individual errors, making them available to errors.Is() and errors.As().
+func (errs ParseErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+	for i, err := range errs {
+		unwrapped[i] = err
+	}
+	return unwrapped
+}
@@ -0,0 +1,117 @@
+package jet
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseErrorDetails(t *testing.T) {
+	set := NewSet(NewInMemLoader())
+	_, err := set.Parse("/broken.jet", "first line\n  {{ if }}")
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if e.IsRuntime() {
+		t.Errorf("parse error reported as runtime error")
+	}
+	if e.TemplatePath != "/broken.jet" || e.Line != 2 || e.Column != 9 {
+		t.Errorf("unexpected location %s:%d:%d", e.TemplatePath, e.Line, e.Column)
+	}
+	expected := "2 |   {{ if }}\n  |         ^"
+	if e.Excerpt != expected {
+		t.Errorf("expected excerpt\n%s\ngot\n%s", expected, e.Excerpt)
+	}
+}
+
+func TestRuntimeErrorDetails(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/base.jet", "{{ block main() }}{{ end }}")
+	loader.Set("/page.jet", "{{ extends \"base.jet\" }}\n{{ block main() }}\n\t<p>{{ 1 + missing }}</p>\n{{ end }}")
+	set := NewSet(loader)
+
+	tt, err := set.GetTemplate("/page.jet")
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	err = tt.Execute(ioutil.Discard, nil, nil)
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if !e.IsRuntime() {
+		t.Errorf("runtime error reported as parse error")
+	}
+	if e.TemplatePath != "/page.jet" || e.Line != 3 || e.Column != 12 {
+		t.Errorf("unexpected location %s:%d:%d", e.TemplatePath, e.Line, e.Column)
+	}
+	if e.Node == nil || e.Node.String() != "missing" {
+		t.Errorf("expected failing node 'missing', got %v", e.Node)
+	}
+	expected := "3 | \t<p>{{ 1 + missing }}</p>\n  | \t          ^"
+	if e.Excerpt != expected {
+		t.Errorf("expected excerpt\n%s\ngot\n%s", expected, e.Excerpt)
+	}
+}
+
+func TestRuntimeErrorTrace(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/layouts/app.jet", "<body>\n{{ include \"/partials/nav.jet\" }}\n</body>")
+	loader.Set("/partials/nav.jet", "{{ import \"/partials/lib.jet\" }}\n<nav>\n{{ yield menu() }}\n</nav>")
+	loader.Set("/partials/lib.jet", "{{ block menu() }}\n<ul>\n{{ .Items }}</ul>\n{{ end }}")
+	set := NewSet(loader)
+
+	tt, err := set.GetTemplate("/layouts/app.jet")
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	err = tt.Execute(ioutil.Discard, nil, nil)
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	expected := "/layouts/app.jet:2 > /partials/nav.jet:3 > /partials/lib.jet:3 (block menu)"
+	if trace := e.Trace(); trace != expected {
+		t.Errorf("expected trace %q, got %q", expected, trace)
+	}
+
+	// a failure caught by try/catch must not leave stale frames behind
+	loader.Set("/caught.jet", "{{ try }}{{ include \"/partials/nav.jet\" }}{{ catch }}caught{{ end }}\n{{ 1 + missing }}")
+	tt, err = set.GetTemplate("/caught.jet")
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	err = tt.Execute(ioutil.Discard, nil, nil)
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if trace := e.Trace(); trace != "/caught.jet:2" {
+		t.Errorf("expected trace %q, got %q", "/caught.jet:2", trace)
+	}
+}
+
+func TestCompiledRuntimeErrorDetails(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/page.jet", "{{ range i := ints(0, 3) }}\n{{ i * .Factor }}\n{{ end }}")
+	set := NewSet(loader, WithCompilation())
+
+	tt, err := set.GetTemplate("/page.jet")
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	err = tt.Execute(ioutil.Discard, nil, map[string]int{})
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if e.TemplatePath != "/page.jet" || e.Line != 2 {
+		t.Errorf("unexpected location %s:%d", e.TemplatePath, e.Line)
+	}
+	if e.Node == nil || e.Node.String() != ".Factor" {
+		t.Errorf("expected failing node '.Factor', got %v", e.Node)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"runtime"
 	"sort"
@@ -35,6 +36,8 @@ var (
 	rangerType     = reflect.TypeOf((*Ranger)(nil)).Elem()
 	rendererType   = reflect.TypeOf((*Renderer)(nil)).Elem()
 	safeWriterType = reflect.TypeOf(SafeWriter(nil))
+	boolType       = reflect.TypeOf(false)
+	float64Type    = reflect.TypeOf(float64(0))
 	pool_State     = sync.Pool{
 		New: func() interface{} {
 			return &Runtime{scope: &scope{}, escapeeWriter: new(escapeeWriter)}
@@ -78,6 +81,68 @@ type Runtime struct {
 	content func(*Runtime, Expression)
 
 	context reflect.Value
+	frames  []Frame // template call stack
+	free    *scope  // released scopes for reuse, linked through their parent field
+}
+
+// Frame is an entry in the template call stack of a Runtime: a template (or a block in it) entered through
+// Template.Execute(), an include, a yield, or the includeIfExists/exec builtins.
+type Frame struct {
+	TemplatePath string // path of the template being executed
+	Block        string // name of the block being executed, if any
+	Line         int    // line the next frame was entered from, or the line the error occurred on for the innermost frame
+}
+
+func (f Frame) String() string {
+	if f.Block != "" {
+		return fmt.Sprintf("%s:%d (block %s)", f.TemplatePath, f.Line, f.Block)
+	}
+	return fmt.Sprintf("%s:%d", f.TemplatePath, f.Line)
+}
+
+// enterFrame pushes a new frame onto the call stack, recording the line the current frame is left from.
+func (st *Runtime) enterFrame(callLine int, templatePath, block string) {
+	if n := len(st.frames); n > 0 {
+		st.frames[n-1].Line = callLine
+	}
+	st.frames = append(st.frames, Frame{TemplatePath: templatePath, Block: block})
+}
+
+// leaveFrame pops the innermost frame off the call stack. It is deliberately not deferred by callers, so
+// the stack is still intact when a panic reaches recover().
+func (st *Runtime) leaveFrame() {
+	st.frames = st.frames[:len(st.frames)-1]
+}
+
+// savedState is a snapshot of a Runtime's scope, context and call stack depth.
+type savedState struct {
+	scope   *scope
+	context reflect.Value
+	depth   int
+}
+
+// save takes a snapshot to restore() after recovering from a panic. Scopes, contexts and frames are
+// released without defer, so they have to be unwound explicitly when execution continues after a panic.
+func (st *Runtime) save() savedState {
+	return savedState{scope: st.scope, context: st.context, depth: len(st.frames)}
+}
+
+func (st *Runtime) restore(s savedState) {
+	st.scope = s.scope
+	st.context = s.context
+	st.frames = st.frames[:s.depth]
+}
+
+// stack returns a copy of the call stack leading to e.
+func (st *Runtime) stack(e *Error) []Frame {
+	stack := make([]Frame, len(st.frames), len(st.frames)+1)
+	copy(stack, st.frames)
+	if n := len(stack); n > 0 && stack[n-1].TemplatePath == e.TemplatePath {
+		stack[n-1].Line = e.Line
+	} else {
+		stack = append(stack, Frame{TemplatePath: e.TemplatePath, Line: e.Line})
+	}
+	return stack
 }
 
 // Context returns the current context value
@@ -85,17 +150,47 @@ func (r *Runtime) Context() reflect.Value {
 	return r.context
 }
 
-func (st *Runtime) newScope() {
-	st.scope = &scope{parent: st.scope, variables: make(VarMap), blocks: st.blocks}
+// newScope pushes a new scope with a slot for each of names, the variables the template declares in it
+// (see resolveVariables()). Scopes are recycled by releaseScope(), so pushing one usually doesn't allocate.
+func (st *Runtime) newScope(names []string) {
+	sc := st.free
+	if sc != nil {
+		st.free = sc.parent
+	} else {
+		sc = &scope{}
+	}
+	sc.parent = st.scope
+	sc.blocks = st.blocks
+	sc.names = names
+	if cap(sc.slots) >= len(names) {
+		sc.slots = sc.slots[:len(names)]
+	} else {
+		sc.slots = make([]slot, len(names))
+	}
+	st.scope = sc
 }
 
+// releaseScope pops the current scope and keeps it for reuse by newScope().
 func (st *Runtime) releaseScope() {
-	st.scope = st.scope.parent
+	sc := st.scope
+	st.scope = sc.parent
+
+	for i := range sc.slots {
+		sc.slots[i] = slot{}
+	}
+	for name := range sc.variables {
+		delete(sc.variables, name)
+	}
+	sc.names, sc.blocks = nil, nil
+	sc.parent = st.free
+	st.free = sc
 }
 
 type scope struct {
 	parent    *scope
-	variables VarMap
+	variables VarMap   // variables declared at runtime (passed to Execute(), block parameters, Runtime.Let(), ...), allocated on first use
+	names     []string // names of the variables declared in the template source, by slot
+	slots     []slot   // values of the variables in names
 	blocks    map[string]*BlockNode
 }
 
@@ -113,7 +208,7 @@ func (st *Runtime) YieldBlock(name string, context interface{}) {
 	block, has := st.getBlock(name)
 
 	if has == false {
-		panic(fmt.Errorf("Block %q was not found!!", name))
+		panic(fmt.Errorf("Block %q was not found!!%s", name, didYouMean(name, st.scope.blockNames())))
 	}
 
 	if context != nil {
@@ -137,13 +232,10 @@ func (st *scope) getBlock(name string) (block *BlockNode, has bool) {
 
 func (state *Runtime) setValue(name string, val reflect.Value) error {
 	// try changing existing variable in current or parent scope
-	sc := state.scope
-	for sc != nil {
-		if _, ok := sc.variables[name]; ok {
-			sc.variables[name] = val
+	for sc := state.scope; sc != nil; sc = sc.parent {
+		if sc.assign(name, val) {
 			return nil
 		}
-		sc = sc.parent
 	}
 
 	return fmt.Errorf("could not assign %q = %v because variable %q is uninitialised", name, val, name)
@@ -153,12 +245,12 @@ func (state *Runtime) setValue(name string, val reflect.Value) error {
 func (state *Runtime) LetGlobal(name string, val interface{}) {
 	sc := state.scope
 
-	// walk up to top-most valid scope
-	for sc.parent != nil && sc.parent.variables != nil {
+	// walk up to top-most scope
+	for sc.parent != nil {
 		sc = sc.parent
 	}
 
-	sc.variables[name] = reflect.ValueOf(val)
+	sc.let(name, reflect.ValueOf(val))
 }
 
 // Set sets an existing variable in the template scope it lives in.
@@ -168,7 +260,7 @@ func (state *Runtime) Set(name string, val interface{}) error {
 
 // Let initialises a variable in the current template scope (possibly shadowing an existing variable of the same name in a parent scope).
 func (state *Runtime) Let(name string, val interface{}) {
-	state.scope.variables[name] = reflect.ValueOf(val)
+	state.scope.let(name, reflect.ValueOf(val))
 }
 
 // SetOrLet calls Set() (if a variable with the given name is visible from the current scope) or Let() (if there is no variable with the given name in the current or any parent scope).
@@ -188,19 +280,14 @@ func (state *Runtime) resolve(name string) (reflect.Value, error) {
 	}
 
 	// try current, then parent variable scopes
-	sc := state.scope
-	for sc != nil {
-		v, ok := sc.variables[name]
-		if ok {
+	for sc := state.scope; sc != nil; sc = sc.parent {
+		if v, ok := sc.lookup(name); ok {
 			return indirectEface(v), nil
 		}
-		sc = sc.parent
 	}
 
 	// try globals
-	state.set.gmx.RLock()
-	v, ok := state.set.globals[name]
-	state.set.gmx.RUnlock()
+	v, ok := state.set.loadGlobals()[name]
 	if ok {
 		return indirectEface(v), nil
 	}
@@ -211,7 +298,18 @@ func (state *Runtime) resolve(name string) (reflect.Value, error) {
 		return indirectEface(v), nil
 	}
 
-	return reflect.Value{}, fmt.Errorf("identifier %q not available in current (%+v) or parent scope, global, or default variables", name, state.scope.variables)
+	return reflect.Value{}, fmt.Errorf("identifier %q not available in current or parent scope, global, or default variables%s", name, didYouMean(name, state.identifierNames()))
+}
+
+// resolveIdentifier resolves an identifier that isn't a variable declared in the template source. Identifiers
+// referring to a constant of the Set (see markConstants()) resolve to the constant before any variable.
+func (state *Runtime) resolveIdentifier(node *IdentifierNode) (reflect.Value, error) {
+	if node.constant {
+		if v, ok := state.set.loadGlobals()[node.Ident]; ok {
+			return indirectEface(v), nil
+		}
+	}
+	return state.resolve(node.Ident)
 }
 
 // Resolve calls resolve() and ignores any errors, meaning it may return a zero reflect.Value.
@@ -230,11 +328,22 @@ func (state *Runtime) MustResolve(name string) reflect.Value {
 }
 
 func (st *Runtime) recover(err *error) {
-	// reset state scope and context just to be safe (they might not be cleared properly if there was a panic while using the state)
+	recovered := recover()
+	if e, ok := recovered.(*Error); ok && e.runtime && e.Stack == nil {
+		e.Stack = st.stack(e)
+		if st.set.developmentMode {
+			// scopes are released without defer, so this still sees the variables at the point of failure
+			var b bytes.Buffer
+			dumpRuntime(&b, st, math.MaxInt32)
+			e.vars = b.String()
+		}
+	}
+	// reset state scope, context and call stack just to be safe (they might not be cleared properly if there was a panic while using the state)
 	st.scope = &scope{}
 	st.context = reflect.Value{}
+	st.frames = st.frames[:0]
 	pool_State.Put(st)
-	if recovered := recover(); recovered != nil {
+	if recovered != nil {
 		var ok bool
 		if _, ok = recovered.(runtime.Error); ok {
 			panic(recovered)
@@ -249,6 +358,10 @@ func (st *Runtime) recover(err *error) {
 func (st *Runtime) executeSet(left Expression, right reflect.Value) {
 	typ := left.Type()
 	if typ == NodeIdentifier {
+		if ident := left.(*IdentifierNode); ident.static {
+			st.slotOf(ident).value = right
+			return
+		}
 		err := st.setValue(left.(*IdentifierNode).Ident, right)
 		if err != nil {
 			left.error(err)
@@ -280,11 +393,11 @@ RESTART:
 		value = value.Elem()
 		goto RESTART
 	case reflect.Struct:
-		value = value.FieldByName(fields[lef])
-		if !value.IsValid() {
-			left.errorf("identifier %q is not available in the current scope", fields[lef])
+		m := membersOf(value.Type())[fields[lef]]
+		if m.field == nil {
+			left.errorf("identifier %q is not available in the current scope%s", fields[lef], didYouMean(fields[lef], memberNames(value)))
 		}
-		value.Set(right)
+		value.FieldByIndex(m.field).Set(right)
 	case reflect.Map:
 		value.SetMapIndex(reflect.ValueOf(&fields[lef]).Elem(), right)
 	}
@@ -317,30 +430,31 @@ func (st *Runtime) executeLetList(set *SetNode) {
 	if set.IndexExprGetLookup {
 		value := st.evalPrimaryExpressionGroup(set.Right[0])
 		if set.Left[0].Type() != NodeUnderscore {
-			st.variables[set.Left[0].(*IdentifierNode).Ident] = value
+			st.letIdent(set.Left[0], value)
 		}
 		if set.Left[1].Type() != NodeUnderscore {
 			if value.IsValid() {
-				st.variables[set.Left[1].(*IdentifierNode).Ident] = valueBoolTRUE
+				st.letIdent(set.Left[1], valueBoolTRUE)
 			} else {
-				st.variables[set.Left[1].(*IdentifierNode).Ident] = valueBoolFALSE
+				st.letIdent(set.Left[1], valueBoolFALSE)
 			}
 		}
 	} else {
 		for i := 0; i < len(set.Left); i++ {
 			value := st.evalPrimaryExpressionGroup(set.Right[i])
 			if set.Left[i].Type() != NodeUnderscore {
-				st.variables[set.Left[i].(*IdentifierNode).Ident] = value
+				st.letIdent(set.Left[i], value)
 			}
 		}
 	}
 }
 
-func (st *Runtime) executeYieldBlock(block *BlockNode, blockParam, yieldParam *BlockParameterList, expression Expression, content *ListNode) {
+func (st *Runtime) executeYieldBlock(line int, block *BlockNode, blockParam, yieldParam *BlockParameterList, expression Expression, content *ListNode) {
+	st.enterFrame(line, block.TemplatePath, block.Name)
 
 	needNewScope := len(blockParam.List) > 0 || len(yieldParam.List) > 0
 	if needNewScope {
-		st.newScope()
+		st.newScope(nil)
 		for i := 0; i < len(yieldParam.List); i++ {
 			p := &yieldParam.List[i]
 
@@ -348,15 +462,15 @@ func (st *Runtime) executeYieldBlock(block *BlockNode, blockParam, yieldParam *B
 				block.errorf("missing name for block parameter '%s'", blockParam.List[i].Identifier)
 			}
 
-			st.variables[p.Identifier] = st.evalPrimaryExpressionGroup(p.Expression)
+			st.scope.let(p.Identifier, st.evalPrimaryExpressionGroup(p.Expression))
 		}
 		for i := 0; i < len(blockParam.List); i++ {
 			p := &blockParam.List[i]
-			if _, found := st.variables[p.Identifier]; !found {
+			if _, found := st.scope.lookup(p.Identifier); !found {
 				if p.Expression == nil {
-					st.variables[p.Identifier] = valueBoolFALSE
+					st.scope.let(p.Identifier, valueBoolFALSE)
 				} else {
-					st.variables[p.Identifier] = st.evalPrimaryExpressionGroup(p.Expression)
+					st.scope.let(p.Identifier, st.evalPrimaryExpressionGroup(p.Expression))
 				}
 			}
 		}
@@ -371,6 +485,7 @@ func (st *Runtime) executeYieldBlock(block *BlockNode, blockParam, yieldParam *B
 
 			st.scope = myscope
 			st.content = mycontent
+			st.enterFrame(st.frames[len(st.frames)-1].Line, content.TemplatePath, "")
 
 			if expression != nil {
 				context := st.context
@@ -381,6 +496,7 @@ func (st *Runtime) executeYieldBlock(block *BlockNode, blockParam, yieldParam *B
 				st.executeList(content)
 			}
 
+			st.leaveFrame()
 			st.scope = outscope
 			st.content = outcontent
 		}
@@ -399,9 +515,13 @@ func (st *Runtime) executeYieldBlock(block *BlockNode, blockParam, yieldParam *B
 	if needNewScope {
 		st.releaseScope()
 	}
+	st.leaveFrame()
 }
 
 func (st *Runtime) executeList(list *ListNode) (returnValue reflect.Value) {
+	if list.exec != nil {
+		return list.exec(st)
+	}
 	inNewScope := false // to use just one scope for multiple actions with variable declarations
 
 	for i := 0; i < len(list.Nodes); i++ {
@@ -419,9 +539,8 @@ func (st *Runtime) executeList(list *ListNode) (returnValue reflect.Value) {
 			if node.Set != nil {
 				if node.Set.Let {
 					if !inNewScope {
-						st.newScope()
+						st.newScope(list.vars)
 						inNewScope = true
-						defer st.releaseScope()
 					}
 					st.executeLetList(node.Set)
 				} else {
@@ -447,7 +566,7 @@ func (st *Runtime) executeList(list *ListNode) (returnValue reflect.Value) {
 			if node.Set != nil {
 				if node.Set.Let {
 					isLet = true
-					st.newScope()
+					st.newScope(node.vars)
 					st.executeLetList(node.Set)
 				} else {
 					st.executeSetList(node.Set)
@@ -480,7 +599,7 @@ func (st *Runtime) executeList(list *ListNode) (returnValue reflect.Value) {
 				expression = st.evalPrimaryExpressionGroup(node.Set.Right[0])
 				if node.Set.Let {
 					isLet = true
-					st.newScope()
+					st.newScope(node.vars)
 				}
 			} else {
 				expression = st.evalPrimaryExpressionGroup(node.Expression)
@@ -505,10 +624,10 @@ func (st *Runtime) executeList(list *ListNode) (returnValue reflect.Value) {
 					if isSet {
 						if isLet {
 							if keyVarSlot >= 0 {
-								st.variables[node.Set.Left[keyVarSlot].String()] = indexValue
+								st.letIdent(node.Set.Left[keyVarSlot], indexValue)
 							}
 							if valVarSlot >= 0 {
-								st.variables[node.Set.Left[valVarSlot].String()] = rangeValue
+								st.letIdent(node.Set.Left[valVarSlot], rangeValue)
 							}
 						} else {
 							if keyVarSlot >= 0 {
@@ -540,14 +659,15 @@ func (st *Runtime) executeList(list *ListNode) (returnValue reflect.Value) {
 			node := node.(*YieldNode)
 			if node.IsContent {
 				if st.content != nil {
+					st.frames[len(st.frames)-1].Line = node.Line
 					st.content(st, node.Expression)
 				}
 			} else {
 				block, has := st.getBlock(node.Name)
 				if has == false || block == nil {
-					node.errorf("unresolved block %q!!", node.Name)
+					node.errorf("unresolved block %q!!%s", node.Name, didYouMean(node.Name, st.scope.blockNames()))
 				}
-				st.executeYieldBlock(block, block.Parameters, node.Parameters, node.Expression, node.Content)
+				st.executeYieldBlock(node.Line, block, block.Parameters, node.Parameters, node.Expression, node.Content)
 			}
 		case NodeBlock:
 			node := node.(*BlockNode)
@@ -555,7 +675,7 @@ func (st *Runtime) executeList(list *ListNode) (returnValue reflect.Value) {
 			if has == false {
 				block = node
 			}
-			st.executeYieldBlock(block, block.Parameters, block.Parameters, block.Expression, block.Content)
+			st.executeYieldBlock(node.Line, block, block.Parameters, block.Parameters, block.Expression, block.Content)
 		case NodeInclude:
 			node := node.(*IncludeNode)
 			returnValue = st.executeInclude(node)
@@ -565,12 +685,17 @@ func (st *Runtime) executeList(list *ListNode) (returnValue reflect.Value) {
 		}
 	}
 
+	// not deferred, so the variables are still in scope when a panic reaches recover()
+	if inNewScope {
+		st.releaseScope()
+	}
 	return returnValue
 }
 
 func (st *Runtime) executeTry(try *TryNode) (returnValue reflect.Value) {
 	writer := st.Writer
 	buf := new(bytes.Buffer)
+	saved := st.save()
 
 	defer func() {
 		r := recover()
@@ -579,11 +704,13 @@ func (st *Runtime) executeTry(try *TryNode) (returnValue reflect.Value) {
 		if r == nil {
 			io.Copy(writer, buf)
 		} else {
+			// unwind scope, context and call stack to where they were when entering the try block
+			st.restore(saved)
 			// st.Writer is already set to its original value since the later defer ran first
 			if try.Catch != nil {
 				if try.Catch.Err != nil {
-					st.newScope()
-					st.scope.variables[try.Catch.Err.Ident] = reflect.ValueOf(r)
+					st.newScope(try.Catch.vars)
+					st.letIdent(try.Catch.Err, reflect.ValueOf(r))
 				}
 				if try.Catch.List != nil {
 					returnValue = st.executeList(try.Catch.List)
@@ -621,15 +748,11 @@ func (st *Runtime) executeInclude(node *IncludeNode) (returnValue reflect.Value)
 		return reflect.Value{}
 	}
 
-	st.newScope()
-	defer st.releaseScope()
-
+	st.newScope(nil)
 	st.blocks = t.processedBlocks
 
-	var context reflect.Value
+	context := st.context
 	if node.Context != nil {
-		context = st.context
-		defer func() { st.context = context }()
 		st.context = st.evalPrimaryExpressionGroup(node.Context)
 	}
 
@@ -639,7 +762,13 @@ func (st *Runtime) executeInclude(node *IncludeNode) (returnValue reflect.Value)
 		Root = t.Root
 	}
 
-	return st.executeList(Root)
+	st.enterFrame(node.Line, t.Name, "")
+	returnValue = st.executeList(Root)
+	st.leaveFrame()
+
+	st.context = context
+	st.releaseScope()
+	return returnValue
 }
 
 var (
@@ -691,31 +820,41 @@ func (st *Runtime) evalPrimaryExpressionGroup(node Expression) reflect.Value {
 	case NodeSliceExpr:
 		node := node.(*SliceExprNode)
 		baseExpression := st.evalPrimaryExpressionGroup(node.Base)
-
-		var index, length int
+		var index, endIndex reflect.Value
 		if node.Index != nil {
-			indexExpression := st.evalPrimaryExpressionGroup(node.Index)
-			if canNumber(indexExpression.Kind()) {
-				index = int(castInt64(indexExpression))
-			} else {
-				node.Index.errorf("non numeric value in index expression kind %s", indexExpression.Kind().String())
-			}
+			index = st.evalPrimaryExpressionGroup(node.Index)
 		}
-
 		if node.EndIndex != nil {
-			indexExpression := st.evalPrimaryExpressionGroup(node.EndIndex)
-			if canNumber(indexExpression.Kind()) {
-				length = int(castInt64(indexExpression))
-			} else {
-				node.EndIndex.errorf("non numeric value in index expression kind %s", indexExpression.Kind().String())
-			}
+			endIndex = st.evalPrimaryExpressionGroup(node.EndIndex)
+		}
+		return slice(node, baseExpression, index, endIndex)
+	}
+	return st.evalBaseExpressionGroup(node)
+}
+
+// slice slices baseExpression using the evaluated index expressions of node. index and endIndex are ignored if
+// the corresponding expression is missing in node.
+func slice(node *SliceExprNode, baseExpression, index, endIndex reflect.Value) reflect.Value {
+	var from, length int
+	if node.Index != nil {
+		if canNumber(index.Kind()) {
+			from = int(castInt64(index))
 		} else {
-			length = baseExpression.Len()
+			node.Index.errorf("non numeric value in index expression kind %s", index.Kind().String())
 		}
+	}
 
-		return baseExpression.Slice(index, length)
+	if node.EndIndex != nil {
+		if canNumber(endIndex.Kind()) {
+			length = int(castInt64(endIndex))
+		} else {
+			node.EndIndex.errorf("non numeric value in index expression kind %s", endIndex.Kind().String())
+		}
+	} else {
+		length = baseExpression.Len()
 	}
-	return st.evalBaseExpressionGroup(node)
+
+	return baseExpression.Slice(from, length)
 }
 
 // notNil returns false when v.IsValid() == false
@@ -733,9 +872,11 @@ func notNil(v reflect.Value) bool {
 }
 
 func (st *Runtime) isSet(node Node) (ok bool) {
+	saved := st.save()
 	defer func() {
 		if r := recover(); r != nil {
 			// something panicked while evaluating node
+			st.restore(saved)
 			ok = false
 		}
 	}()
@@ -755,7 +896,7 @@ func (st *Runtime) isSet(node Node) (ok bool) {
 		resolved, err := resolveIndex(base, index, "")
 		return err == nil && notNil(resolved)
 	case NodeIdentifier:
-		value, err := st.resolve(node.String())
+		value, err := st.resolveIdentifier(node.(*IdentifierNode))
 		return err == nil && notNil(value)
 	case NodeField:
 		node := node.(*FieldNode)
@@ -781,7 +922,11 @@ func (st *Runtime) isSet(node Node) (ok bool) {
 }
 
 func (st *Runtime) evalNumericComparativeExpression(node *NumericComparativeExprNode) reflect.Value {
-	left, right := st.evalPrimaryExpressionGroup(node.Left), st.evalPrimaryExpressionGroup(node.Right)
+	return numericComparative(node, st.evalPrimaryExpressionGroup(node.Left), st.evalPrimaryExpressionGroup(node.Right))
+}
+
+// numericComparative applies node's operator to the evaluated operands.
+func numericComparative(node *NumericComparativeExprNode, left, right reflect.Value) reflect.Value {
 	isTrue := false
 	kind := left.Kind()
 
@@ -964,7 +1109,11 @@ func toFloat(v reflect.Value) float64 {
 }
 
 func (st *Runtime) evalMultiplicativeExpression(node *MultiplicativeExprNode) reflect.Value {
-	left, right := st.evalPrimaryExpressionGroup(node.Left), st.evalPrimaryExpressionGroup(node.Right)
+	return multiplicative(node, st.evalPrimaryExpressionGroup(node.Left), st.evalPrimaryExpressionGroup(node.Right))
+}
+
+// multiplicative applies node's operator to the evaluated operands.
+func multiplicative(node *MultiplicativeExprNode, left, right reflect.Value) reflect.Value {
 	kind := left.Kind()
 	// if the left value is not a float and the right is, we need to promote the left value to a float before the calculation
 	// this is necessary for expressions like 4*1.23
@@ -1023,9 +1172,16 @@ func (st *Runtime) evalMultiplicativeExpression(node *MultiplicativeExprNode) re
 }
 
 func (st *Runtime) evalAdditiveExpression(node *AdditiveExprNode) reflect.Value {
+	if node.Left == nil {
+		return additive(node, reflect.Value{}, st.evalPrimaryExpressionGroup(node.Right))
+	}
+	return additive(node, st.evalPrimaryExpressionGroup(node.Left), st.evalPrimaryExpressionGroup(node.Right))
+}
+
+// additive applies node's operator to the evaluated operands. left is ignored for unary expressions (node.Left == nil).
+func additive(node *AdditiveExprNode, left, right reflect.Value) reflect.Value {
 	isAdditive := node.Operator.typ == itemAdd
 	if node.Left == nil {
-		right := st.evalPrimaryExpressionGroup(node.Right)
 		if !right.IsValid() {
 			node.errorf("right side of additive expression is invalid value")
 		}
@@ -1053,7 +1209,6 @@ func (st *Runtime) evalAdditiveExpression(node *AdditiveExprNode) reflect.Value
 		node.Left.errorf("additive expression: right side %s (%s) is not a numeric value (no left side)", node.Right, getTypeString(right))
 	}
 
-	left, right := st.evalPrimaryExpressionGroup(node.Left), st.evalPrimaryExpressionGroup(node.Right)
 	if !left.IsValid() {
 		node.errorf("left side of additive expression is invalid value")
 	}
@@ -1135,7 +1290,11 @@ func (st *Runtime) evalBaseExpressionGroup(node Node) reflect.Value {
 	case NodeString:
 		return reflect.ValueOf(&node.(*StringNode).Text).Elem()
 	case NodeIdentifier:
-		resolved, err := st.resolve(node.(*IdentifierNode).Ident)
+		node := node.(*IdentifierNode)
+		if node.static {
+			return indirectEface(st.slotOf(node).value)
+		}
+		resolved, err := st.resolveIdentifier(node)
 		if err != nil {
 			node.error(err)
 		}
@@ -1149,7 +1308,7 @@ func (st *Runtime) evalBaseExpressionGroup(node Node) reflect.Value {
 				node.errorf("%v", err)
 			}
 			if !field.IsValid() {
-				node.errorf("there is no field or method '%s' in %s (.%s)", node.Ident[i], getTypeString(resolved), strings.Join(node.Ident, "."))
+				node.errorf("there is no field or method '%s' in %s (.%s)%s", node.Ident[i], getTypeString(resolved), strings.Join(node.Ident, "."), didYouMean(node.Ident[i], memberNames(resolved)))
 			}
 			resolved = field
 		}
@@ -1223,8 +1382,11 @@ func (st *Runtime) evalCommandExpression(node *CommandNode) (reflect.Value, bool
 }
 
 func (st *Runtime) evalChainNodeExpression(node *ChainNode) (reflect.Value, error) {
-	resolved := st.evalPrimaryExpressionGroup(node.Node)
+	return resolveChain(node, st.evalPrimaryExpressionGroup(node.Node))
+}
 
+// resolveChain looks up node's fields on the evaluated base of the chain.
+func resolveChain(node *ChainNode, resolved reflect.Value) (reflect.Value, error) {
 	for i := 0; i < len(node.Field); i++ {
 		field, err := resolveIndex(resolved, reflect.Value{}, node.Field[i])
 		if err != nil {
@@ -1235,7 +1397,7 @@ func (st *Runtime) evalChainNodeExpression(node *ChainNode) (reflect.Value, erro
 				// return reflect.Zero(resolved.Type().Elem()), nil
 				return reflect.Value{}, nil
 			}
-			return reflect.Value{}, fmt.Errorf("there is no field or method '%s' in %s (%s)", node.Field[i], getTypeString(resolved), node)
+			return reflect.Value{}, fmt.Errorf("there is no field or method '%s' in %s (%s)%s", node.Field[i], getTypeString(resolved), node, didYouMean(node.Field[i], memberNames(resolved)))
 		}
 		resolved = field
 	}
@@ -1259,7 +1421,7 @@ func (st *Runtime) evalSafeWriter(term reflect.Value, node *CommandNode, v ...re
 		fastprinter.PrintValue(sw, v[i])
 	}
 	for i := 0; i < len(node.Exprs); i++ {
-		fastprinter.PrintValue(sw, st.evalPrimaryExpressionGroup(node.Exprs[i]))
+		fastprinter.PrintValue(sw, node.CallArgs.eval(st, i))
 	}
 }
 
@@ -1336,7 +1498,7 @@ func (st *Runtime) evaluateArgs(fnType reflect.Type, args CallArgs, pipedArg *re
 		if args.Exprs[i].Type() == NodeUnderscore {
 			term = *pipedArg
 		} else {
-			term = st.evalPrimaryExpressionGroup(args.Exprs[i])
+			term = args.eval(st, i)
 		}
 		if !term.IsValid() {
 			return nil, fmt.Errorf("argument for position %d in %s is not a valid value", slot, fnType)
@@ -1356,7 +1518,7 @@ func (st *Runtime) evaluateArgs(fnType reflect.Type, args CallArgs, pipedArg *re
 			if args.Exprs[i].Type() == NodeUnderscore {
 				term = *pipedArg
 			} else {
-				term = st.evalPrimaryExpressionGroup(args.Exprs[i])
+				term = args.eval(st, i)
 			}
 			if !term.IsValid() {
 				return nil, fmt.Errorf("argument for position %d in %s is not a valid value", slot, fnType)
@@ -1509,9 +1671,6 @@ func castInt64(v reflect.Value) int64 {
 	return 0
 }
 
-var cachedStructsMutex = sync.RWMutex{}
-var cachedStructsFieldIndex = map[reflect.Type]map[string][]int{}
-
 // from text/template's exec.go:
 //
 // indirect returns the item at the end of indirection, and a bool to indicate
@@ -1590,14 +1749,17 @@ func resolveIndex(v, index reflect.Value, indexAsStr string) (reflect.Value, err
 	}
 
 	// Unless it's an interface, need to get to a value of type *T to guarantee
-	// we see all methods of T and *T.
+	// we see all methods of T and *T. Types without methods, like most maps,
+	// don't need a lookup at all.
 	if indexIsStr {
 		ptr := v
 		if ptr.Kind() != reflect.Interface && ptr.Kind() != reflect.Ptr && ptr.CanAddr() {
 			ptr = ptr.Addr()
 		}
-		if method := ptr.MethodByName(indexAsStr); method.IsValid() {
-			return method, nil
+		if ptr.Type().NumMethod() > 0 {
+			if m, ok := membersOf(ptr.Type())[indexAsStr]; ok && m.method >= 0 {
+				return ptr.Method(m.method), nil
+			}
 		}
 	}
 
@@ -1618,36 +1780,13 @@ func resolveIndex(v, index reflect.Value, indexAsStr string) (reflect.Value, err
 		if !indexIsStr {
 			return reflect.Value{}, fmt.Errorf("can't use %s (%s, not string) as field name in struct type %s", index, indexAsValue().Type(), v.Type())
 		}
-		typ := v.Type()
-		key := indexAsStr
-
-		// Fast path: use the struct cache to avoid allocations.
-		cachedStructsMutex.RLock()
-		cache, ok := cachedStructsFieldIndex[typ]
-		cachedStructsMutex.RUnlock()
-		if !ok {
-			cachedStructsMutex.Lock()
-			if cache, ok = cachedStructsFieldIndex[typ]; !ok {
-				cache = make(map[string][]int)
-				buildCache(typ, cache, nil)
-				cachedStructsFieldIndex[typ] = cache
-			}
-			cachedStructsMutex.Unlock()
-		}
-		if id, ok := cache[key]; ok {
-			return v.FieldByIndex(id), nil
-		}
-
-		// Slow path: use reflect directly
-		tField, ok := typ.FieldByName(key)
-		if ok {
-			field := v.FieldByIndex(tField.Index)
-			if tField.PkgPath != "" { // field is unexported
+		if m, ok := membersOf(v.Type())[indexAsStr]; ok && m.field != nil {
+			if !m.exported {
 				return reflect.Value{}, fmt.Errorf("%s is an unexported field of struct type %s", indexAsStr, v.Type())
 			}
-			return indirectEface(field), nil
+			return v.FieldByIndex(m.field), nil
 		}
-		return reflect.Value{}, fmt.Errorf("can't use %s as field name in struct type %s", indexAsStr, v.Type())
+		return reflect.Value{}, fmt.Errorf("can't use %s as field name in struct type %s%s", indexAsStr, v.Type(), didYouMean(indexAsStr, memberNames(v)))
 	case reflect.Map:
 		// If it's a map, attempt to use the field name as a key.
 		indexVal := indexAsValue()
@@ -1659,14 +1798,14 @@ func resolveIndex(v, index reflect.Value, indexAsStr string) (reflect.Value, err
 	case reflect.Ptr:
 		etyp := v.Type().Elem()
 		if etyp.Kind() == reflect.Struct && indexIsStr {
-			if _, ok := etyp.FieldByName(indexAsStr); !ok {
+			if m := membersOf(etyp)[indexAsStr]; m.field == nil {
 				// If there's no such field, say "can't evaluate"
 				// instead of "nil pointer evaluating".
 				break
 			}
 		}
 		if isNil {
-			return reflect.Value{}, fmt.Errorf("nil pointer evaluating %s.%s", v.Type(), index)
+			return reflect.Value{}, fmt.Errorf("nil pointer evaluating %s.%s", v.Type(), indexAsValue())
 		}
 	}
 	return reflect.Value{}, fmt.Errorf("can't evaluate index %s (%s) in type %s", index, indexAsStr, getTypeString(v))
@@ -1694,24 +1833,3 @@ func indexArg(index reflect.Value, cap int) (int, error) {
 	}
 	return int(x), nil
 }
-
-func buildCache(typ reflect.Type, cache map[string][]int, parent []int) {
-	numFields := typ.NumField()
-	max := len(parent) + 1
-
-	for i := 0; i < numFields; i++ {
-
-		index := make([]int, max)
-		copy(index, parent)
-		index[len(parent)] = i
-
-		field := typ.Field(i)
-		if field.Anonymous {
-			typ := field.Type
-			if typ.Kind() == reflect.Struct {
-				buildCache(typ, cache, index)
-			}
-		}
-		cache[field.Name] = index
-	}
-}
@@ -28,6 +28,10 @@ import (
 var (
 	JetTestingLoader = NewInMemLoader()
 	JetTestingSet    = NewSet(JetTestingLoader, WithSafeWriter(nil))
+	// JetTestingCompiledSet runs every test of RunJetTest() again with compiled templates
+	JetTestingCompiledSet = NewSet(JetTestingLoader, WithSafeWriter(nil), WithCompilation())
+	// JetTestingOptimizedSet runs every test of RunJetTest() again with optimized templates
+	JetTestingOptimizedSet = NewSet(JetTestingLoader, WithSafeWriter(nil), WithOptimization())
 
 	ww    io.Writer = (*devNull)(nil)
 	users           = []*User{
@@ -82,11 +86,14 @@ func init() {
 		println(err.Error())
 	}
 
-	JetTestingSet.AddGlobal("dummy", dummy)
-	JetTestingSet.AddGlobalFunc("customFn", func(args Arguments) reflect.Value {
-		args.RequireNumOfArguments("customFn", 1, 1)
-		return args.Get(0)
-	})
+	for _, set := range []*Set{JetTestingSet, JetTestingCompiledSet, JetTestingOptimizedSet} {
+		set.AddGlobal("dummy", dummy)
+		set.AddConstant("flag", true)
+		set.AddGlobalFunc("customFn", func(args Arguments) reflect.Value {
+			args.RequireNumOfArguments("customFn", 1, 1)
+			return args.Get(0)
+		})
+	}
 
 	JetTestingLoader.Set("actionNode_dummy", `hello {{dummy("WORLD")}}`)
 	JetTestingLoader.Set("noAllocFn", `hello {{ "José" }} {{1}} {{ "José" }}`)
@@ -105,6 +112,8 @@ func RunJetTest(t *testing.T, variables VarMap, context interface{}, testName, t
 		JetTestingLoader.Set(testName, testContent)
 	}
 	RunJetTestWithSet(t, JetTestingSet, variables, context, testName, testExpected)
+	RunJetTestWithSet(t, JetTestingCompiledSet, variables, context, testName, testExpected)
+	RunJetTestWithSet(t, JetTestingOptimizedSet, variables, context, testName, testExpected)
 }
 
 func RunJetTestWithSet(t *testing.T, set *Set, variables VarMap, context interface{}, testName, testExpected string) {
@@ -269,6 +278,18 @@ func TestEvalIfNode(t *testing.T) {
 
 }
 
+func TestEvalConstants(t *testing.T) {
+	var data = make(VarMap)
+	data.Set("flag", false)
+
+	RunJetTest(t, nil, nil, "constant", `{{ if flag }}on{{ else }}off{{ end }}`, `on`)
+	RunJetTest(t, data, nil, "constant_over_variable", `{{ if flag }}on{{ else }}off{{ end }}`, `on`)
+	RunJetTest(t, data, nil, "constant_isset", `{{ isset(flag) ? flag : "unset" }}`, `true`)
+	RunJetTest(t, nil, nil, "constant_declared", `{{ flag := false }}{{ if flag }}on{{ else }}off{{ end }}`, `off`)
+	RunJetTest(t, nil, nil, "constant_block_parameter", `{{ block b(flag=false) }}{{ flag }}{{ end }}`, `false`)
+	RunJetTest(t, nil, nil, "constant_over_includer", `{{ flag := false }}{{ include "constant" }}`, `on`)
+}
+
 func TestEvalBlockYieldIncludeNode(t *testing.T) {
 	var data = make(VarMap)
 
@@ -677,13 +698,19 @@ func TestExecReturn(t *testing.T) {
 	RunJetTestWithSet(t, set, nil, nil, "included", "... some content that will be discarded when this template runs inside exec() ...\n\n")
 	RunJetTestWithSet(t, set, nil, nil, "in_include", "bla bla\n... some content that will be discarded when this template runs inside exec() ...\n\n\nfoo\n")
 	RunJetTestWithSet(t, set, nil, nil, "test_in_include", "from inside included template\n")
+
+	// statements after a return don't reset the return value unless they execute a list
+	RunJetTest(t, nil, nil, "return_before_if", `{{ return 1 }}{{ if false }}a{{ end }}`, "")
+	RunJetTest(t, nil, nil, "test_return_before_if", `{{ x := exec("return_before_if") }}{{ x }}`, "1")
+	RunJetTest(t, nil, nil, "return_before_range", `{{ return 1 }}{{ range ints(0, 2) }}a{{ end }}`, "")
+	RunJetTest(t, nil, nil, "test_return_before_range", `{{ x := exec("return_before_range") }}{{ x }}`, "1")
 }
 
 func TestTryCatch(t *testing.T) {
 	set := NewSet(NewOSFileSystemLoader("./testData/tryCatch"))
 	RunJetTestWithSet(t, set, nil, nil, "try", "before try without panic ...\n\nsome content\n\nfoo\n\nafter try without panic ...\nbefore panic ...\n\nafter panic ...")
 	RunJetTestWithSet(t, set, nil, nil, "try_catch", "before panic ...\n\nan error occured!\n\nafter panic ...")
-	RunJetTestWithSet(t, set, nil, nil, "try_catch_err", "before panic ...\n\nan error occured: Jet Runtime Error (&#34;/try_catch_err.jet&#34;:3): identifier &#34;undefined_identifier_that_causes_panic&#34; not available in current (map[]) or parent scope, global, or default variables\n\nafter panic ...")
+	RunJetTestWithSet(t, set, nil, nil, "try_catch_err", "before panic ...\n\nan error occured: Jet Runtime Error (&#34;/try_catch_err.jet&#34;:3): identifier &#34;undefined_identifier_that_causes_panic&#34; not available in current or parent scope, global, or default variables\n\nafter panic ...")
 	RunJetTestWithSet(t, set, nil, nil, "try_include", "before broken include ...\n\nafter broken include ...")
 }
 
@@ -724,13 +751,16 @@ func (ctr *customTestRanger) Range() (k reflect.Value, v reflect.Value, done boo
 }
 
 func TestRanger(t *testing.T) {
-	c := make(chan string)
-	go func() {
-		for i := 0; i < 10; i++ {
-			c <- strconv.Itoa(i)
-		}
-		close(c)
-	}()
+	newChan := func() chan string {
+		c := make(chan string)
+		go func() {
+			for i := 0; i < 10; i++ {
+				c <- strconv.Itoa(i)
+			}
+			close(c)
+		}()
+		return c
+	}
 	var data = make(VarMap)
 	data.Set(
 		"m", map[string]interface{}{
@@ -740,7 +770,6 @@ func TestRanger(t *testing.T) {
 		},
 	)
 	data.Set("s", []string{"asd", "foo", "bar"})
-	data.Set("c", c)
 	data.Set("ci", &customTestRanger{
 		providesIndex: true,
 		data:          []string{"asd", "foo", "bar"},
@@ -756,7 +785,12 @@ func TestRanger(t *testing.T) {
 	RunJetTest(t, data, nil, "map_ranger", `{{ range m }}{{.}},{{ end }}`, "123,")
 	RunJetTest(t, data, nil, "map_ranger_key_context", `{{ range k := m }}{{k}}:{{.}},{{ end }}`, "asd:123,")
 	RunJetTest(t, data, nil, "map_ranger_key_value", `{{ range k, v := m }}{{k}}:{{v}},{{ end }}`, "asd:123,")
-	RunJetTest(t, data, nil, "chan_ranger", `{{ range v := c }}{{v}}{{ end }}`, "0123456789")
+	JetTestingLoader.Set("chan_ranger", `{{ range v := c }}{{v}}{{ end }}`)
+	for _, set := range []*Set{JetTestingSet, JetTestingCompiledSet, JetTestingOptimizedSet} {
+		// a channel can only be ranged over once
+		data.Set("c", newChan())
+		RunJetTestWithSet(t, set, data, nil, "chan_ranger", "0123456789")
+	}
 	RunJetTest(t, nil, nil, "ints_ranger", `{{ range i := ints(0, 10) }}{{ (i == 0 ? "" : ", ") + i }}{{ end }}`, "0, 1, 2, 3, 4, 5, 6, 7, 8, 9")
 	RunJetTest(t, nil, nil, "ints_ranger_index_value", `{{ range k, v := ints(10, 20) }}{{k}}:{{v}} {{ end }}`, "0:10 1:11 2:12 3:13 4:14 5:15 6:16 7:17 8:18 9:19 ")
 	RunJetTest(t, data, nil, "custom_indexed_ranger", `{{ range ci }}{{.}},{{ end  }}`, "asd,foo,bar,")
@@ -813,6 +847,28 @@ func BenchmarkRangeSimpleSet(b *testing.B) {
 	}
 }
 
+func BenchmarkRangeSimpleCompiled(b *testing.B) {
+	t, _ := JetTestingCompiledSet.GetTemplate("rangeOverUsers")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := t.Execute(ww, nil, &users)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkRangeSimpleSetCompiled(b *testing.B) {
+	t, _ := JetTestingCompiledSet.GetTemplate("rangeOverUsers_Set")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := t.Execute(ww, nil, &users)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
 func BenchmarkSimpleActionStd(b *testing.B) {
 	t := stdSet.Lookup("actionNode_dummy")
 	b.ResetTimer()
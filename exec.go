@@ -54,6 +54,7 @@ func (scope VarMap) SetWriter(name string, v SafeWriter) VarMap {
 // Execute executes the template into w.
 func (t *Template) Execute(w io.Writer, variables VarMap, data interface{}) (err error) {
 	st := pool_State.Get().(*Runtime)
+	defer func() { t.annotate(err) }()
 	defer st.recover(&err)
 
 	st.blocks = t.processedBlocks
@@ -62,14 +63,16 @@ func (t *Template) Execute(w io.Writer, variables VarMap, data interface{}) (err
 	st.Writer = w
 
 	// resolve extended template
-	for t.extends != nil {
-		t = t.extends
+	root := t
+	for root.extends != nil {
+		root = root.extends
 	}
+	st.frames = append(st.frames[:0], Frame{TemplatePath: root.Name})
 
 	if data != nil {
 		st.context = reflect.ValueOf(data)
 	}
 
-	st.executeList(t.Root)
+	st.executeList(root.Root)
 	return
 }
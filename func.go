@@ -47,7 +47,7 @@ func (a *Arguments) Get(argumentIndex int) reflect.Value {
 		if a.args.Exprs[argumentIndex].Type() == NodeUnderscore {
 			return *a.pipedVal
 		}
-		return a.runtime.evalPrimaryExpressionGroup(a.args.Exprs[argumentIndex])
+		return a.args.eval(a.runtime, argumentIndex)
 	}
 	if len(a.args.Exprs) == 0 && argumentIndex == 0 {
 		return *a.pipedVal
@@ -55,6 +55,14 @@ func (a *Arguments) Get(argumentIndex int) reflect.Value {
 	return reflect.Value{}
 }
 
+// line returns the line the arguments were passed on, or 0 if there are no argument expressions.
+func (a *Arguments) line() int {
+	if len(a.args.Exprs) == 0 {
+		return 0
+	}
+	return a.args.Exprs[0].line()
+}
+
 // Panicf panics with formatted error message.
 func (a *Arguments) Panicf(format string, v ...interface{}) {
 	panic(fmt.Errorf(format, v...))
@@ -0,0 +1,640 @@
+package jetc
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// generator holds the state of a single run of a Generator.
+type generator struct {
+	*Generator
+	imports   map[string]string // import path → package name
+	names     map[string]bool   // package names in use
+	funcs     []*function       // in the order they were created
+	instances map[string]*function
+	globals   map[string]*global // by name of the global variable
+	blocks    map[*jet.Template]map[string]*jet.BlockNode
+}
+
+type global struct {
+	field string // field of the generated Globals variable
+	typ   reflect.Type
+}
+
+// function is a generated method of the renderer, rendering a template or a block.
+type function struct {
+	g       *generator
+	name    string
+	doc     string
+	t       *jet.Template // the template yielded blocks are looked up in
+	params  []string
+	body    *bytes.Buffer
+	scope   *scope
+	ctx     *variable // the context, nil when executed without context
+	content *content  // the content passed to the block, nil if the function doesn't yield content
+	names   int
+}
+
+type variable struct {
+	name string // the Go identifier
+	typ  reflect.Type
+}
+
+type scope struct {
+	parent *scope
+	vars   map[string]*variable
+}
+
+// content is the parameter of a block function holding the content passed by a yield.
+type content struct {
+	ctx   reflect.Type // the type of the context the content is rendered with
+	known bool         // whether ctx was set by a {{ yield content }} already
+}
+
+type param struct {
+	name string
+	typ  reflect.Type
+}
+
+func (g *generator) newFunction(kind string, t *jet.Template, ctx reflect.Type) *function {
+	f := &function{
+		g:     g,
+		name:  kind + strconv.Itoa(len(g.funcs)+1),
+		t:     t,
+		body:  new(bytes.Buffer),
+		scope: &scope{vars: map[string]*variable{}},
+	}
+	if ctx != nil {
+		f.ctx = &variable{name: "ctx", typ: ctx}
+		f.params = append(f.params, "ctx "+g.typeExpr(ctx))
+	}
+	g.funcs = append(g.funcs, f)
+	return f
+}
+
+// template returns the function rendering t with a context of type ctx.
+func (g *generator) template(t *jet.Template, ctx reflect.Type) *function {
+	key := "template " + t.Name + " " + typeKey(ctx)
+	if f, ok := g.instances[key]; ok {
+		return f
+	}
+	f := g.newFunction("template", t, ctx)
+	f.doc = "renders " + t.Name
+	g.instances[key] = f
+
+	root := t
+	for root.Extends() != nil {
+		root = root.Extends()
+	}
+	f.list(root.Root)
+	return f
+}
+
+// block returns the function rendering block, yielded while executing t, with a context of type
+// ctx and the parameters params.
+func (g *generator) block(t *jet.Template, block *jet.BlockNode, ctx reflect.Type, params []param) *function {
+	key := "block " + t.Name + " " + block.Name + " " + typeKey(ctx)
+	for _, p := range params {
+		key += " " + p.name + ":" + typeKey(p.typ)
+	}
+	if f, ok := g.instances[key]; ok {
+		return f
+	}
+	f := g.newFunction("block", t, ctx)
+	f.doc = fmt.Sprintf("renders the block %s of %s", block.Name, block.TemplatePath)
+	g.instances[key] = f
+
+	for _, p := range params {
+		f.params = append(f.params, f.declare(p.name, p.typ)+" "+g.typeExpr(p.typ))
+	}
+	if g.yieldsContent(t, block.List) {
+		f.content = &content{}
+	}
+	f.list(block.List)
+	return f
+}
+
+func (g *generator) blocksOf(t *jet.Template) map[string]*jet.BlockNode {
+	if g.blocks == nil {
+		g.blocks = map[*jet.Template]map[string]*jet.BlockNode{}
+	}
+	blocks, ok := g.blocks[t]
+	if !ok {
+		blocks = t.Blocks()
+		g.blocks[t] = blocks
+	}
+	return blocks
+}
+
+// yieldsContent reports whether executing list may yield the content passed to a block.
+func (g *generator) yieldsContent(t *jet.Template, list *jet.ListNode) bool {
+	if list == nil {
+		return false
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *jet.YieldNode:
+			if node.IsContent || g.yieldsContent(t, node.Content) {
+				return true
+			}
+		case *jet.BlockNode:
+			block := g.blocksOf(t)[node.Name]
+			if block == nil {
+				block = node
+			}
+			if g.yieldsContent(t, block.Content) {
+				return true
+			}
+		case *jet.IfNode:
+			if g.yieldsContent(t, node.List) || g.yieldsContent(t, node.ElseList) {
+				return true
+			}
+		case *jet.RangeNode:
+			if g.yieldsContent(t, node.List) || g.yieldsContent(t, node.ElseList) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *generator) global(node jet.Node, name string, val reflect.Value) value {
+	if !val.IsValid() {
+		errorf(node, "the global %s is nil", name)
+	}
+	typ := val.Type()
+	switch {
+	case typ == funcType:
+		errorf(node, "the global %s is a jet.Func, which can't be compiled", name)
+	case typ == safeWriterType:
+		code, ok := g.funcExpr(val)
+		if !ok {
+			errorf(node, "the global %s must be a top-level function of an importable package", name)
+		}
+		return value{code: code, typ: safeWriterType}
+	case typ.Kind() == reflect.Func:
+		code, ok := g.funcExpr(val)
+		if !ok {
+			errorf(node, "the global %s must be a top-level function of an importable package", name)
+		}
+		return value{code: code, typ: typ}
+	}
+
+	gl, ok := g.globals[name]
+	if !ok {
+		r, size := utf8.DecodeRuneInString(name)
+		field := string(unicode.ToUpper(r)) + name[size:]
+		if !token.IsExported(field) {
+			errorf(node, "the global %s can't be stored in an exported field of Globals", name)
+		}
+		for otherName, other := range g.globals {
+			if other.field == field {
+				errorf(node, "the globals %s and %s would both be stored in Globals.%s", name, otherName, field)
+			}
+		}
+		gl = &global{field: field, typ: typ}
+		g.globals[name] = gl
+	}
+	return value{code: "Globals." + gl.field, typ: gl.typ, addressable: true}
+}
+
+func (f *function) source() []byte {
+	params := f.params
+	if f.content != nil {
+		param := ""
+		if f.content.ctx != nil {
+			param = f.g.typeExpr(f.content.ctx)
+		}
+		params = append(params, "content func("+param+")")
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s %s.\n", f.name, f.doc)
+	fmt.Fprintf(&b, "func (r *renderer) %s(%s) {\n", f.name, strings.Join(params, ", "))
+	b.Write(f.body.Bytes())
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func (f *function) printf(format string, args ...interface{}) {
+	fmt.Fprintf(f.body, format, args...)
+}
+
+func (f *function) newName(base string) string {
+	f.names++
+	return base + strconv.Itoa(f.names)
+}
+
+func (f *function) push() {
+	f.scope = &scope{parent: f.scope, vars: map[string]*variable{}}
+}
+
+func (f *function) pop() {
+	f.scope = f.scope.parent
+}
+
+// declare declares the template variable name in the current scope, and returns its Go identifier.
+func (f *function) declare(name string, typ reflect.Type) string {
+	// temporaries never contain an underscore, and the suffix avoids clashes with Go keywords
+	f.names++
+	v := &variable{name: name + "_" + strconv.Itoa(f.names), typ: typ}
+	f.scope.vars[name] = v
+	return v.name
+}
+
+func (f *function) lookup(name string) *variable {
+	for sc := f.scope; sc != nil; sc = sc.parent {
+		if v, ok := sc.vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// list compiles list, see executeList() in package jet.
+func (f *function) list(list *jet.ListNode) {
+	if list == nil {
+		return
+	}
+	f.push()
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *jet.TextNode:
+			if len(node.Text) > 0 {
+				f.printf("r.WriteString(%s)\n", strconv.Quote(string(node.Text)))
+			}
+		case *jet.ActionNode:
+			if node.Set != nil {
+				f.set(node.Set)
+			}
+			if node.Pipe != nil {
+				f.action(node.Pipe)
+			}
+		case *jet.IfNode:
+			f.ifNode(node)
+		case *jet.RangeNode:
+			f.rangeNode(node)
+		case *jet.YieldNode:
+			if node.IsContent {
+				f.yieldContent(node)
+				continue
+			}
+			block, ok := f.g.blocksOf(f.t)[node.Name]
+			if !ok {
+				errorf(node, "unresolved block %q", node.Name)
+			}
+			f.yield(node, block, node.Parameters, node.Expression, node.Content)
+		case *jet.BlockNode:
+			block, ok := f.g.blocksOf(f.t)[node.Name]
+			if !ok {
+				block = node
+			}
+			f.yield(node, block, block.Parameters, block.Expression, block.Content)
+		case *jet.IncludeNode:
+			f.include(node)
+		case *jet.TryNode:
+			errorf(node, "try statements are not supported")
+		case *jet.ReturnNode:
+			errorf(node, "return statements are not supported")
+		default:
+			errorf(node, "unexpected node %s", node)
+		}
+	}
+	f.pop()
+}
+
+// action compiles an action writing the result of pipe.
+func (f *function) action(pipe *jet.PipeNode) {
+	v, written := f.pipeline(pipe, true)
+	switch {
+	case written:
+	case v.void:
+		f.printf("%s\n", v.code)
+	default:
+		f.write(pipe, v, writer{})
+	}
+}
+
+// set compiles a let statement or an assignment, see executeLetList() and executeSetList() in package jet.
+func (f *function) set(node *jet.SetNode) {
+	if node.IndexExprGetLookup {
+		index, ok := node.Right[0].(*jet.IndexExprNode)
+		if !ok {
+			errorf(node, "unexpected lookup %s", node.Right[0])
+		}
+		m := indirect(f.operand(index.Base))
+		if m.typ == nil || m.typ.Kind() != reflect.Map {
+			errorf(index, "looking up %s: lookups are only supported in maps", index)
+		}
+		key := f.convert(index.Index, f.operand(index.Index), m.typ.Key())
+		results := []value{{code: f.newName("v"), typ: m.typ.Elem()}, {code: f.newName("ok"), typ: boolType}}
+		f.printf("%s, %s := %s[%s]\n", results[0].code, results[1].code, m.code, key)
+		for i, left := range node.Left[:2] {
+			f.printf("_ = %s\n", results[i].code)
+			f.setIdent(node, left, results[i])
+		}
+		return
+	}
+
+	for i, left := range node.Left {
+		f.setIdent(node, left, f.operand(node.Right[i]))
+	}
+}
+
+// setIdent declares or assigns the variable left.
+func (f *function) setIdent(node *jet.SetNode, left jet.Expression, v value) {
+	switch left := left.(type) {
+	case *jet.UnderscoreNode:
+		f.printf("_ = %s\n", v.code)
+	case *jet.IdentifierNode:
+		if node.Let {
+			if v.typ == nil {
+				errorf(left, "can't declare %s as untyped nil", left.Ident)
+			}
+			name := f.declare(left.Ident, v.typ)
+			f.printf("%s := %s\n_ = %s\n", name, v.code, name)
+			return
+		}
+		variable := f.lookup(left.Ident)
+		if variable == nil {
+			errorf(left, "can't assign to %s: it's not declared in this template", left.Ident)
+		}
+		f.printf("%s = %s\n", variable.name, f.convert(left, v, variable.typ))
+	default:
+		errorf(left, "assignments to %s are not supported", left)
+	}
+}
+
+func (f *function) ifNode(node *jet.IfNode) {
+	isLet := node.Set != nil && node.Set.Let
+	if isLet {
+		f.printf("{\n")
+		f.push()
+	}
+	if node.Set != nil {
+		f.set(node.Set)
+	}
+	f.printf("if %s {\n", f.truth(node.Expression, f.operand(node.Expression)))
+	f.list(node.List)
+	if node.ElseList != nil {
+		f.printf("} else {\n")
+		f.list(node.ElseList)
+	}
+	f.printf("}\n")
+	if isLet {
+		f.pop()
+		f.printf("}\n")
+	}
+}
+
+func (f *function) rangeNode(node *jet.RangeNode) {
+	expression := node.Expression
+	if node.Set != nil {
+		expression = node.Set.Right[0]
+	}
+
+	f.printf("{\n")
+	empty := ""
+	if node.ElseList != nil {
+		empty = f.newName("empty")
+		f.printf("%s := true\n", empty)
+	}
+
+	key, val := f.newName("i"), f.newName("v")
+	var keyType, valType reflect.Type
+	providesIndex := true
+	if call, ok := expression.(*jet.CallExprNode); ok && f.isBuiltin(call.BaseExpr, "ints") {
+		if len(call.Exprs) != 2 {
+			errorf(call, "ints() needs 2 arguments, but has %d", len(call.Exprs))
+		}
+		from, to := f.newName("from"), f.newName("to")
+		f.printf("%s, %s := %s, %s\n", from, to, f.convert(call.Exprs[0], f.operand(call.Exprs[0]), int64Type), f.convert(call.Exprs[1], f.operand(call.Exprs[1]), int64Type))
+		f.printf("if %s <= %s {\npanic(\"invalid range for ints ranger: 'from' must be smaller than 'to'\")\n}\n", to, from)
+		f.printf("for %s, %s := 0, %s; %s < %s; %s, %s = %s+1, %s+1 {\n", key, val, from, val, to, key, val, key, val)
+		keyType, valType = intType, int64Type
+	} else {
+		v := indirect(f.operand(expression))
+		if v.typ == nil {
+			errorf(expression, "can't range over nil")
+		}
+		if v.typ.Implements(rangerType) {
+			errorf(expression, "ranging over a jet.Ranger (%s) is not supported", v.typ)
+		}
+		switch v.typ.Kind() {
+		case reflect.Slice, reflect.Array:
+			keyType, valType = intType, v.typ.Elem()
+		case reflect.Map:
+			keyType, valType = v.typ.Key(), v.typ.Elem()
+		case reflect.Chan:
+			providesIndex, valType = false, v.typ.Elem()
+		default:
+			errorf(expression, "value %s (type %s) is not rangeable", expression, v.typ)
+		}
+		if providesIndex {
+			f.printf("for %s, %s := range %s {\n_ = %s\n", key, val, v.code, key)
+		} else {
+			f.printf("for %s := range %s {\n", val, v.code)
+		}
+	}
+	f.printf("_ = %s\n", val)
+	if empty != "" {
+		f.printf("%s = false\n", empty)
+	}
+
+	// like executeList(), a single variable is set to the index if the ranged value provides one,
+	// in which case the context is set to the value
+	setsContext := true
+	isLet := node.Set != nil && node.Set.Let
+	if node.Set != nil {
+		left := node.Set.Left
+		if len(left) > 1 && !providesIndex {
+			errorf(node, "two-var range over ranger that does not provide an index")
+		}
+		sources := []param{{key, keyType}, {val, valType}}
+		if !providesIndex {
+			sources = sources[1:]
+		}
+		if len(left) > 1 || !providesIndex {
+			setsContext = false
+		}
+		if isLet {
+			f.push()
+		}
+		for i, left := range left {
+			f.setIdent(node.Set, left, value{code: sources[i].name, typ: sources[i].typ})
+		}
+	}
+
+	ctx := f.ctx
+	if setsContext {
+		f.ctx = &variable{name: val, typ: valType}
+	}
+	f.list(node.List)
+	f.ctx = ctx
+	if isLet {
+		f.pop()
+	}
+	f.printf("}\n")
+
+	if empty != "" {
+		f.printf("if %s {\n", empty)
+		f.list(node.ElseList)
+		f.printf("}\n")
+	}
+	f.printf("}\n")
+}
+
+// yield compiles executing block, see executeYieldBlock() in package jet. Unlike the block, the
+// values of its parameters and context, and the content passed to it, are evaluated by the caller.
+func (f *function) yield(node jet.Node, block *jet.BlockNode, params *jet.BlockParameterList, ctxExpr jet.Expression, contentList *jet.ListNode) {
+	f.printf("{\n")
+	f.push()
+
+	var blockParams []param
+	var args []string
+	bound := map[string]bool{}
+	bind := func(node jet.Node, name string, v value) {
+		if v.typ == nil {
+			errorf(node, "block parameter %s is nil", name)
+		}
+		goName := f.declare(name, v.typ)
+		f.printf("%s := %s\n", goName, v.code)
+		blockParams = append(blockParams, param{name, v.typ})
+		args = append(args, goName)
+		bound[name] = true
+	}
+	if params != nil {
+		for _, p := range params.List {
+			if p.Expression == nil {
+				errorf(node, "missing name for block parameter '%s'", p.Identifier)
+			}
+			bind(p.Expression, p.Identifier, f.operand(p.Expression))
+		}
+	}
+	if block.Parameters != nil {
+		for _, p := range block.Parameters.List {
+			switch {
+			case bound[p.Identifier]:
+			case p.Expression == nil:
+				bind(node, p.Identifier, value{code: "false", typ: boolType})
+			default:
+				bind(p.Expression, p.Identifier, f.operand(p.Expression))
+			}
+		}
+	}
+
+	ctx := f.ctx
+	if ctxExpr != nil {
+		v := f.operand(ctxExpr)
+		if v.typ == nil {
+			errorf(ctxExpr, "the context of block %s is nil", block.Name)
+		}
+		ctx = &variable{name: f.newName("ctx"), typ: v.typ}
+		f.printf("%s := %s\n", ctx.name, v.code)
+	}
+	var ctxType reflect.Type
+	if ctx != nil {
+		ctxType = ctx.typ
+		args = append([]string{ctx.name}, args...)
+	}
+
+	fn := f.g.block(f.t, block, ctxType, blockParams)
+	if fn.content != nil {
+		switch {
+		case contentList != nil:
+			if !fn.content.known {
+				errorf(node, "can't pass content to the recursive block %s", block.Name)
+			}
+			args = append(args, f.closure(contentList, fn.content.ctx))
+		case f.content == fn.content,
+			f.content != nil && f.content.known && fn.content.known && f.content.ctx == fn.content.ctx:
+			args = append(args, "content")
+		default:
+			args = append(args, "nil")
+		}
+	}
+	f.printf("r.%s(%s)\n", fn.name, strings.Join(args, ", "))
+
+	f.pop()
+	f.printf("}\n")
+}
+
+// closure returns a function literal executing list with a context of type ctx.
+func (f *function) closure(list *jet.ListNode, ctx reflect.Type) string {
+	body, outer := f.body, f.ctx
+	f.body, f.ctx = new(bytes.Buffer), nil
+	param := ""
+	if ctx != nil {
+		f.ctx = &variable{name: f.newName("ctx"), typ: ctx}
+		param = f.ctx.name + " " + f.g.typeExpr(ctx)
+	}
+	f.list(list)
+	code := fmt.Sprintf("func(%s) {\n%s}", param, f.body)
+	f.body, f.ctx = body, outer
+	return code
+}
+
+func (f *function) yieldContent(node *jet.YieldNode) {
+	if node.Expression != nil {
+		errorf(node, "yielding content with a context is not supported")
+	}
+	if f.content == nil {
+		return // no content can be passed to the function: {{ yield content }} renders nothing
+	}
+	var ctxType reflect.Type
+	arg := ""
+	if f.ctx != nil {
+		ctxType, arg = f.ctx.typ, f.ctx.name
+	}
+	if !f.content.known {
+		f.content.ctx, f.content.known = ctxType, true
+	} else if f.content.ctx != ctxType {
+		errorf(node, "content is yielded with contexts of different types (%s and %s)", f.content.ctx, ctxType)
+	}
+	f.printf("if content != nil {\ncontent(%s)\n}\n", arg)
+}
+
+// include compiles an include statement, see executeInclude() in package jet.
+func (f *function) include(node *jet.IncludeNode) {
+	name, ok := node.Name.(*jet.StringNode)
+	if !ok {
+		errorf(node, "templates can only be included by constant names")
+	}
+	templatePath := f.g.set.SiblingTemplatePath(name.Text, node.TemplatePath)
+	t, err := f.g.set.GetTemplate(templatePath)
+	if err != nil {
+		errorf(node, "including %s: %v", templatePath, err)
+	}
+
+	ctx := f.ctx
+	if node.Context != nil {
+		v := f.operand(node.Context)
+		if v.typ == nil {
+			errorf(node.Context, "the context of %s is nil", templatePath)
+		}
+		ctx = &variable{name: v.code, typ: v.typ}
+	}
+	var ctxType reflect.Type
+	arg := ""
+	if ctx != nil {
+		ctxType, arg = ctx.typ, ctx.name
+	}
+	f.printf("r.%s(%s)\n", f.g.template(t, ctxType).name, arg)
+}
+
+// errorf panics with an *Error at the position of node, which Generator.Generate() recovers from.
+func errorf(node jet.Node, format string, args ...interface{}) {
+	v := reflect.Indirect(reflect.ValueOf(node))
+	panic(&Error{
+		TemplatePath: v.FieldByName("TemplatePath").String(),
+		Line:         int(v.FieldByName("Line").Int()),
+		Message:      fmt.Sprintf(format, args...),
+	})
+}
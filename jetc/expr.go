@@ -0,0 +1,686 @@
+package jetc
+
+import (
+	"encoding/json"
+	"html"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// value is a compiled expression.
+type value struct {
+	code        string
+	typ         reflect.Type // nil for the untyped nil and calls of functions without results
+	addressable bool
+	void        bool   // a call of a function without results
+	builtin     string // name of a built-in function compiled specially: "len" or "ints"
+}
+
+// builtins are the built-in functions of Jet that are compiled to calls of Go functions.
+var builtins = map[string]interface{}{
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"repeat":    strings.Repeat,
+	"replace":   strings.Replace,
+	"split":     strings.Split,
+	"trimSpace": strings.TrimSpace,
+	"html":      html.EscapeString,
+	"url":       url.QueryEscape,
+	"json":      json.Marshal,
+	"safeHtml":  jet.SafeWriter(template.HTMLEscape),
+	"safeJs":    jet.SafeWriter(template.JSEscape),
+}
+
+// operand compiles an expression used as an operand, which must have a value.
+func (f *function) operand(node jet.Expression) value {
+	v := f.expr(node)
+	switch {
+	case v.void:
+		errorf(node, "%s has no result", node)
+	case v.builtin != "":
+		errorf(node, "the built-in %s can only be called", v.builtin)
+	case v.typ == safeWriterType:
+		errorf(node, "the writer %s can only be used as the last command of an action", node)
+	}
+	return v
+}
+
+func (f *function) expr(node jet.Expression) value {
+	switch node := node.(type) {
+	case *jet.NilNode:
+		return value{code: "nil"}
+	case *jet.BoolNode:
+		return value{code: strconv.FormatBool(node.True), typ: boolType}
+	case *jet.NumberNode:
+		// like jet, treat all numbers as floats if they can be represented as such
+		switch {
+		case node.IsFloat:
+			return value{code: "float64(" + strconv.FormatFloat(node.Float64, 'g', -1, 64) + ")", typ: float64Type}
+		case node.IsInt:
+			return value{code: "int64(" + strconv.FormatInt(node.Int64, 10) + ")", typ: int64Type}
+		case node.IsUint:
+			return value{code: "uint64(" + strconv.FormatUint(node.Uint64, 10) + ")", typ: uint64Type}
+		}
+		errorf(node, "complex numbers are not supported")
+	case *jet.StringNode:
+		return value{code: strconv.Quote(node.Text), typ: stringType}
+	case *jet.IdentifierNode:
+		return f.ident(node)
+	case *jet.FieldNode, *jet.ChainNode:
+		return f.selectors(node, false)
+	case *jet.CallExprNode:
+		return f.call(node, f.callee(node.BaseExpr), node.CallArgs, nil)
+	case *jet.PipeNode:
+		v, _ := f.pipeline(node, false)
+		return v
+	case *jet.NotExprNode:
+		return value{code: "!" + f.truth(node.Expr, f.operand(node.Expr)), typ: boolType}
+	case *jet.LogicalExprNode:
+		left, right := f.operand(node.Left), f.operand(node.Right)
+		return value{code: "(" + f.truth(node.Left, left) + " " + node.Op() + " " + f.truth(node.Right, right) + ")", typ: boolType}
+	case *jet.AdditiveExprNode:
+		return f.additive(node)
+	case *jet.MultiplicativeExprNode:
+		return f.multiplicative(node)
+	case *jet.NumericComparativeExprNode:
+		return f.numericComparative(node)
+	case *jet.ComparativeExprNode:
+		return f.equality(node)
+	case *jet.TernaryExprNode:
+		return f.ternary(node)
+	case *jet.IndexExprNode:
+		return f.index(node)
+	case *jet.SliceExprNode:
+		return f.slice(node)
+	}
+	errorf(node, "unexpected expression %s", node)
+	return value{}
+}
+
+// ident resolves an identifier like resolve() in package jet: to the context, a variable, a global
+// or a built-in.
+func (f *function) ident(node *jet.IdentifierNode) value {
+	name := node.Ident
+	if name == "." {
+		if f.ctx == nil {
+			errorf(node, "%s is executed without context", f.t.Name)
+		}
+		return value{code: f.ctx.name, typ: f.ctx.typ, addressable: true}
+	}
+	if v := f.lookup(name); v != nil {
+		return value{code: v.name, typ: v.typ, addressable: true}
+	}
+	if val, ok := f.g.set.LookupGlobal(name); ok {
+		return f.g.global(node, name, val.(reflect.Value))
+	}
+	switch name {
+	case "len", "ints":
+		return value{builtin: name}
+	case "raw", "unsafe":
+		return value{typ: safeWriterType} // written unescaped
+	}
+	if fn, ok := builtins[name]; ok {
+		code, _ := f.g.funcExpr(reflect.ValueOf(fn))
+		return value{code: code, typ: reflect.TypeOf(fn)}
+	}
+	errorf(node, "identifier %q not available in this context", name)
+	return value{}
+}
+
+// isBuiltin reports whether node is the identifier of the built-in name.
+func (f *function) isBuiltin(node jet.Expression, name string) bool {
+	ident, ok := node.(*jet.IdentifierNode)
+	return ok && ident.Ident == name && f.ident(ident).builtin == name
+}
+
+// callee compiles the function called by a call expression or command.
+func (f *function) callee(node jet.Expression) value {
+	switch node.(type) {
+	case *jet.FieldNode, *jet.ChainNode:
+		return f.selectors(node, true)
+	}
+	return f.expr(node)
+}
+
+// call compiles a call of fn, see evalPipeCallExpression() and evaluateArgs() in package jet.
+func (f *function) call(node jet.Node, fn value, callArgs jet.CallArgs, piped *value) value {
+	var args []value
+	var argNodes []jet.Node
+	if piped != nil && !callArgs.HasPipeSlot {
+		args, argNodes = append(args, *piped), append(argNodes, node)
+	}
+	for _, expr := range callArgs.Exprs {
+		if _, ok := expr.(*jet.UnderscoreNode); ok {
+			if piped == nil {
+				errorf(expr, "there is no piped value to pass as argument")
+			}
+			args = append(args, *piped)
+		} else {
+			args = append(args, f.operand(expr))
+		}
+		argNodes = append(argNodes, expr)
+	}
+
+	if fn.builtin == "len" {
+		if len(args) != 1 {
+			errorf(node, "len() needs 1 argument, but has %d", len(args))
+		}
+		arg := args[0]
+		if arg.typ != nil && arg.typ.Kind() == reflect.Ptr {
+			arg = indirect(arg)
+		}
+		if arg.typ != nil {
+			switch arg.typ.Kind() {
+			case reflect.Array, reflect.Chan, reflect.Slice, reflect.Map, reflect.String:
+				return value{code: "len(" + arg.code + ")", typ: intType}
+			case reflect.Struct:
+				return value{code: strconv.Itoa(arg.typ.NumField()), typ: intType}
+			}
+		}
+		errorf(node, "len(): invalid value type %s", arg.typ)
+	}
+	if fn.builtin != "" {
+		errorf(node, "%s() can only be ranged over", fn.builtin)
+	}
+	if fn.typ == nil || fn.typ.Kind() != reflect.Func {
+		errorf(node, "%s is not a function", fn.code)
+	}
+
+	typ := fn.typ
+	numIn := typ.NumIn()
+	if typ.IsVariadic() {
+		numIn--
+		if len(args) < numIn {
+			errorf(node, "%s needs at least %d arguments, but has %d", typ, numIn, len(args))
+		}
+	} else if len(args) != numIn {
+		errorf(node, "%s needs %d arguments, but has %d", typ, numIn, len(args))
+	}
+	codes := make([]string, len(args))
+	for i, arg := range args {
+		var in reflect.Type
+		if i < numIn {
+			in = typ.In(i)
+		} else {
+			in = typ.In(numIn).Elem()
+		}
+		codes[i] = f.convert(argNodes[i], arg, in)
+	}
+	code := fn.code + "(" + strings.Join(codes, ", ") + ")"
+
+	switch typ.NumOut() {
+	case 0:
+		return value{code: code, void: true}
+	case 1:
+		return value{code: code, typ: typ.Out(0)}
+	}
+	// like jet, use the first result
+	result := f.g.typeExpr(typ.Out(0))
+	return value{code: "func() " + result + " {\nv" + strings.Repeat(", _", typ.NumOut()-1) + " := " + code + "\nreturn v\n}()", typ: typ.Out(0)}
+}
+
+// pipeline compiles a pipeline, see evalPipelineExpression() in package jet. Writers are only
+// allowed as the last command if write is set, in which case they write the pipeline's output.
+func (f *function) pipeline(node *jet.PipeNode, write bool) (v value, written bool) {
+	for i, cmd := range node.Cmds {
+		if written {
+			errorf(cmd, "unexpected command %s, writer command should be the last command", cmd)
+		}
+		var piped *value
+		if i > 0 {
+			if v.void {
+				errorf(node.Cmds[i-1], "%s has no result", node.Cmds[i-1])
+			}
+			piped = &value{code: v.code, typ: v.typ}
+		}
+		v, written = f.command(cmd, piped, write && i == len(node.Cmds)-1)
+	}
+	return v, written
+}
+
+func (f *function) command(cmd *jet.CommandNode, piped *value, write bool) (value, bool) {
+	if piped == nil && cmd.Exprs == nil {
+		return f.expr(cmd.BaseExpr), false
+	}
+	fn := f.callee(cmd.BaseExpr)
+	if fn.typ != safeWriterType {
+		return f.call(cmd, fn, cmd.CallArgs, piped), false
+	}
+	if !write {
+		errorf(cmd, "the writer %s can only be used as the last command of an action", cmd.BaseExpr)
+	}
+	w := writer{escape: fn.code, raw: fn.code == ""}
+	if piped != nil {
+		f.write(cmd, *piped, w)
+	}
+	for _, arg := range cmd.Exprs {
+		f.write(arg, f.operand(arg), w)
+	}
+	return value{}, true
+}
+
+// selectors compiles a field or chain node, whose last field is a method if call is set.
+func (f *function) selectors(node jet.Node, call bool) value {
+	var v value
+	var fields []string
+	switch node := node.(type) {
+	case *jet.FieldNode:
+		if f.ctx == nil {
+			errorf(node, "%s is executed without context", f.t.Name)
+		}
+		v = value{code: f.ctx.name, typ: f.ctx.typ, addressable: true}
+		fields = node.Ident
+	case *jet.ChainNode:
+		v = f.operand(node.Node)
+		fields = node.Field
+	}
+	for i, field := range fields {
+		v = f.selector(node, v, field, call && i == len(fields)-1)
+	}
+	return v
+}
+
+// selector compiles accessing the field, method or map key name of v, see resolveIndex() in package jet.
+func (f *function) selector(node jet.Node, v value, name string, call bool) value {
+	if v.typ == nil {
+		errorf(node, "there is no field or method '%s' in nil", name)
+	}
+	if m, ok := v.typ.MethodByName(name); ok {
+		return f.method(node, v, m, call)
+	}
+	if k := v.typ.Kind(); k != reflect.Ptr && k != reflect.Interface && v.addressable {
+		if m, ok := reflect.PtrTo(v.typ).MethodByName(name); ok {
+			return f.method(node, v, m, call)
+		}
+	}
+
+	if v.typ.Kind() == reflect.Ptr && v.typ.Elem().Kind() == reflect.Struct {
+		v = value{code: v.code, typ: v.typ.Elem(), addressable: true} // dereferenced by the selector
+	} else {
+		v = indirect(v)
+	}
+	switch v.typ.Kind() {
+	case reflect.Struct:
+		field, ok := v.typ.FieldByName(name)
+		if !ok {
+			break
+		}
+		if field.PkgPath != "" {
+			errorf(node, "%s is an unexported field of struct type %s", name, v.typ)
+		}
+		return value{code: v.code + "." + name, typ: field.Type, addressable: v.addressable}
+	case reflect.Map:
+		if v.typ.Key().Kind() == reflect.String {
+			return value{code: v.code + "[" + strconv.Quote(name) + "]", typ: v.typ.Elem()}
+		}
+	case reflect.Interface:
+		errorf(node, "can't access %s of a value of type %s: only its methods are known before executing the template", name, v.typ)
+	}
+	errorf(node, "there is no field or method '%s' in %s", name, v.typ)
+	return value{}
+}
+
+func (f *function) method(node jet.Node, v value, m reflect.Method, call bool) value {
+	if !call {
+		errorf(node, "method %s of %s must be called", m.Name, v.typ)
+	}
+	typ := m.Type
+	if v.typ.Kind() != reflect.Interface {
+		// drop the receiver
+		in := make([]reflect.Type, typ.NumIn()-1)
+		for i := range in {
+			in[i] = typ.In(i + 1)
+		}
+		out := make([]reflect.Type, typ.NumOut())
+		for i := range out {
+			out[i] = typ.Out(i)
+		}
+		typ = reflect.FuncOf(in, out, typ.IsVariadic())
+	}
+	return value{code: v.code + "." + m.Name, typ: typ}
+}
+
+// indirect dereferences the pointers v points through.
+func indirect(v value) value {
+	for v.typ != nil && v.typ.Kind() == reflect.Ptr {
+		v = value{code: "(*" + v.code + ")", typ: v.typ.Elem(), addressable: true}
+	}
+	return v
+}
+
+func (f *function) index(node *jet.IndexExprNode) value {
+	base := f.operand(node.Base)
+	if base.typ == nil {
+		errorf(node, "can't index nil")
+	}
+	if name, ok := node.Index.(*jet.StringNode); ok {
+		if t := indirect(base).typ; t.Kind() == reflect.Struct {
+			return f.selector(node, base, name.Text, false)
+		}
+	}
+
+	v := indirect(base)
+	index := f.operand(node.Index)
+	switch v.typ.Kind() {
+	case reflect.Slice:
+		return value{code: v.code + "[" + f.convert(node.Index, index, intType) + "]", typ: v.typ.Elem(), addressable: true}
+	case reflect.Array:
+		return value{code: v.code + "[" + f.convert(node.Index, index, intType) + "]", typ: v.typ.Elem(), addressable: v.addressable}
+	case reflect.String:
+		return value{code: v.code + "[" + f.convert(node.Index, index, intType) + "]", typ: reflect.TypeOf(byte(0))}
+	case reflect.Map:
+		return value{code: v.code + "[" + f.convert(node.Index, index, v.typ.Key()) + "]", typ: v.typ.Elem()}
+	}
+	errorf(node, "can't index %s (type %s)", node.Base, base.typ)
+	return value{}
+}
+
+func (f *function) slice(node *jet.SliceExprNode) value {
+	v := indirect(f.operand(node.Base))
+	if v.typ == nil {
+		errorf(node, "can't slice nil")
+	}
+	typ := v.typ
+	switch typ.Kind() {
+	case reflect.Slice, reflect.String:
+	case reflect.Array:
+		if !v.addressable {
+			errorf(node, "can't slice %s: the array is not addressable", node.Base)
+		}
+		typ = reflect.SliceOf(typ.Elem())
+	default:
+		errorf(node, "can't slice %s (type %s)", node.Base, v.typ)
+	}
+	from, to := "", ""
+	if node.Index != nil {
+		from = f.convert(node.Index, f.operand(node.Index), intType)
+	}
+	if node.EndIndex != nil {
+		to = f.convert(node.EndIndex, f.operand(node.EndIndex), intType)
+	}
+	return value{code: v.code + "[" + from + ":" + to + "]", typ: typ}
+}
+
+// numeric returns the code converting the numeric value v to a value of kind, which is one of
+// the kinds returned by numericKind().
+func numeric(v value, kind reflect.Kind) string {
+	t := numericType(kind)
+	if v.typ == t {
+		return v.code
+	}
+	return t.String() + "(" + v.code + ")"
+}
+
+// promotion returns the kind of the values jet computes with when evaluating an arithmetic or
+// comparative expression: the kind of the left operand, unless the right operand is a float.
+func promotion(node jet.Node, left, right value) reflect.Kind {
+	lk, rk := numericKind(left.typ), numericKind(right.typ)
+	if lk == reflect.Invalid {
+		errorf(node, "a non numeric value (%s) in numeric expression", left.typ)
+	}
+	if rk == reflect.Invalid {
+		errorf(node, "a non numeric value (%s) in numeric expression", right.typ)
+	}
+	if rk == reflect.Float64 {
+		return reflect.Float64
+	}
+	return lk
+}
+
+// additive compiles an additive expression, see additive() in package jet.
+func (f *function) additive(node *jet.AdditiveExprNode) value {
+	op := node.Op()
+	right := f.operand(node.Right)
+	if node.Left == nil {
+		kind := numericKind(right.typ)
+		switch {
+		case kind == reflect.Invalid:
+			errorf(node, "additive expression: right side %s (%s) is not a numeric value (no left side)", node.Right, right.typ)
+		case kind == reflect.Uint64 && op == "+":
+			return right
+		case kind == reflect.Uint64:
+			kind = reflect.Int64
+		}
+		return value{code: "(" + op + numeric(right, kind) + ")", typ: numericType(kind)}
+	}
+
+	left := f.operand(node.Left)
+	if left.typ != nil && left.typ.Kind() == reflect.String {
+		if op != "+" {
+			errorf(node.Right, "minus signal is not allowed with strings")
+		}
+		var r string
+		switch {
+		case right.typ == nil:
+			errorf(node, "right side of additive expression is invalid value")
+		case right.typ.Kind() == reflect.String, isBytes(right.typ):
+			r = asString(right)
+		default:
+			r = f.g.importName("fmt") + ".Sprint(" + right.code + ")"
+		}
+		return value{code: "(" + asString(left) + " + " + r + ")", typ: stringType}
+	}
+	kind := promotion(node, left, right)
+	return value{code: "(" + numeric(left, kind) + " " + op + " " + numeric(right, kind) + ")", typ: numericType(kind)}
+}
+
+func asString(v value) string {
+	if v.typ == stringType {
+		return v.code
+	}
+	return "string(" + v.code + ")"
+}
+
+// multiplicative compiles a multiplicative expression, see multiplicative() in package jet.
+func (f *function) multiplicative(node *jet.MultiplicativeExprNode) value {
+	left, right := f.operand(node.Left), f.operand(node.Right)
+	op := node.Op()
+	kind := promotion(node, left, right)
+	if op == "%" {
+		// the remainder isn't promoted to a float, and the remainder of a float is an int
+		kind = numericKind(left.typ)
+		if kind == reflect.Float64 {
+			kind = reflect.Int64
+		}
+	}
+	return value{code: "(" + numeric(left, kind) + " " + op + " " + numeric(right, kind) + ")", typ: numericType(kind)}
+}
+
+// numericComparative compiles a comparison of numbers, see numericComparative() in package jet.
+func (f *function) numericComparative(node *jet.NumericComparativeExprNode) value {
+	left, right := f.operand(node.Left), f.operand(node.Right)
+	kind := promotion(node, left, right)
+	return value{code: "(" + numeric(left, kind) + " " + node.Op() + " " + numeric(right, kind) + ")", typ: boolType}
+}
+
+// equality compiles == and !=, see checkEquality() in package jet.
+func (f *function) equality(node *jet.ComparativeExprNode) value {
+	left, right := f.operand(node.Left), f.operand(node.Right)
+	op := node.Op()
+	result := func(code string) value { return value{code: "(" + code + ")", typ: boolType} }
+
+	if left.typ == nil || right.typ == nil {
+		other := left
+		if left.typ == nil {
+			other = right
+		}
+		switch {
+		case other.typ == nil:
+			return value{code: strconv.FormatBool(op == "=="), typ: boolType}
+		case other.typ.Kind() != reflect.Interface:
+			// jet only considers nil interfaces equal to nil
+			errorf(node, "comparing %s with nil is only supported for values of interface types", other.typ)
+		}
+		return result(other.code + " " + op + " nil")
+	}
+
+	lk, rk := numericKind(left.typ), numericKind(right.typ)
+	switch {
+	case lk != reflect.Invalid && rk != reflect.Invalid:
+		return result(numeric(left, lk) + " " + op + " " + numeric(right, lk))
+	case left.typ.Kind() == reflect.String && right.typ.Kind() == reflect.String:
+		return result(asString(left) + " " + op + " " + asString(right))
+	case left.typ.Kind() == reflect.Bool && right.typ.Kind() == reflect.Bool:
+		return result("bool(" + left.code + ") " + op + " bool(" + right.code + ")")
+	case left.typ == right.typ && left.typ.Comparable():
+		return result(left.code + " " + op + " " + right.code)
+	}
+	errorf(node, "can't compare values of types %s and %s", left.typ, right.typ)
+	return value{}
+}
+
+func (f *function) ternary(node *jet.TernaryExprNode) value {
+	cond := f.truth(node.Boolean, f.operand(node.Boolean))
+	left, right := f.operand(node.Left), f.operand(node.Right)
+	typ := left.typ
+	switch {
+	case left.typ == right.typ:
+	case left.typ == nil && isNillable(right.typ):
+		typ = right.typ
+	case right.typ == nil && isNillable(left.typ):
+	default:
+		errorf(node, "the results of the ternary expression have different types (%s and %s)", left.typ, right.typ)
+	}
+	if typ == nil {
+		return value{code: "nil"}
+	}
+	return value{code: "func() " + f.g.typeExpr(typ) + " {\nif " + cond + " {\nreturn " + left.code + "\n}\nreturn " + right.code + "\n}()", typ: typ}
+}
+
+// truth returns the code evaluating to whether v is true, see isTrue() in package jet.
+func (f *function) truth(node jet.Node, v value) string {
+	t := v.typ
+	if t == nil {
+		return "false"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return v.code
+	case reflect.String:
+		return "(" + v.code + ` != "")`
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return "(" + v.code + " != nil)"
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			errorf(node, "the truth of %s (type %s) is only known while executing the template", node, t)
+		}
+		return "(" + v.code + " != nil)"
+	case reflect.Struct, reflect.Array:
+		if t.Comparable() {
+			return "(" + v.code + " != (" + f.g.typeExpr(t) + "{}))"
+		}
+	default:
+		if numericKind(t) != reflect.Invalid {
+			return "(" + v.code + " != 0)"
+		}
+	}
+	errorf(node, "the truth of %s (type %s) can't be compiled", node, t)
+	return ""
+}
+
+// convert returns the code converting v to a value of type to, see evaluateArgs() in package jet.
+func (f *function) convert(node jet.Node, v value, to reflect.Type) string {
+	switch {
+	case v.typ == nil:
+		if isNillable(to) {
+			return "nil"
+		}
+	case v.typ.AssignableTo(to):
+		return v.code
+	case numericKind(v.typ) != reflect.Invalid && numericKind(to) != reflect.Invalid,
+		v.typ.Kind() == reflect.String && (to.Kind() == reflect.String || isBytes(to)),
+		isBytes(v.typ) && to.Kind() == reflect.String,
+		v.typ.ConvertibleTo(to) && v.typ.Kind() == to.Kind():
+		return f.g.typeExpr(to) + "(" + v.code + ")"
+	}
+	errorf(node, "can't use %s (type %s) as %s", node, v.typ, to)
+	return ""
+}
+
+// writer is what the output of an action is written through.
+type writer struct {
+	raw    bool
+	escape string // the Go expression of the jet.SafeWriter escaping the output; "" for the default HTML escaping
+}
+
+// expr returns the Go expression of the io.Writer writing through w.
+func (w writer) expr(f *function) string {
+	switch {
+	case w.raw:
+		return "r"
+	case w.escape == "":
+		return "safeWriter{r, " + f.g.importName("text/template") + ".HTMLEscape}"
+	}
+	return "safeWriter{r, " + w.escape + "}"
+}
+
+// numbers returns the Go expression of the io.Writer numbers are written to.
+func (w writer) numbers(f *function) string {
+	if w.escape == "" {
+		return "r" // numbers don't need HTML escaping
+	}
+	return w.expr(f)
+}
+
+// write compiles writing v through w, see writeValue() in package jet and fastprinter.PrintValue().
+func (f *function) write(node jet.Node, v value, w writer) {
+	t := v.typ
+	if t == nil {
+		return // writes nothing, like an invalid value
+	}
+	fastprinter := func() string { return f.g.importName("github.com/CloudyKit/fastprinter") }
+	switch {
+	case t.Implements(rendererType):
+		errorf(node, "%s implements jet.Renderer, which can't be compiled", t)
+	case t.Kind() == reflect.Interface:
+		name := f.newName("v")
+		f.printf("if %s := %s; %s != nil {\n%s.Print(%s, %s)\n}\n", name, v.code, name, fastprinter(), w.expr(f), name)
+	case t.Implements(stringerType):
+		f.writeString(v.code+".String()", w)
+	case t.Implements(errorType):
+		f.writeString(v.code+".Error()", w)
+	case t.Kind() == reflect.Ptr:
+		name := f.newName("v")
+		f.printf("if %s := %s; %s != nil {\n", name, v.code, name)
+		f.write(node, value{code: "(*" + name + ")", typ: t.Elem(), addressable: true}, w)
+		f.printf("} else {\n")
+		f.writeString(`"<nil>"`, w)
+		f.printf("}\n")
+	case t.Kind() == reflect.String:
+		f.writeString(asString(v), w)
+	case t.Kind() == reflect.Bool:
+		f.printf("%s.PrintBool(%s, bool(%s))\n", fastprinter(), w.numbers(f), v.code)
+	case numericKind(t) == reflect.Int64:
+		f.printf("%s.PrintInt(%s, %s)\n", fastprinter(), w.numbers(f), numeric(v, reflect.Int64))
+	case numericKind(t) == reflect.Uint64:
+		f.printf("%s.PrintUint(%s, %s)\n", fastprinter(), w.numbers(f), numeric(v, reflect.Uint64))
+	case numericKind(t) == reflect.Float64:
+		f.printf("%s.PrintFloat(%s, %s)\n", fastprinter(), w.numbers(f), numeric(v, reflect.Float64))
+	case isBytes(t):
+		code := v.code
+		if t.Elem() != reflect.TypeOf(byte(0)) || t.Name() != "" {
+			code = "[]byte(" + code + ")"
+		}
+		f.printf("%s.Write(%s)\n", w.expr(f), code)
+	default:
+		f.printf("%s.Fprint(%s, %s)\n", f.g.importName("fmt"), w.expr(f), v.code)
+	}
+}
+
+func (f *function) writeString(code string, w writer) {
+	switch {
+	case w.raw:
+		f.printf("r.WriteString(%s)\n", code)
+	case w.escape == "":
+		f.printf("r.escape(%s)\n", code)
+	default:
+		f.printf("%s.WriteString(%s, %s)\n", f.g.importName("io"), w.expr(f), code)
+	}
+}
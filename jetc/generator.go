@@ -0,0 +1,251 @@
+// Package jetc generates Go code rendering the templates of a jet.Set ahead of time.
+//
+// The generated code renders templates without parsing them at startup and, as far as the
+// types of the values involved are known when generating the code, without reflection:
+// field accesses, method and function calls, arithmetic and comparisons are compiled to plain
+// Go expressions. The types are taken from the context type declared for each template, the
+// values of the Set's globals, and the built-in functions of Jet.
+//
+// A generator is usually run with go generate, from a program in the package the code is
+// generated into:
+//
+//	//go:build ignore
+//
+//	package main
+//
+//	func main() {
+//		set := jet.NewSet(jet.NewOSFileSystemLoader("./views"))
+//		set.AddGlobal("siteName", "")
+//		set.AddGlobal("formatDate", models.FormatDate)
+//
+//		err := jetc.New(set, "views").
+//			Add("/index.jet", (*models.IndexPage)(nil)).
+//			Add("/user/profile.jet", (*models.User)(nil)).
+//			WriteFile("views_gen.go")
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// For every template added, the generated package has a function like
+//
+//	func RenderUserProfile(w io.Writer, ctx *models.User) error
+//
+// Templates extending, importing and including other templates, blocks with parameters and
+// yielded content are all compiled into the same package. Global functions must be top-level
+// Go functions, which are called directly; the values of all other globals used by the templates
+// are read from the generated Globals variable, which has a field for each of them that must be
+// assigned before rendering.
+//
+// Since the generated code is statically typed, the generator rejects templates depending on
+// types only known while executing them: ranging over or calling methods on values of interface
+// types, assigning values of different types to a variable, calling a jet.Func (except for the
+// built-in len and ints), try/catch and return statements, including templates by dynamic names,
+// and blocks and included templates using variables of the template executing them. Missing map
+// keys evaluate to the zero value of the map's value type, and the output is escaped with
+// template.HTMLEscape, Jet's default.
+package jetc
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// Generator generates Go code rendering templates of a Set.
+type Generator struct {
+	set       *jet.Set
+	pkg       string
+	templates []entry
+}
+
+type entry struct {
+	path    string
+	context reflect.Type // nil if the template is executed without context
+}
+
+// New returns a Generator for templates of set, generating code for the Go package pkg.
+func New(set *jet.Set, pkg string) *Generator {
+	return &Generator{set: set, pkg: pkg}
+}
+
+// Add adds the template at templatePath, which is rendered with a context of the type of
+// context, to the templates to generate code for. A nil context declares that the template is
+// executed without context. It returns the Generator it was called on to allow for method chaining.
+func (g *Generator) Add(templatePath string, context interface{}) *Generator {
+	g.templates = append(g.templates, entry{path: templatePath, context: reflect.TypeOf(context)})
+	return g
+}
+
+// Generate writes the formatted Go source of the generated package to w.
+func (g *Generator) Generate(w io.Writer) error {
+	src, err := g.generate()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// WriteFile writes the formatted Go source of the generated package to the file filename.
+func (g *Generator) WriteFile(filename string) error {
+	src, err := g.generate()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, src, 0644)
+}
+
+func (g *Generator) generate() (src []byte, err error) {
+	gen := &generator{
+		Generator: g,
+		imports:   map[string]string{},
+		names:     map[string]bool{},
+		instances: map[string]*function{},
+		globals:   map[string]*global{},
+	}
+	for _, path := range []string{"fmt", "io", "runtime"} {
+		gen.importName(path)
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			genErr, ok := e.(*Error)
+			if !ok {
+				panic(e)
+			}
+			err = genErr
+		}
+	}()
+
+	var entries bytes.Buffer
+	renderNames := map[string]string{}
+	for _, e := range g.templates {
+		t, err := g.set.GetTemplate(e.path)
+		if err != nil {
+			return nil, err
+		}
+		name := renderFuncName(t.Name)
+		if other, ok := renderNames[name]; ok {
+			return nil, fmt.Errorf("jetc: %s and %s would both be rendered by %s", other, t.Name, name)
+		}
+		renderNames[name] = t.Name
+
+		fn := gen.template(t, e.context)
+		params := "w io.Writer"
+		args := ""
+		if e.context != nil {
+			params += ", ctx " + gen.typeExpr(e.context)
+			args = "ctx"
+		}
+		fmt.Fprintf(&entries, "\n// %s renders the template %s.\n", name, t.Name)
+		fmt.Fprintf(&entries, "func %s(%s) (err error) {\n", name, params)
+		fmt.Fprintf(&entries, "r := &renderer{w: w}\n")
+		fmt.Fprintf(&entries, "defer r.recover(%q, &err)\n", t.Name)
+		fmt.Fprintf(&entries, "r.%s(%s)\n", fn.name, args)
+		fmt.Fprintf(&entries, "return nil\n}\n")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by jetc. DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.pkg)
+	paths := make([]string, 0, len(gen.imports))
+	for path := range gen.imports {
+		paths = append(paths, path)
+	}
+	// standard library packages first, like goimports groups them
+	sort.Slice(paths, func(i, j int) bool {
+		if si, sj := isStd(paths[i]), isStd(paths[j]); si != sj {
+			return si
+		}
+		return paths[i] < paths[j]
+	})
+	for i, p := range paths {
+		if i > 0 && isStd(p) != isStd(paths[i-1]) {
+			b.WriteString("\n")
+		}
+		if name := gen.imports[p]; name != path.Base(p) {
+			fmt.Fprintf(&b, "%s %q\n", name, p)
+		} else {
+			fmt.Fprintf(&b, "%q\n", p)
+		}
+	}
+	b.WriteString(")\n")
+	b.Write(entries.Bytes())
+
+	if len(gen.globals) > 0 {
+		names := make([]string, 0, len(gen.globals))
+		for name := range gen.globals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("\n// Globals holds the values of the global variables of the Set used by the templates.\nvar Globals struct {\n")
+		for _, name := range names {
+			global := gen.globals[name]
+			fmt.Fprintf(&b, "%s %s // %s\n", global.field, gen.typeExpr(global.typ), name)
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, fn := range gen.funcs {
+		b.WriteString("\n")
+		b.Write(fn.source())
+	}
+	b.WriteString(runtimeSource)
+
+	src, err = format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("jetc: formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+func isStd(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+// renderFuncName returns the name of the function rendering the template at templatePath,
+// e.g. RenderUserProfile for /user/profile.html.jet.
+func renderFuncName(templatePath string) string {
+	name := strings.TrimSuffix(templatePath, path.Ext(templatePath))
+	if ext := path.Ext(name); ext == ".html" || ext == ".jet" {
+		name = strings.TrimSuffix(name, ext)
+	}
+	var b strings.Builder
+	b.WriteString("Render")
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Error is returned when a template can't be compiled.
+type Error struct {
+	TemplatePath string
+	Line         int
+	Message      string
+}
+
+func (e *Error) Error() string {
+	if e.TemplatePath == "" {
+		return "jetc: " + e.Message
+	}
+	return fmt.Sprintf("jetc: %s:%d: %s", e.TemplatePath, e.Line, e.Message)
+}
@@ -0,0 +1,108 @@
+package jetc
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/jetc/internal/testmodels"
+)
+
+var update = flag.Bool("update", false, "update the generated package in internal/testviews")
+
+const generatedFile = "internal/testviews/views_gen.go"
+
+func TestGenerate(t *testing.T) {
+	set := testmodels.NewSet(testmodels.NewLoader("testdata"))
+	var b bytes.Buffer
+	err := New(set, "testviews").
+		Add("/user.jet", (*testmodels.User)(nil)).
+		Add("/partials/footer.jet", (*testmodels.User)(nil)).
+		Generate(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := ioutil.WriteFile(generatedFile, b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(generatedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("%s is out of date, run go test -update", generatedFile)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	loader := jet.NewInMemLoader()
+	loader.Set("/ctx.jet", "{{ .Name }}")
+	loader.Set("/iface.jet", "{{ range .Meta }}{{ end }}")
+	loader.Set("/try.jet", "{{ try }}{{ end }}")
+	loader.Set("/include.jet", `{{ include .Name }}`)
+	loader.Set("/field.jet", "{{ .Missing }}")
+	loader.Set("/assign.jet", `{{ a := 1 }}{{ a = "one" }}`)
+	loader.Set("/func.jet", "{{ fn() }}")
+	loader.Set("/unexported.jet", "{{ _x }}")
+	loader.Set("/collision.jet", "{{ title }}{{ Title }}")
+	set := jet.NewSet(loader)
+	set.AddGlobal("fn", jet.Func(func(a jet.Arguments) reflect.Value { return reflect.Value{} }))
+	set.AddGlobal("_x", 1)
+	set.AddGlobal("title", "a")
+	set.AddGlobal("Title", "b")
+
+	ctx := (*testmodels.User)(nil)
+	tests := []struct {
+		path    string
+		context interface{}
+		err     string
+	}{
+		{"/ctx.jet", nil, "jetc: /ctx.jet:1: /ctx.jet is executed without context"},
+		{"/iface.jet", ctx, "jetc: /iface.jet:1: value .Meta (type interface {}) is not rangeable"},
+		{"/try.jet", nil, "jetc: /try.jet:1: try statements are not supported"},
+		{"/include.jet", ctx, "jetc: /include.jet:1: templates can only be included by constant names"},
+		{"/field.jet", ctx, "jetc: /field.jet:1: there is no field or method 'Missing' in testmodels.User"},
+		{"/assign.jet", nil, `jetc: /assign.jet:1: can't use a (type string) as float64`},
+		{"/func.jet", nil, "jetc: /func.jet:1: the global fn is a jet.Func, which can't be compiled"},
+		{"/unexported.jet", nil, "jetc: /unexported.jet:1: the global _x can't be stored in an exported field of Globals"},
+		{"/collision.jet", nil, "jetc: /collision.jet:1: the globals Title and title would both be stored in Globals.Title"},
+	}
+	for _, test := range tests {
+		err := New(set, "views").Add(test.path, test.context).Generate(ioutil.Discard)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: got error %v, want %s", test.path, err, test.err)
+		}
+	}
+}
+
+func TestGenerateNonASCIIGlobal(t *testing.T) {
+	loader := jet.NewInMemLoader()
+	loader.Set("/greeting.jet", "{{ émoji }}")
+	set := jet.NewSet(loader)
+	set.AddGlobal("émoji", "☺")
+	var b bytes.Buffer
+	if err := New(set, "views").Add("/greeting.jet", nil).Generate(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b.Bytes(), []byte("Globals.Émoji")) {
+		t.Errorf("expected the global to be stored in Globals.Émoji, got:\n%s", b.Bytes())
+	}
+}
+
+func TestRenderFuncName(t *testing.T) {
+	for path, want := range map[string]string{
+		"/index.jet":             "RenderIndex",
+		"/user/profile.html.jet": "RenderUserProfile",
+		"/user/edit-form.html":   "RenderUserEditForm",
+	} {
+		if got := renderFuncName(path); got != want {
+			t.Errorf("renderFuncName(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Package testmodels holds the types and globals the templates in jetc/testdata are rendered with.
+package testmodels
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/loaders/mount"
+)
+
+type User struct {
+	Name    string
+	Email   string
+	Bio     string
+	Age     int
+	Score   float64
+	Admin   bool
+	Tags    []string
+	Links   map[string]string
+	Friends []*User
+	Best    *User
+	Meta    interface{}
+}
+
+func (u *User) Greeting(s string) string {
+	return s + ", " + u.Name
+}
+
+func FormatYear(year int) string {
+	return "© " + strconv.Itoa(year)
+}
+
+// NewLoader returns the Loader of the templates in the testdata directory dir: the views, and the shared
+// templates in the namespace "shared".
+func NewLoader(dir string) jet.Loader {
+	l := mount.NewLoader()
+	l.Mount("/", jet.NewOSFileSystemLoader(filepath.Join(dir, "views")))
+	l.Mount("/shared/", jet.NewOSFileSystemLoader(filepath.Join(dir, "shared")))
+	return l
+}
+
+// NewSet returns the Set the templates are executed and compiled with.
+func NewSet(loader jet.Loader) *jet.Set {
+	set := jet.NewSet(loader)
+	set.AddGlobal("siteName", "Example")
+	set.AddGlobal("formatYear", FormatYear)
+	return set
+}
@@ -0,0 +1,297 @@
+// Code generated by jetc. DO NOT EDIT.
+
+package testviews
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/CloudyKit/fastprinter"
+	"github.com/CloudyKit/jet/v6/jetc/internal/testmodels"
+)
+
+// RenderUser renders the template /user.jet.
+func RenderUser(w io.Writer, ctx *testmodels.User) (err error) {
+	r := &renderer{w: w}
+	defer r.recover("/user.jet", &err)
+	r.template1(ctx)
+	return nil
+}
+
+// RenderPartialsFooter renders the template /partials/footer.jet.
+func RenderPartialsFooter(w io.Writer, ctx *testmodels.User) (err error) {
+	r := &renderer{w: w}
+	defer r.recover("/partials/footer.jet", &err)
+	r.template6(ctx)
+	return nil
+}
+
+// Globals holds the values of the global variables of the Set used by the templates.
+var Globals struct {
+	SiteName string // siteName
+}
+
+// template1 renders /user.jet.
+func (r *renderer) template1(ctx *testmodels.User) {
+	r.WriteString("<!DOCTYPE html>\n<html>\n<head><title>")
+	{
+		r.block2(ctx)
+	}
+	r.WriteString("</title></head>\n<body>\n")
+	{
+		r.block3(ctx)
+	}
+	r.WriteString("\n</body>\n</html>\n")
+}
+
+// block2 renders the block title of /user.jet.
+func (r *renderer) block2(ctx *testmodels.User) {
+	r.escape(ctx.Name)
+	r.WriteString(" - ")
+	r.escape(Globals.SiteName)
+}
+
+// block3 renders the block body of /user.jet.
+func (r *renderer) block3(ctx *testmodels.User) {
+	r.WriteString("\n<h1>")
+	r.escape(strings.ToUpper(ctx.Name))
+	r.WriteString("</h1>\n")
+	if ctx.Admin {
+		r.WriteString("<p>admin</p>")
+	} else {
+		if float64(len(ctx.Tags)) > float64(1) {
+			r.WriteString("<p>tagged</p>")
+		} else {
+			r.WriteString("<p>user</p>")
+		}
+	}
+	r.WriteString("\n<p>Age next year: ")
+	fastprinter.PrintFloat(r, (float64(ctx.Age) + float64(1)))
+	r.WriteString(", score: ")
+	fastprinter.PrintFloat(r, (ctx.Score * float64(2)))
+	r.WriteString(", ")
+	fastprinter.PrintInt(r, (int64(ctx.Age) % int64(float64(7))))
+	r.WriteString(", ")
+	r.escape(func() string {
+		if ctx.Admin {
+			return "yes"
+		}
+		return "no"
+	}())
+	r.WriteString("</p>\n")
+	{
+		label_1 := ctx.Email
+		kind_2 := "info"
+		r.block4(ctx, label_1, kind_2)
+	}
+	r.WriteString(" ")
+	{
+		label_3 := "new"
+		kind_4 := "warn"
+		r.block4(ctx, label_3, kind_4)
+	}
+	r.WriteString("\n<ul>")
+	{
+		empty5 := true
+		for i6, v7 := range ctx.Tags {
+			_ = i6
+			_ = v7
+			empty5 = false
+			i_8 := i6
+			_ = i_8
+			tag_9 := v7
+			_ = tag_9
+			r.WriteString("<li>")
+			fastprinter.PrintInt(r, int64(i_8))
+			r.WriteString("=")
+			r.escape(tag_9)
+			r.WriteString("</li>")
+		}
+		if empty5 {
+			r.WriteString("<li>no tags</li>")
+		}
+	}
+	r.WriteString("</ul>\n")
+	friends_10 := float64(0)
+	_ = friends_10
+	r.WriteString("\n<ul>")
+	{
+		for i11, v12 := range ctx.Friends {
+			_ = i11
+			_ = v12
+			friends_10 = (friends_10 + float64(1))
+			r.WriteString("<li>")
+			r.escape(v12.Name)
+			r.WriteString(": ")
+			r.escape(v12.Greeting("hi"))
+			r.WriteString("</li>")
+		}
+	}
+	r.WriteString("</ul>\n<p>")
+	fastprinter.PrintFloat(r, friends_10)
+	r.WriteString(" friends")
+	if ctx.Best != nil {
+		r.WriteString(", best: ")
+		r.escape(ctx.Best.Name)
+	}
+	r.WriteString("</p>\n")
+	{
+		title_13 := "Bio"
+		r.block5(ctx, title_13, func(ctx14 *testmodels.User) {
+			r.escape(ctx14.Bio)
+		})
+	}
+	r.WriteString("\n")
+	{
+		for i15, v16 := range ctx.Links {
+			_ = i15
+			_ = v16
+			k_17 := i15
+			_ = k_17
+			v_18 := v16
+			_ = v_18
+			r.WriteString("<a href=\"")
+			r.escape(url.QueryEscape(v_18))
+			r.WriteString("\">")
+			r.escape(k_17)
+			r.WriteString("</a>")
+		}
+	}
+	r.WriteString("\n")
+	r.template6(ctx)
+	r.WriteString("\n")
+}
+
+// block4 renders the block badge of /macros.jet.
+func (r *renderer) block4(ctx *testmodels.User, label_1 string, kind_2 string) {
+	r.WriteString("<span class=\"")
+	r.escape(kind_2)
+	r.WriteString("\">")
+	r.escape(label_1)
+	r.WriteString("</span>")
+}
+
+// block5 renders the block card of /macros.jet.
+func (r *renderer) block5(ctx *testmodels.User, title_1 string, content func(*testmodels.User)) {
+	r.WriteString("<div><h2>")
+	r.escape(title_1)
+	r.WriteString("</h2>")
+	if content != nil {
+		content(ctx)
+	}
+	r.WriteString("</div>")
+}
+
+// template6 renders /partials/footer.jet.
+func (r *renderer) template6(ctx *testmodels.User) {
+	r.WriteString("<footer>")
+	r.escape(testmodels.FormatYear(int(float64(2024))))
+	r.WriteString(", ")
+	fastprinter.PrintInt(r, int64(len(ctx.Tags)))
+	r.WriteString(" tags")
+	r.WriteString((("<b>" + ctx.Name) + "</b>"))
+	r.WriteString(" ")
+	{
+		from3, to4 := int64(float64(0)), int64(float64(3))
+		if to4 <= from3 {
+			panic("invalid range for ints ranger: 'from' must be smaller than 'to'")
+		}
+		for i1, v2 := 0, from3; v2 < to4; i1, v2 = i1+1, v2+1 {
+			_ = v2
+			i_5 := i1
+			_ = i_5
+			fastprinter.PrintInt(r, int64(i_5))
+		}
+	}
+	r.WriteString(" ")
+	r.template7(ctx)
+	r.WriteString("</footer>\n")
+}
+
+// template7 renders /shared/copyright.jet.
+func (r *renderer) template7(ctx *testmodels.User) {
+	r.WriteString("<small>")
+	r.escape(Globals.SiteName)
+	r.WriteString(" ")
+	r.escape(testmodels.FormatYear(int(float64(2024))))
+	r.WriteString("</small>")
+}
+
+// renderer writes the output of a template, keeping the first error returned by the writer.
+type renderer struct {
+	w   io.Writer
+	err error
+}
+
+func (r *renderer) Write(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.w.Write(p)
+	r.err = err
+	return n, err
+}
+
+func (r *renderer) WriteString(s string) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := io.WriteString(r.w, s)
+	r.err = err
+	return n, err
+}
+
+// escape writes s escaped like template.HTMLEscape does.
+func (r *renderer) escape(s string) {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		var esc string
+		switch s[i] {
+		case 0:
+			esc = "�"
+		case '"':
+			esc = "&#34;"
+		case '\'':
+			esc = "&#39;"
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		default:
+			continue
+		}
+		r.WriteString(s[last:i])
+		r.WriteString(esc)
+		last = i + 1
+	}
+	r.WriteString(s[last:])
+}
+
+// recover sets *err to the error that made rendering the template name panic, or to the first write error.
+// Like jet.Template.Execute, it doesn't recover from runtime errors.
+func (r *renderer) recover(name string, err *error) {
+	if p := recover(); p != nil {
+		if _, ok := p.(runtime.Error); ok {
+			panic(p)
+		}
+		*err = fmt.Errorf("jet: rendering %s: %v", name, p)
+		return
+	}
+	*err = r.err
+}
+
+// safeWriter writes through a jet.SafeWriter.
+type safeWriter struct {
+	r      *renderer
+	escape func(io.Writer, []byte)
+}
+
+func (w safeWriter) Write(p []byte) (int, error) {
+	w.escape(w.r, p)
+	return len(p), w.r.err
+}
@@ -0,0 +1,84 @@
+package testviews
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/jetc/internal/testmodels"
+)
+
+func init() {
+	Globals.SiteName = "Example"
+}
+
+var users = []*testmodels.User{
+	{},
+	{
+		Name:  `Ann <"Admin">`,
+		Email: "ann@example.com",
+		Bio:   "Likes & dislikes",
+		Age:   41,
+		Score: 2.25,
+		Admin: true,
+		Tags:  []string{"a", "<b>"},
+		Links: map[string]string{"home": "https://example.com/?q=a b"},
+		Friends: []*testmodels.User{
+			{Name: "Bob"},
+			{Name: "Carl's"},
+		},
+		Best: &testmodels.User{Name: "Bob"},
+	},
+	{Name: "Dan", Tags: []string{"x", "y", "z"}},
+}
+
+// TestRender checks that the generated code renders the same output as executing the templates.
+func TestRender(t *testing.T) {
+	set := testmodels.NewSet(testmodels.NewLoader("../../testdata"))
+	for _, test := range []struct {
+		path   string
+		render func(*bytes.Buffer, *testmodels.User) error
+	}{
+		{"/user.jet", func(b *bytes.Buffer, u *testmodels.User) error { return RenderUser(b, u) }},
+		{"/partials/footer.jet", func(b *bytes.Buffer, u *testmodels.User) error { return RenderPartialsFooter(b, u) }},
+	} {
+		tmpl, err := set.GetTemplate(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, u := range users {
+			var want, got bytes.Buffer
+			if err := tmpl.Execute(&want, nil, u); err != nil {
+				t.Fatal(err)
+			}
+			if err := test.render(&got, u); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("%s with user %d:\ngot:\n%s\nwant:\n%s", test.path, i, got.String(), want.String())
+			}
+		}
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		RenderUser(&buf, users[1])
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	set := testmodels.NewSet(jet.NewOSFileSystemLoader("../../testdata/views"))
+	tmpl, err := set.GetTemplate("/user.jet")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		tmpl.Execute(&buf, nil, users[1])
+	}
+}
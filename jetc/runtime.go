@@ -0,0 +1,80 @@
+package jetc
+
+// runtimeSource is added to every generated package.
+const runtimeSource = `
+// renderer writes the output of a template, keeping the first error returned by the writer.
+type renderer struct {
+	w   io.Writer
+	err error
+}
+
+func (r *renderer) Write(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.w.Write(p)
+	r.err = err
+	return n, err
+}
+
+func (r *renderer) WriteString(s string) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := io.WriteString(r.w, s)
+	r.err = err
+	return n, err
+}
+
+// escape writes s escaped like template.HTMLEscape does.
+func (r *renderer) escape(s string) {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		var esc string
+		switch s[i] {
+		case 0:
+			esc = "�"
+		case '"':
+			esc = "&#34;"
+		case '\'':
+			esc = "&#39;"
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		default:
+			continue
+		}
+		r.WriteString(s[last:i])
+		r.WriteString(esc)
+		last = i + 1
+	}
+	r.WriteString(s[last:])
+}
+
+// recover sets *err to the error that made rendering the template name panic, or to the first write error.
+// Like jet.Template.Execute, it doesn't recover from runtime errors.
+func (r *renderer) recover(name string, err *error) {
+	if p := recover(); p != nil {
+		if _, ok := p.(runtime.Error); ok {
+			panic(p)
+		}
+		*err = fmt.Errorf("jet: rendering %s: %v", name, p)
+		return
+	}
+	*err = r.err
+}
+
+// safeWriter writes through a jet.SafeWriter.
+type safeWriter struct {
+	r      *renderer
+	escape func(io.Writer, []byte)
+}
+
+func (w safeWriter) Write(p []byte) (int, error) {
+	w.escape(w.r, p)
+	return len(p), w.r.err
+}
+`
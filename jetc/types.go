@@ -0,0 +1,236 @@
+package jetc
+
+import (
+	"fmt"
+	"go/token"
+	"path"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var (
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType   = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	rendererType   = reflect.TypeOf((*jet.Renderer)(nil)).Elem()
+	rangerType     = reflect.TypeOf((*jet.Ranger)(nil)).Elem()
+	funcType       = reflect.TypeOf(jet.Func(nil))
+	safeWriterType = reflect.TypeOf(jet.SafeWriter(nil))
+	boolType       = reflect.TypeOf(false)
+	intType        = reflect.TypeOf(0)
+	int64Type      = reflect.TypeOf(int64(0))
+	uint64Type     = reflect.TypeOf(uint64(0))
+	float64Type    = reflect.TypeOf(float64(0))
+	stringType     = reflect.TypeOf("")
+)
+
+// importName returns the name the package at importPath is imported as.
+func (g *generator) importName(importPath string) string {
+	if name, ok := g.imports[importPath]; ok {
+		return name
+	}
+	base := path.Base(importPath)
+	if isMajorVersion(base) && path.Dir(importPath) != "." {
+		base = path.Base(path.Dir(importPath))
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, base)
+	if name == "" || unicode.IsDigit(rune(name[0])) || token.Lookup(name).IsKeyword() {
+		name = "_" + name
+	}
+	for candidate, i := name, 2; ; i++ {
+		if !g.names[candidate] && !reservedNames[candidate] {
+			name = candidate
+			break
+		}
+		candidate = name + "_" + strconv.Itoa(i)
+	}
+	g.imports[importPath] = name
+	g.names[name] = true
+	return name
+}
+
+// reservedNames are the top-level names of the generated package, which can't be used for imports.
+var reservedNames = map[string]bool{"renderer": true, "safeWriter": true, "Globals": true}
+
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
+
+// typeExpr returns the Go expression denoting the type t.
+func (g *generator) typeExpr(t reflect.Type) string {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name()
+		}
+		if !token.IsExported(t.Name()) || strings.ContainsAny(t.Name(), "[]") {
+			panic(&Error{Message: fmt.Sprintf("type %s can't be referred to from another package", t)})
+		}
+		if t.PkgPath() == "main" {
+			panic(&Error{Message: fmt.Sprintf("type %s of package main can't be imported", t)})
+		}
+		return g.importName(t.PkgPath()) + "." + t.Name()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.typeExpr(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeExpr(t.Elem())
+	case reflect.Array:
+		return "[" + strconv.Itoa(t.Len()) + "]" + g.typeExpr(t.Elem())
+	case reflect.Map:
+		return "map[" + g.typeExpr(t.Key()) + "]" + g.typeExpr(t.Elem())
+	case reflect.Chan:
+		switch t.ChanDir() {
+		case reflect.RecvDir:
+			return "<-chan " + g.typeExpr(t.Elem())
+		case reflect.SendDir:
+			return "chan<- " + g.typeExpr(t.Elem())
+		}
+		return "chan " + g.typeExpr(t.Elem())
+	case reflect.Func:
+		return "func" + g.signature(t, 0)
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "interface{}"
+		}
+		var methods []string
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			if m.PkgPath != "" {
+				panic(&Error{Message: fmt.Sprintf("type %s has unexported methods", t)})
+			}
+			methods = append(methods, m.Name+g.signature(m.Type, 0))
+		}
+		return "interface{ " + strings.Join(methods, "; ") + " }"
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				panic(&Error{Message: fmt.Sprintf("type %s has unexported fields", t)})
+			}
+			field := g.typeExpr(f.Type)
+			if !f.Anonymous {
+				field = f.Name + " " + field
+			}
+			if f.Tag != "" {
+				field += " " + strconv.Quote(string(f.Tag))
+			}
+			fields = append(fields, field)
+		}
+		return "struct{ " + strings.Join(fields, "; ") + " }"
+	}
+	panic(&Error{Message: fmt.Sprintf("type %s is not supported", t)})
+}
+
+// signature returns the parameters and results of the function type t, skipping the first skip parameters.
+func (g *generator) signature(t reflect.Type, skip int) string {
+	var in []string
+	for i := skip; i < t.NumIn(); i++ {
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = append(in, "..."+g.typeExpr(t.In(i).Elem()))
+		} else {
+			in = append(in, g.typeExpr(t.In(i)))
+		}
+	}
+	s := "(" + strings.Join(in, ", ") + ")"
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		s += " " + g.typeExpr(t.Out(0))
+	default:
+		var out []string
+		for i := 0; i < t.NumOut(); i++ {
+			out = append(out, g.typeExpr(t.Out(i)))
+		}
+		s += " (" + strings.Join(out, ", ") + ")"
+	}
+	return s
+}
+
+// funcExpr returns the Go expression referring to the top-level function fn.
+func (g *generator) funcExpr(fn reflect.Value) (string, bool) {
+	if fn.IsNil() {
+		return "", false
+	}
+	f := runtime.FuncForPC(fn.Pointer())
+	if f == nil {
+		return "", false
+	}
+	// e.g. "strings.ToLower" or "github.com/CloudyKit/jet/v6/jetc%2etest.Format"
+	full := f.Name()
+	slash := strings.LastIndex(full, "/")
+	dot := strings.Index(full[slash+1:], ".")
+	if dot < 0 {
+		return "", false
+	}
+	pkgPath := strings.Replace(full[:slash+1+dot], "%2e", ".", -1)
+	name := full[slash+1+dot+1:]
+	if pkgPath == "main" || !token.IsIdentifier(name) || !token.IsExported(name) {
+		return "", false
+	}
+	return g.importName(pkgPath) + "." + name, true
+}
+
+// numericKind returns the kind of the values jet computes with when doing arithmetic
+// with a value of type t: reflect.Int64, reflect.Uint64, reflect.Float64 or reflect.Invalid if
+// t isn't numeric.
+func numericKind(t reflect.Type) reflect.Kind {
+	if t == nil {
+		return reflect.Invalid
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int64
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.Uint64
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	}
+	return reflect.Invalid
+}
+
+func numericType(kind reflect.Kind) reflect.Type {
+	switch kind {
+	case reflect.Int64:
+		return int64Type
+	case reflect.Uint64:
+		return uint64Type
+	}
+	return float64Type
+}
+
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// isNillable reports whether values of type t can be compared to nil.
+func isNillable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// typeKey returns a string identifying t, for keys of function instances.
+func typeKey(t reflect.Type) string {
+	if t == nil {
+		return "-"
+	}
+	return t.PkgPath() + "." + t.String()
+}
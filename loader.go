@@ -16,12 +16,16 @@ package jet
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -52,13 +56,60 @@ type Loader interface {
 	Open(templatePath string) (io.ReadCloser, error)
 }
 
+// Lister is an optional interface for Loaders that can enumerate their templates, e.g. to preload them all
+// (see Set.PreloadAll()).
+type Lister interface {
+	// List returns the paths of all templates in the directory at dirPath and its subdirectories, in lexical
+	// order. The paths are absolute, slash-delimited and can be passed to Exists() and Open() as they are.
+	// List("/") lists all templates of the Loader.
+	List(dirPath string) ([]string, error)
+}
+
+// Versioner is an optional interface for Loaders that can tell whether a template changed without reading it.
+// A Set records the version of every template it loads, which allows a VersionedCache to notice when a
+// template changed since it was parsed.
+type Versioner interface {
+	// Version returns the current version of the template at templatePath, e.g. derived from its modification
+	// time. The version must change whenever the template's contents change. Version returns an error if the
+	// template doesn't exist.
+	Version(templatePath string) (string, error)
+}
+
+// Layered is an optional interface for Loaders stacking layers of templates, where a template of a higher
+// layer overrides the template at the same path in the lower layers, like a theme overriding the default
+// templates. An overriding template can extend the template it overrides with {{ extends parent }}.
+type Layered interface {
+	// Parent returns the path under which the template overridden by the template at templatePath can be
+	// loaded, i.e. the path of the template at the same path in the next lower layer having one. ok is false
+	// if no lower layer has a template at that path.
+	Parent(templatePath string) (parentPath string, ok bool)
+}
+
+// Namespaced is an optional interface for Loaders serving templates of several namespaces, e.g. of different
+// Go modules. Templates refer to the templates of a namespace as "@namespace/path" in extends, import and
+// include statements and in Set.GetTemplate(), regardless of their own directory.
+type Namespaced interface {
+	// Namespace returns the directory holding the templates of the namespace called name (a single path
+	// element). ok is false if there's no such namespace.
+	Namespace(name string) (dir string, ok bool)
+}
+
 // OSFileSystemLoader implements Loader interface using OS file system (os.File).
 type OSFileSystemLoader struct {
-	dir string
+	dir      string
+	confined bool // see NewConfinedOSFileSystemLoader()
 }
 
-// compile time check that we implement Loader
-var _ Loader = (*OSFileSystemLoader)(nil)
+// compile time check that we implement Loader and Lister
+var (
+	_ Loader    = (*OSFileSystemLoader)(nil)
+	_ Lister    = (*OSFileSystemLoader)(nil)
+	_ Versioner = (*OSFileSystemLoader)(nil)
+)
+
+// ErrOutsideDir is the error of a confined OSFileSystemLoader (see NewConfinedOSFileSystemLoader()) for a
+// template path leading outside of the loader's directory.
+var ErrOutsideDir = errors.New("path leads outside of the loader's directory")
 
 // NewOSFileSystemLoader returns an initialized OSFileSystemLoader.
 func NewOSFileSystemLoader(dirPath string) *OSFileSystemLoader {
@@ -67,11 +118,55 @@ func NewOSFileSystemLoader(dirPath string) *OSFileSystemLoader {
 	}
 }
 
+// NewConfinedOSFileSystemLoader returns an OSFileSystemLoader that only serves files inside the directory at
+// dirPath: a template path leading outside of it, after cleaning the path (as in "/../secret.txt") and
+// resolving the symbolic links on it (like a link to "/etc"), is rejected with ErrOutsideDir. Use it when
+// template paths may come from untrusted input, e.g. request parameters passed to includeIfExists.
+func NewConfinedOSFileSystemLoader(dirPath string) *OSFileSystemLoader {
+	return &OSFileSystemLoader{
+		dir:      filepath.FromSlash(dirPath),
+		confined: true,
+	}
+}
+
+// file returns the path of the file at templatePath, converted to a file path using the OS's path separator
+// and joined with the loader's directory path. A confined loader makes sure the file is inside its directory.
+func (l *OSFileSystemLoader) file(op, templatePath string) (string, error) {
+	file := filepath.Join(l.dir, filepath.FromSlash(templatePath))
+	if !l.confined {
+		return file, nil
+	}
+	if !isInside(l.dir, file) {
+		return "", &os.PathError{Op: op, Path: templatePath, Err: ErrOutsideDir}
+	}
+	resolved, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(l.dir)
+	if err != nil {
+		return "", err
+	}
+	if !isInside(dir, resolved) {
+		return "", &os.PathError{Op: op, Path: templatePath, Err: ErrOutsideDir}
+	}
+	return resolved, nil
+}
+
+// isInside reports whether file is dir or inside it, without resolving symbolic links.
+func isInside(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
 // Exists returns true if a file is found under the template path after converting it to a file path
 // using the OS's path seperator and joining it with the loader's directory path.
 func (l *OSFileSystemLoader) Exists(templatePath string) bool {
-	templatePath = filepath.Join(l.dir, filepath.FromSlash(templatePath))
-	stat, err := os.Stat(templatePath)
+	file, err := l.file("stat", templatePath)
+	if err != nil {
+		return false
+	}
+	stat, err := os.Stat(file)
 	if err == nil && !stat.IsDir() {
 		return true
 	}
@@ -80,7 +175,62 @@ func (l *OSFileSystemLoader) Exists(templatePath string) bool {
 
 // Open returns the result of `os.Open()` on the file located using the same logic as Exists().
 func (l *OSFileSystemLoader) Open(templatePath string) (io.ReadCloser, error) {
-	return os.Open(filepath.Join(l.dir, filepath.FromSlash(templatePath)))
+	file, err := l.file("open", templatePath)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(file)
+}
+
+// Version returns the modification time and size of the file found using the same logic as Exists().
+func (l *OSFileSystemLoader) Version(templatePath string) (string, error) {
+	file, err := l.file("stat", templatePath)
+	if err != nil {
+		return "", err
+	}
+	stat, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	return FileVersion(stat), nil
+}
+
+// FileVersion returns a version of the file described by info for implementations of Versioner, made up of the
+// file's modification time and size.
+func FileVersion(info os.FileInfo) string {
+	return strconv.FormatInt(info.ModTime().UnixNano(), 10) + ":" + strconv.FormatInt(info.Size(), 10)
+}
+
+// List returns the paths of all files in the directory at dirPath (relative to the loader's directory) and
+// its subdirectories. A confined loader leaves out the files it wouldn't serve.
+func (l *OSFileSystemLoader) List(dirPath string) ([]string, error) {
+	dir := filepath.Join(l.dir, filepath.FromSlash(dirPath))
+	if l.confined && !isInside(l.dir, dir) {
+		return nil, &os.PathError{Op: "list", Path: dirPath, Err: ErrOutsideDir}
+	}
+	var templates []string
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(l.dir, file)
+		if err != nil {
+			return err
+		}
+		templatePath := path.Join("/", filepath.ToSlash(rel))
+		if l.confined {
+			if _, err := l.file("list", templatePath); err != nil {
+				return nil
+			}
+		}
+		templates = append(templates, templatePath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(templates)
+	return templates, nil
 }
 
 // InMemLoader is a simple in-memory loader storing template contents in a simple map.
@@ -88,17 +238,24 @@ func (l *OSFileSystemLoader) Open(templatePath string) (io.ReadCloser, error) {
 // turning it into an absolute path by prepending a "/" if neccessary, and cleaning it (see path.Clean()).
 // It is safe for concurrent use.
 type InMemLoader struct {
-	lock  sync.RWMutex
-	files map[string][]byte
+	lock     sync.RWMutex
+	files    map[string][]byte
+	versions map[string]uint64 // version of each template, see Version()
+	version  uint64            // number of calls to Set()
 }
 
-// compile time check that we implement Loader
-var _ Loader = (*InMemLoader)(nil)
+// compile time check that we implement Loader and Lister
+var (
+	_ Loader    = (*InMemLoader)(nil)
+	_ Lister    = (*InMemLoader)(nil)
+	_ Versioner = (*InMemLoader)(nil)
+)
 
 // NewInMemLoader return a new InMemLoader.
 func NewInMemLoader() *InMemLoader {
 	return &InMemLoader{
-		files: map[string][]byte{},
+		files:    map[string][]byte{},
+		versions: map[string]uint64{},
 	}
 }
 
@@ -129,12 +286,37 @@ func (l *InMemLoader) Exists(templatePath string) bool {
 	return ok
 }
 
+// List returns the paths of all templates added under the directory at dirPath. Like OSFileSystemLoader.List(),
+// it returns an error wrapping os.ErrNotExist if no template was added under dirPath, unless dirPath is "/".
+func (l *InMemLoader) List(dirPath string) ([]string, error) {
+	dir := l.normalize(dirPath)
+	prefix := dir
+	if prefix != "/" {
+		prefix += "/"
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	var templates []string
+	for templatePath := range l.files {
+		if strings.HasPrefix(templatePath, prefix) {
+			templates = append(templates, templatePath)
+		}
+	}
+	if templates == nil && dir != "/" {
+		return nil, &os.PathError{Op: "list", Path: dir, Err: os.ErrNotExist}
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
+
 // Set adds a template to the loader.
 func (l *InMemLoader) Set(templatePath, contents string) {
 	templatePath = l.normalize(templatePath)
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	l.files[templatePath] = []byte(contents)
+	l.version++
+	l.versions[templatePath] = l.version
 }
 
 // Delete removes whatever contents are stored under the given path.
@@ -143,4 +325,17 @@ func (l *InMemLoader) Delete(templatePath string) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	delete(l.files, templatePath)
+	delete(l.versions, templatePath)
+}
+
+// Version returns a version of the template that changes on every call to Set() for its path.
+func (l *InMemLoader) Version(templatePath string) (string, error) {
+	templatePath = l.normalize(templatePath)
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	version, ok := l.versions[templatePath]
+	if !ok {
+		return "", fmt.Errorf("%s does not exist", templatePath)
+	}
+	return strconv.FormatUint(version, 10), nil
 }
@@ -0,0 +1,217 @@
+package jet
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOSFileSystemLoaderList(t *testing.T) {
+	l := NewOSFileSystemLoader("./testData/resolve")
+	tests := map[string][]string{
+		"/":    {"/extension.jet.html", "/simple", "/simple.jet", "/sub/extend", "/sub/subextend"},
+		"sub":  {"/sub/extend", "/sub/subextend"},
+		"/sub": {"/sub/extend", "/sub/subextend"},
+	}
+	for dir, expected := range tests {
+		templates, err := l.List(dir)
+		if err != nil {
+			t.Errorf("List(%q): %v", dir, err)
+			continue
+		}
+		if !reflect.DeepEqual(templates, expected) {
+			t.Errorf("List(%q): expected %v, got %v", dir, expected, templates)
+		}
+		for _, templatePath := range templates {
+			if !l.Exists(templatePath) {
+				t.Errorf("List(%q) returned %s, which doesn't exist", dir, templatePath)
+			}
+		}
+	}
+	if _, err := l.List("/missing"); err == nil {
+		t.Errorf("expected an error listing a missing directory")
+	}
+}
+
+func TestInMemLoaderList(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("index.jet", "")
+	l.Set("/views/a.jet", "")
+	l.Set("/views/sub/b.jet", "")
+	l.Set("/viewsmore/c.jet", "")
+	tests := map[string][]string{
+		"/":       {"/index.jet", "/views/a.jet", "/views/sub/b.jet", "/viewsmore/c.jet"},
+		"views":   {"/views/a.jet", "/views/sub/b.jet"},
+		"/views/": {"/views/a.jet", "/views/sub/b.jet"},
+	}
+	for dir, expected := range tests {
+		templates, err := l.List(dir)
+		if err != nil {
+			t.Errorf("List(%q): %v", dir, err)
+			continue
+		}
+		if !reflect.DeepEqual(templates, expected) {
+			t.Errorf("List(%q): expected %v, got %v", dir, expected, templates)
+		}
+	}
+	if _, err := l.List("/none"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("List(\"/none\"): expected os.ErrNotExist, got %v", err)
+	}
+	if templates, err := NewInMemLoader().List("/"); err != nil || templates != nil {
+		t.Errorf("List(\"/\") of an empty loader: expected no templates and no error, got %v, %v", templates, err)
+	}
+}
+
+func TestOSFileSystemLoaderVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jet-version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "index.jet")
+	if err := ioutil.WriteFile(file, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewOSFileSystemLoader(dir)
+	v1, err := l.Version("/index.jet")
+	if err != nil {
+		t.Fatalf("unexpected error from Version: %v", err)
+	}
+	if v, _ := l.Version("/index.jet"); v != v1 {
+		t.Errorf("version of an unchanged file changed from %q to %q", v1, v)
+	}
+	modTime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if v2, _ := l.Version("/index.jet"); v2 == v1 {
+		t.Errorf("version didn't change with the modification time")
+	}
+	if _, err := l.Version("/missing.jet"); !os.IsNotExist(err) {
+		t.Errorf("expected a not-exist error for a missing file, got %v", err)
+	}
+}
+
+func TestInMemLoaderVersion(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/a.jet", "a")
+	l.Set("/b.jet", "b")
+	a1, _ := l.Version("a.jet")
+	b1, _ := l.Version("/b.jet")
+	l.Set("/a.jet", "a")
+	a2, _ := l.Version("/a.jet")
+	b2, _ := l.Version("/b.jet")
+	if a1 == a2 || b1 != b2 {
+		t.Errorf("expected only the version of /a.jet to change, got %q -> %q and %q -> %q", a1, a2, b1, b2)
+	}
+	l.Delete("/a.jet")
+	if _, err := l.Version("/a.jet"); err == nil {
+		t.Errorf("expected an error for a deleted template")
+	}
+}
+
+func TestConfinedOSFileSystemLoader(t *testing.T) {
+	root, err := ioutil.TempDir("", "jet-confined")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "views")
+	files := map[string]string{
+		filepath.Join(root, "secret.txt"):        "secret",
+		filepath.Join(dir, "index.jet"):          "index",
+		filepath.Join(dir, "sub", "partial.jet"): "partial",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(dir, "link-out.jet"): filepath.Join(root, "secret.txt"),
+		filepath.Join(dir, "link-up"):      root,
+		filepath.Join(dir, "link-in.jet"):  "index.jet",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("creating symbolic links: %v", err)
+		}
+	}
+
+	l := NewConfinedOSFileSystemLoader(dir)
+	tests := map[string]string{
+		"/index.jet":                   "index",
+		"index.jet":                    "index",
+		"/sub/../index.jet":            "index",
+		"/sub/partial.jet":             "partial",
+		"/link-in.jet":                 "index",
+		"/../secret.txt":               "",
+		"../secret.txt":                "",
+		"/sub/../../secret.txt":        "",
+		"/link-out.jet":                "",
+		"/link-up/secret.txt":          "",
+		"/link-up/views/../secret.txt": "",
+	}
+	for templatePath, expected := range tests {
+		if exists := l.Exists(templatePath); exists != (expected != "") {
+			t.Errorf("Exists(%q): expected %v, got %v", templatePath, expected != "", exists)
+		}
+		f, err := l.Open(templatePath)
+		if expected == "" {
+			if !errors.Is(err, ErrOutsideDir) {
+				t.Errorf("Open(%q): expected ErrOutsideDir, got %v", templatePath, err)
+			}
+			if _, err := l.Version(templatePath); !errors.Is(err, ErrOutsideDir) {
+				t.Errorf("Version(%q): expected ErrOutsideDir, got %v", templatePath, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Open(%q): %v", templatePath, err)
+			continue
+		}
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		if string(content) != expected {
+			t.Errorf("Open(%q): expected %q, got %q", templatePath, expected, content)
+		}
+	}
+
+	if !NewOSFileSystemLoader(dir).Exists("/../secret.txt") {
+		t.Errorf("expected a loader that isn't confined to follow the path outside of its directory")
+	}
+
+	listed, err := l.List("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/index.jet", "/link-in.jet", "/sub/partial.jet"}; !reflect.DeepEqual(listed, want) {
+		t.Errorf("List: expected %v, got %v", want, listed)
+	}
+	if _, err := l.List("/../"); !errors.Is(err, ErrOutsideDir) {
+		t.Errorf("List outside of the directory: expected ErrOutsideDir, got %v", err)
+	}
+
+	set := NewSet(l)
+	set.AddGlobal("secret", "../secret.txt")
+	tt, err := set.Parse("/page.jet", `[{{ includeIfExists: secret }}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]" {
+		t.Errorf("expected includeIfExists not to include the file outside of the directory, got %q", buf.String())
+	}
+}
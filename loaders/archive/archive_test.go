@@ -0,0 +1,214 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+type entry struct {
+	name, content string
+}
+
+var theme = []entry{
+	{"layout.jet", `<html>{{ block body() }}{{ end }}</html>`},
+	{"pages/index.jet", `{{ extends "../layout.jet" }}{{ block body() }}{{ include "/partials/nav.jet" }}index{{ end }}`},
+	{`partials\nav.jet`, `<nav/>`},
+}
+
+func buildZip(t *testing.T, entries []entry) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	if _, err := w.Create("pages/"); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		f, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(e.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// buildTarGz builds a tar.gz archive of entries, prefixing their names with prefix like tar does with "./".
+func buildTarGz(t *testing.T, entries []entry, prefix string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gw)
+	w.WriteHeader(&tar.Header{Name: "./pages/", Typeflag: tar.TypeDir, Mode: 0755})
+	w.WriteHeader(&tar.Header{Name: "./link.jet", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	for _, e := range entries {
+		err := w.WriteHeader(&tar.Header{Name: prefix + e.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(e.content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testLoader(t *testing.T, l *Loader) {
+	t.Helper()
+	for templatePath, exists := range map[string]bool{
+		"/layout.jet":          true,
+		"layout.jet":           true,
+		"/pages/../layout.jet": true,
+		"/partials/nav.jet":    true,
+		"/pages":               false,
+		"/link.jet":            false,
+		"/missing.jet":         false,
+	} {
+		if got := l.Exists(templatePath); got != exists {
+			t.Errorf("Exists(%q): expected %v, got %v", templatePath, exists, got)
+		}
+	}
+
+	templates, err := l.List("/")
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	if expected := []string{"/layout.jet", "/pages/index.jet", "/partials/nav.jet"}; !reflect.DeepEqual(templates, expected) {
+		t.Errorf("List(/): expected %v, got %v", expected, templates)
+	}
+	templates, _ = l.List("pages")
+	if expected := []string{"/pages/index.jet"}; !reflect.DeepEqual(templates, expected) {
+		t.Errorf("List(pages): expected %v, got %v", expected, templates)
+	}
+
+	set := jet.NewSet(l)
+	tt, err := set.GetTemplate("/pages/index.jet")
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, nil, nil); err != nil {
+		t.Fatalf("executing template: %v", err)
+	}
+	if expected := "<html><nav/>index</html>"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	if _, err := l.Open("/missing.jet"); !os.IsNotExist(err) {
+		t.Errorf("expected a not-exist error opening a missing template, got %v", err)
+	}
+}
+
+func TestZipLoader(t *testing.T) {
+	data := buildZip(t, theme)
+	l, err := NewZipLoader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("unexpected error from NewZipLoader: %v", err)
+	}
+	testLoader(t, l)
+}
+
+func TestTarGzLoader(t *testing.T) {
+	l, err := NewTarGzLoader(bytes.NewReader(buildTarGz(t, theme, "./")))
+	if err != nil {
+		t.Fatalf("unexpected error from NewTarGzLoader: %v", err)
+	}
+	testLoader(t, l)
+}
+
+func TestOpenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jet-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{
+		"theme.zip":    buildZip(t, theme),
+		"theme.tar.gz": buildTarGz(t, theme, "./"),
+		"theme.tgz":    buildTarGz(t, theme, "./"),
+	}
+	for name, data := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		l, err := OpenFile(filename)
+		if err != nil {
+			t.Errorf("%s: unexpected error from OpenFile: %v", name, err)
+			continue
+		}
+		testLoader(t, l)
+		if err := l.Close(); err != nil {
+			t.Errorf("%s: unexpected error from Close: %v", name, err)
+		}
+	}
+
+	if _, err := OpenFile(filepath.Join(dir, "theme.rar")); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("expected an error for an unsupported format, got %v", err)
+	}
+}
+
+func TestZipSlip(t *testing.T) {
+	for _, name := range []string{
+		"../layout.jet",
+		"pages/../../layout.jet",
+		`..\..\layout.jet`,
+		"/etc/passwd",
+		`C:\layout.jet`,
+	} {
+		entries := append([]entry{{name, "evil"}}, theme...)
+		data := buildZip(t, entries)
+		if _, err := NewZipLoader(bytes.NewReader(data), int64(len(data))); err == nil || !strings.Contains(err.Error(), "unsafe") {
+			t.Errorf("zip with %q: expected an unsafe path error, got %v", name, err)
+		}
+		if _, err := NewTarGzLoader(bytes.NewReader(buildTarGz(t, []entry{{name, "evil"}}, ""))); err == nil {
+			t.Errorf("tar.gz with %q: expected an unsafe path error", name)
+		}
+	}
+
+	// ".." elements staying inside the archive are fine
+	data := buildZip(t, []entry{{"pages/../safe.jet", "safe"}})
+	l, err := NewZipLoader(bytes.NewReader(data), int64(len(data)))
+	if err != nil || !l.Exists("/safe.jet") {
+		t.Errorf("expected pages/../safe.jet to be served as /safe.jet (error %v)", err)
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	// the largest file of theme is pages/index.jet
+	largest := int64(len(theme[1].content))
+	zipData := buildZip(t, theme)
+	tarGzData := buildTarGz(t, theme, "./")
+
+	if _, err := NewZipLoader(bytes.NewReader(zipData), int64(len(zipData)), WithMaxFileSize(largest-1)); err == nil || !strings.Contains(err.Error(), "larger") {
+		t.Errorf("zip: expected a size limit error, got %v", err)
+	}
+	if _, err := NewTarGzLoader(bytes.NewReader(tarGzData), WithMaxFileSize(largest-1)); err == nil || !strings.Contains(err.Error(), "larger") {
+		t.Errorf("tar.gz: expected a size limit error, got %v", err)
+	}
+
+	l, err := NewZipLoader(bytes.NewReader(zipData), int64(len(zipData)), WithMaxFileSize(largest))
+	if err != nil {
+		t.Fatalf("zip: unexpected error at the size limit: %v", err)
+	}
+	testLoader(t, l)
+	if l, err = NewTarGzLoader(bytes.NewReader(tarGzData), WithMaxFileSize(largest)); err != nil {
+		t.Fatalf("tar.gz: unexpected error at the size limit: %v", err)
+	}
+	testLoader(t, l)
+}
@@ -0,0 +1,245 @@
+// Package archive provides a jet.Loader serving templates straight from a zip, tar or gzip-compressed tar
+// archive, e.g. a theme distributed as a single file.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var (
+	_ jet.Loader = (*Loader)(nil)
+	_ jet.Lister = (*Loader)(nil)
+)
+
+// Loader serves the regular files of an archive as templates. The files are indexed when the Loader is
+// created: the contents of zip archives are decompressed whenever a template is opened, while the contents
+// of tar archives, which can't be read out of order, are kept in memory. A Loader is safe for concurrent use.
+//
+// The paths of the files in the archive are relative to the root of the template paths. Archives with
+// absolute paths or paths leaving the root through ".." elements ("zip slip") are rejected as a whole, since
+// their files could take the place of other templates. Directories, symbolic links and other special files
+// in the archive are ignored.
+type Loader struct {
+	files       map[string]file // files by normalized path
+	closer      io.Closer       // archive opened by OpenFile(), if any
+	maxFileSize int64
+}
+
+// DefaultMaxFileSize is the size limit of the files of an archive, unless WithMaxFileSize() sets another one.
+const DefaultMaxFileSize = 10 << 20
+
+// Option configures a Loader.
+type Option func(*Loader)
+
+// WithMaxFileSize sets the size limit of the files of the archive. Archives holding a larger regular file are
+// rejected when the Loader is created, so a malicious archive can't make it read an unbounded amount of data
+// into memory (or, for zip archives, have jet decompress it when opening the template). A negative size
+// disables the limit.
+func WithMaxFileSize(size int64) Option {
+	return func(l *Loader) {
+		l.maxFileSize = size
+	}
+}
+
+func newLoader(opts []Option) *Loader {
+	l := &Loader{files: map[string]file{}, maxFileSize: DefaultMaxFileSize}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// file is a file of the archive: either a file of a zip archive or the contents of a file of a tar archive.
+type file struct {
+	zip  *zip.File
+	data []byte
+}
+
+// OpenFile returns a Loader serving the archive at filename. The format of the archive is derived from the
+// file's extension: .zip, .tar, .tar.gz or .tgz. Since the files of a zip archive are read on demand, the
+// Loader keeps it open until Close() is called.
+func OpenFile(filename string, opts ...Option) (*Loader, error) {
+	switch ext := strings.ToLower(filename); {
+	case strings.HasSuffix(ext, ".zip"):
+		r, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		l, err := newZipLoader(&r.Reader, opts)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		l.closer = r
+		return l, nil
+	case strings.HasSuffix(ext, ".tar"), strings.HasSuffix(ext, ".tar.gz"), strings.HasSuffix(ext, ".tgz"):
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if strings.HasSuffix(ext, ".tar") {
+			return NewTarLoader(f, opts...)
+		}
+		return NewTarGzLoader(f, opts...)
+	}
+	return nil, fmt.Errorf("archive: unsupported archive format of %s", filename)
+}
+
+// NewZipLoader returns a Loader serving the zip archive read from r, which is size bytes long. r must stay
+// readable as long as the Loader is used.
+func NewZipLoader(r io.ReaderAt, size int64, opts ...Option) (*Loader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return newZipLoader(zr, opts)
+}
+
+func newZipLoader(r *zip.Reader, opts []Option) (*Loader, error) {
+	l := newLoader(opts)
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		name, err := clean(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		// the zip reader fails reading more than the uncompressed size from the header
+		if err := l.checkSize(f.Name, f.UncompressedSize64); err != nil {
+			return nil, err
+		}
+		l.files[name] = file{zip: f}
+	}
+	return l, nil
+}
+
+// NewTarGzLoader returns a Loader serving the gzip-compressed tar archive read from r.
+func NewTarGzLoader(r io.Reader, opts ...Option) (*Loader, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	return NewTarLoader(gr, opts...)
+}
+
+// NewTarLoader returns a Loader serving the tar archive read from r. If the archive holds several files under
+// the same path, the last one is used, like when extracting the archive.
+func NewTarLoader(r io.Reader, opts ...Option) (*Loader, error) {
+	l := newLoader(opts)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return l, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		name, err := clean(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		if header.Size < 0 {
+			return nil, fmt.Errorf("archive: invalid size of %q in archive", header.Name)
+		}
+		if err := l.checkSize(header.Name, uint64(header.Size)); err != nil {
+			return nil, err
+		}
+		// the tar reader reads no more than header.Size bytes of the file
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		l.files[name] = file{data: data}
+	}
+}
+
+// checkSize returns an error if the archive entry called name is larger than the Loader's size limit.
+func (l *Loader) checkSize(name string, size uint64) error {
+	if l.maxFileSize >= 0 && size > uint64(l.maxFileSize) {
+		return fmt.Errorf("archive: %q in archive is larger than %d bytes", name, l.maxFileSize)
+	}
+	return nil
+}
+
+// clean returns the normalized path of the archive entry called name, or an error if name is absolute or
+// leaves the root of the archive.
+func clean(name string) (string, error) {
+	// some tools write Windows path separators into archives
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	// "C:/..." is absolute on Windows
+	if path.IsAbs(slashed) || strings.Contains(strings.SplitN(slashed, "/", 2)[0], ":") {
+		return "", fmt.Errorf("archive: unsafe absolute path %q in archive", name)
+	}
+	if cleaned := path.Clean(slashed); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("archive: unsafe path %q leaving the root of the archive", name)
+	}
+	return normalize(slashed), nil
+}
+
+// normalize turns templatePath into an absolute, clean and slash-delimited path, like jet.InMemLoader does.
+func normalize(templatePath string) string {
+	templatePath = filepath.ToSlash(templatePath)
+	return path.Join("/", templatePath)
+}
+
+// Exists returns whether the archive holds a regular file at templatePath.
+func (l *Loader) Exists(templatePath string) bool {
+	_, ok := l.files[normalize(templatePath)]
+	return ok
+}
+
+// Open returns the contents of the file at templatePath.
+func (l *Loader) Open(templatePath string) (io.ReadCloser, error) {
+	f, ok := l.files[normalize(templatePath)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: templatePath, Err: os.ErrNotExist}
+	}
+	if f.zip != nil {
+		return f.zip.Open()
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+// List returns the paths of all files of the archive in the directory at dirPath and its subdirectories.
+func (l *Loader) List(dirPath string) ([]string, error) {
+	prefix := normalize(dirPath)
+	if prefix != "/" {
+		prefix += "/"
+	}
+	var templates []string
+	for templatePath := range l.files {
+		if strings.HasPrefix(templatePath, prefix) {
+			templates = append(templates, templatePath)
+		}
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
+
+// Close closes the archive if the Loader was created by OpenFile(). The Loader must not be used afterwards.
+func (l *Loader) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
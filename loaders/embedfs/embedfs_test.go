@@ -2,6 +2,7 @@ package embedfs
 
 import (
 	"embed"
+	"reflect"
 	"testing"
 
 	"github.com/CloudyKit/jet/v6"
@@ -20,3 +21,28 @@ func TestEmbedFileSystemResolve(t *testing.T) {
 	jettest.RunWithSet(t, set, nil, nil, "ifIncludeIfExits", "Hi, i exist!!\n    Was included!!\n\n\n    Was not included!!\n\n")
 	jettest.RunWithSet(t, set, nil, "World", "wcontext", "Hi, Buddy!\nHi, World!")
 }
+
+func TestEmbedFileSystemList(t *testing.T) {
+	l := NewLoader("testData/includeIfNotExists", templateFS).(jet.Lister)
+	templates, err := l.List("/")
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	expected := []string{"/existent.jet", "/exists.jet", "/ifIncludeIfExits.jet", "/notExistent.jet", "/wcontext.jet", "/wcontext_child.jet"}
+	if !reflect.DeepEqual(templates, expected) {
+		t.Errorf("expected %v, got %v", expected, templates)
+	}
+
+	root := NewLoader(".", templateFS).(jet.Lister)
+	templates, err = root.List("testData/includeIfNotExists")
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	if len(templates) != len(expected) || templates[0] != "/testData/includeIfNotExists/existent.jet" {
+		t.Errorf("unexpected templates listed from the root of the FS: %v", templates)
+	}
+
+	if _, err := l.List("/missing"); err == nil {
+		t.Errorf("expected an error listing a missing directory")
+	}
+}
@@ -4,11 +4,19 @@ import (
 	"embed"
 	"io"
 	"io/fs"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/CloudyKit/jet/v6"
 )
 
+var (
+	_ jet.Loader = (*embedFileSystemLoader)(nil)
+	_ jet.Lister = (*embedFileSystemLoader)(nil)
+)
+
 type embedFileSystemLoader struct {
 	dir string
 	fs embed.FS
@@ -36,3 +44,26 @@ func (l *embedFileSystemLoader) Exists(name string) bool {
 	}
 	return false
 }
+
+// List implements Lister.List() on top of an embed.FS by walking the directory at dirPath.
+func (l *embedFileSystemLoader) List(dirPath string) ([]string, error) {
+	// embed.FS names are slash-separated and relative to the root of the FS
+	base := path.Clean(filepath.ToSlash(l.dir))
+	root := path.Join(base, strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(dirPath)), "/"))
+	var templates []string
+	err := fs.WalkDir(l.fs, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if base != "." {
+			name = strings.TrimPrefix(name, base+"/")
+		}
+		templates = append(templates, "/"+name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
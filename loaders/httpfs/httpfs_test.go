@@ -2,6 +2,7 @@ package httpfs
 
 import (
 	"net/http"
+	"reflect"
 	"testing"
 
 	"github.com/CloudyKit/jet/v6"
@@ -27,3 +28,30 @@ func TestHTTPFileSystemResolve(t *testing.T) {
 	jettest.RunWithSet(t, set, nil, nil, "ifIncludeIfExits", "Hi, i exist!!\n    Was included!!\n\n\n    Was not included!!\n\n")
 	jettest.RunWithSet(t, set, nil, "World", "wcontext", "Hi, Buddy!\nHi, World!")
 }
+
+func TestHTTPFileSystemList(t *testing.T) {
+	l, err := NewLoader(http.Dir("testData"))
+	if err != nil {
+		t.Fatalf("unexpected error from NewLoader: %v", err)
+	}
+	templates, err := l.(jet.Lister).List("includeIfNotExists")
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	expected := []string{
+		"/includeIfNotExists/existent.jet",
+		"/includeIfNotExists/exists.jet",
+		"/includeIfNotExists/ifIncludeIfExits.jet",
+		"/includeIfNotExists/notExistent.jet",
+		"/includeIfNotExists/wcontext.jet",
+		"/includeIfNotExists/wcontext_child.jet",
+	}
+	if !reflect.DeepEqual(templates, expected) {
+		t.Errorf("expected %v, got %v", expected, templates)
+	}
+	for _, name := range templates {
+		if !l.Exists(name) {
+			t.Errorf("listed template %s doesn't exist", name)
+		}
+	}
+}
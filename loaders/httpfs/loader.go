@@ -4,10 +4,18 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"path"
+	"sort"
 
 	"github.com/CloudyKit/jet/v6"
 )
 
+var (
+	_ jet.Loader    = (*httpFileSystemLoader)(nil)
+	_ jet.Lister    = (*httpFileSystemLoader)(nil)
+	_ jet.Versioner = (*httpFileSystemLoader)(nil)
+)
+
 type httpFileSystemLoader struct {
 	fs http.FileSystem
 }
@@ -33,3 +41,52 @@ func (l *httpFileSystemLoader) Exists(name string) bool {
 	}
 	return false
 }
+
+// Version implements Versioner.Version() on top of an http.FileSystem using the modification time and size
+// of the file.
+func (l *httpFileSystemLoader) Version(name string) (string, error) {
+	f, err := l.fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return jet.FileVersion(stat), nil
+}
+
+// List implements Lister.List() on top of an http.FileSystem by reading the directory at dirPath and its
+// subdirectories.
+func (l *httpFileSystemLoader) List(dirPath string) ([]string, error) {
+	var templates []string
+	if err := l.list(path.Clean("/"+dirPath), &templates); err != nil {
+		return nil, err
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
+
+func (l *httpFileSystemLoader) list(dirPath string, templates *[]string) error {
+	f, err := l.fs.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := path.Join(dirPath, info.Name())
+		if !info.IsDir() {
+			*templates = append(*templates, name)
+			continue
+		}
+		if err := l.list(name, templates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package iofs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var testFS = fstest.MapFS{
+	"views/layout.jet":       {Data: []byte(`<html>{{ block body() }}{{ end }}</html>`)},
+	"views/pages/index.jet":  {Data: []byte(`{{ extends "../layout.jet" }}{{ block body() }}{{ include "/partials/nav.jet" }}index{{ end }}`)},
+	"views/partials/nav.jet": {Data: []byte(`<nav/>`)},
+	"other/readme.txt":       {Data: []byte(`not a template`)},
+}
+
+func TestFS(t *testing.T) {
+	// the test FS itself must be valid for the other tests to mean anything
+	if err := fstest.TestFS(testFS, "views/layout.jet", "views/pages/index.jet", "views/partials/nav.jet"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoader(t *testing.T) {
+	l, err := NewLoader(testFS, "views")
+	if err != nil {
+		t.Fatalf("unexpected error from NewLoader: %v", err)
+	}
+
+	for templatePath, exists := range map[string]bool{
+		"/layout.jet":          true,
+		"layout.jet":           true,
+		"/pages/../layout.jet": true,
+		"/pages/index.jet":     true,
+		"/pages":               false,
+		"/":                    false,
+		"/missing.jet":         false,
+		"/../other/readme.txt": false,
+		"/views/layout.jet":    false,
+	} {
+		if got := l.Exists(templatePath); got != exists {
+			t.Errorf("Exists(%q): expected %v, got %v", templatePath, exists, got)
+		}
+	}
+
+	f, err := l.Open("/partials/nav.jet")
+	if err != nil {
+		t.Fatalf("unexpected error from Open: %v", err)
+	}
+	content, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(content) != "<nav/>" {
+		t.Errorf("unexpected content %q (error %v)", content, err)
+	}
+
+	set := jet.NewSet(l)
+	tt, err := set.GetTemplate("/pages/index.jet")
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, nil, nil); err != nil {
+		t.Fatalf("executing template: %v", err)
+	}
+	if expected := "<html><nav/>index</html>"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestList(t *testing.T) {
+	l, err := NewLoader(testFS, "views")
+	if err != nil {
+		t.Fatalf("unexpected error from NewLoader: %v", err)
+	}
+	tests := map[string][]string{
+		"/":       {"/layout.jet", "/pages/index.jet", "/partials/nav.jet"},
+		"pages":   {"/pages/index.jet"},
+		"/pages/": {"/pages/index.jet"},
+	}
+	for dir, expected := range tests {
+		templates, err := l.List(dir)
+		if err != nil {
+			t.Errorf("List(%q): %v", dir, err)
+			continue
+		}
+		if !reflect.DeepEqual(templates, expected) {
+			t.Errorf("List(%q): expected %v, got %v", dir, expected, templates)
+		}
+	}
+	if _, err := l.List("/missing"); err == nil {
+		t.Errorf("expected an error listing a missing directory")
+	}
+
+	// without fs.StatFS and fs.ReadDirFS, the loader falls back on opening files and directories
+	plain, err := NewLoader(struct{ fs.FS }{testFS}, ".")
+	if err != nil {
+		t.Fatalf("unexpected error from NewLoader: %v", err)
+	}
+	templates, err := plain.List("/")
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	if len(templates) != 4 || !plain.Exists("/other/readme.txt") || plain.Exists("/other") {
+		t.Errorf("unexpected templates %v", templates)
+	}
+}
+
+func TestNewLoaderErrors(t *testing.T) {
+	if _, err := NewLoader(nil, "."); err == nil {
+		t.Errorf("expected an error for a nil fs.FS")
+	}
+	if _, err := NewLoader(testFS, "/views"); err == nil {
+		t.Errorf("expected an error for an invalid directory name")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	fsys := fstest.MapFS{"index.jet": {Data: []byte("v1"), ModTime: time.Unix(1, 0)}}
+	l, err := NewLoader(fsys, ".")
+	if err != nil {
+		t.Fatalf("unexpected error from NewLoader: %v", err)
+	}
+	v1, err := l.Version("/index.jet")
+	if err != nil {
+		t.Fatalf("unexpected error from Version: %v", err)
+	}
+	fsys["index.jet"].ModTime = time.Unix(2, 0)
+	if v2, _ := l.Version("/index.jet"); v2 == v1 {
+		t.Errorf("version didn't change with the modification time")
+	}
+	if _, err := l.Version("/missing.jet"); err == nil {
+		t.Errorf("expected an error for a missing template")
+	}
+}
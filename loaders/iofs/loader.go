@@ -0,0 +1,88 @@
+// Package iofs provides a jet.Loader serving templates from any io/fs file system, like os.DirFS(),
+// embed.FS, testing/fstest.MapFS or the file system of a zip.Reader.
+package iofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var (
+	_ jet.Loader    = (*Loader)(nil)
+	_ jet.Lister    = (*Loader)(nil)
+	_ jet.Versioner = (*Loader)(nil)
+)
+
+// Loader implements jet.Loader and jet.Lister on top of an fs.FS. Template paths, which are absolute and
+// slash-delimited, are turned into names relative to the root of the file system, as required by fs.FS.
+type Loader struct {
+	fsys fs.FS
+}
+
+// NewLoader returns a Loader serving the templates in the directory dir of fsys, which becomes the root
+// of the template paths (see fs.Sub()). Pass "." to serve all of fsys. Stat-ing and listing templates makes
+// use of fs.StatFS and fs.ReadDirFS if fsys implements them.
+func NewLoader(fsys fs.FS, dir string) (*Loader, error) {
+	if fsys == nil {
+		return nil, errors.New("iofs: nil fs.FS passed to NewLoader")
+	}
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Loader{fsys: sub}, nil
+}
+
+// name returns the name of the file at templatePath in the file system.
+func name(templatePath string) string {
+	if name := strings.TrimPrefix(path.Clean("/"+templatePath), "/"); name != "" {
+		return name
+	}
+	return "."
+}
+
+// Open implements Loader.Open() on top of an fs.FS.
+func (l *Loader) Open(templatePath string) (io.ReadCloser, error) {
+	return l.fsys.Open(name(templatePath))
+}
+
+// Exists implements Loader.Exists() on top of an fs.FS: it reports whether a file (and not a directory)
+// exists at templatePath.
+func (l *Loader) Exists(templatePath string) bool {
+	stat, err := fs.Stat(l.fsys, name(templatePath))
+	return err == nil && !stat.IsDir()
+}
+
+// Version implements Versioner.Version() on top of an fs.FS using the modification time and size of the file
+// at templatePath. Files of file systems without modification times, like embed.FS, change their version only
+// when their size changes, which is fine as long as the file system is immutable.
+func (l *Loader) Version(templatePath string) (string, error) {
+	stat, err := fs.Stat(l.fsys, name(templatePath))
+	if err != nil {
+		return "", err
+	}
+	return jet.FileVersion(stat), nil
+}
+
+// List implements Lister.List() on top of an fs.FS by walking the directory at dirPath.
+func (l *Loader) List(dirPath string) ([]string, error) {
+	var templates []string
+	err := fs.WalkDir(l.fsys, name(dirPath), func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		templates = append(templates, "/"+name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
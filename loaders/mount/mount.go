@@ -0,0 +1,166 @@
+// Package mount provides a Loader combining the templates of several loaders under different path prefixes,
+// e.g. the templates of different Go modules:
+//
+//	l := mount.NewLoader()
+//	l.Mount("/admin/", adminLoader)
+//	l.Mount("/mail/", mailLoader)
+//	set := jet.NewSet(l)
+//
+// "/admin/users.jet" is then loaded as "/users.jet" from adminLoader. Since the Loader implements
+// jet.Namespaced, templates can also refer to "/admin/users.jet" as "@admin/users.jet", regardless of their
+// own directory.
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var (
+	_ jet.Loader     = (*Mount)(nil)
+	_ jet.Lister     = (*Mount)(nil)
+	_ jet.Versioner  = (*Mount)(nil)
+	_ jet.Namespaced = (*Mount)(nil)
+)
+
+// Mount implements the jet.Loader interface by delegating to the loaders mounted under path prefixes. A
+// template is loaded from the loader mounted under the longest prefix of its path, with the prefix stripped.
+// Loaders are mounted before the Mount is used; Mount isn't safe for mounting loaders concurrently with
+// loading templates.
+type Mount struct {
+	mounts []mountPoint // sorted by decreasing prefix length
+}
+
+type mountPoint struct {
+	prefix string // absolute, ending with a slash
+	loader jet.Loader
+}
+
+// NewLoader returns a new mount loader without any loader mounted.
+func NewLoader() *Mount {
+	return &Mount{}
+}
+
+// Mount mounts loader under prefix, e.g. "/admin/". The prefix is cleaned and made absolute; "/" mounts a
+// loader for all templates not found under a longer prefix. Mounting another loader under the same prefix
+// replaces the loader.
+func (m *Mount) Mount(prefix string, loader jet.Loader) {
+	prefix = path.Join("/", prefix)
+	if prefix != "/" {
+		prefix += "/"
+	}
+	for i, mount := range m.mounts {
+		if mount.prefix == prefix {
+			m.mounts[i].loader = loader
+			return
+		}
+	}
+	m.mounts = append(m.mounts, mountPoint{prefix: prefix, loader: loader})
+	sort.SliceStable(m.mounts, func(i, j int) bool { return len(m.mounts[i].prefix) > len(m.mounts[j].prefix) })
+}
+
+// resolve returns the mount point serving the template at name and the template's path in its loader.
+func (m *Mount) resolve(name string) (*mountPoint, string, bool) {
+	name = path.Join("/", name)
+	for i, mount := range m.mounts {
+		if strings.HasPrefix(name, mount.prefix) {
+			return &m.mounts[i], "/" + name[len(mount.prefix):], true
+		}
+	}
+	return nil, "", false
+}
+
+// Exists returns true if the loader mounted under the longest prefix of name provides the template.
+func (m *Mount) Exists(name string) bool {
+	mount, templatePath, ok := m.resolve(name)
+	return ok && mount.loader.Exists(templatePath)
+}
+
+// Open opens the template at name from the loader mounted under the longest prefix of name.
+func (m *Mount) Open(name string) (io.ReadCloser, error) {
+	mount, templatePath, ok := m.resolve(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return mount.loader.Open(templatePath)
+}
+
+// Version returns the version of the template from the loader serving it. The templates of loaders not
+// implementing jet.Versioner are assumed to never change.
+func (m *Mount) Version(name string) (string, error) {
+	mount, templatePath, ok := m.resolve(name)
+	if !ok || !mount.loader.Exists(templatePath) {
+		return "", &os.PathError{Op: "version", Path: name, Err: os.ErrNotExist}
+	}
+	versioner, ok := mount.loader.(jet.Versioner)
+	if !ok {
+		return "", nil
+	}
+	return versioner.Version(templatePath)
+}
+
+// List returns the paths of the templates of all mounted loaders in the directory at dirPath and its
+// subdirectories, with the prefixes they are mounted under. Templates hidden by a loader mounted under a
+// longer prefix aren't listed. All loaders mounted in dirPath must implement jet.Lister.
+func (m *Mount) List(dirPath string) ([]string, error) {
+	dirPath = path.Join("/", dirPath)
+	dirPrefix := dirPath
+	if dirPrefix != "/" {
+		dirPrefix += "/"
+	}
+	var templates []string
+	listed := false
+	for i, mount := range m.mounts {
+		var innerDir string
+		switch {
+		case strings.HasPrefix(dirPrefix, mount.prefix):
+			innerDir = "/" + dirPrefix[len(mount.prefix):]
+		case strings.HasPrefix(mount.prefix, dirPrefix):
+			innerDir = "/"
+		default:
+			continue
+		}
+		lister, ok := mount.loader.(jet.Lister)
+		if !ok {
+			return nil, fmt.Errorf("mount: loader %T mounted under %s can't list its templates", mount.loader, mount.prefix)
+		}
+		names, err := lister.List(innerDir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		listed = true
+		for _, name := range names {
+			name = mount.prefix + strings.TrimPrefix(name, "/")
+			if served, _, _ := m.resolve(name); served == &m.mounts[i] {
+				templates = append(templates, name)
+			}
+		}
+	}
+	if !listed {
+		return nil, &os.PathError{Op: "list", Path: dirPath, Err: os.ErrNotExist}
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
+
+// Namespace returns the prefix a loader is mounted under as the directory of the namespace called name, so
+// "@admin/users.jet" refers to "/admin/users.jet" if a loader is mounted under "/admin/".
+func (m *Mount) Namespace(name string) (string, bool) {
+	prefix := path.Join("/", name) + "/"
+	for _, mount := range m.mounts {
+		if mount.prefix == prefix {
+			return prefix, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,131 @@
+package mount
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func newMount() *Mount {
+	root := jet.NewInMemLoader()
+	root.Set("/index.jet", `{{ extends "@admin/layout.jet" }}{{ block body() }}index{{ end }}`)
+	root.Set("/admin/hidden.jet", `hidden by the admin loader`)
+
+	admin := jet.NewInMemLoader()
+	admin.Set("/layout.jet", `<{{ block body() }}{{ end }}|{{ include "@mail/signature.jet" }}>`)
+	admin.Set("/users/list.jet", `{{ import "../layout.jet" }}{{ include "@mail/signature" }}`)
+
+	mail := jet.NewInMemLoader()
+	mail.Set("/signature.jet", `regards`)
+
+	m := NewLoader()
+	m.Mount("/", root)
+	m.Mount("admin", admin)
+	m.Mount("/mail/", mail)
+	return m
+}
+
+func TestMount(t *testing.T) {
+	m := newMount()
+	tests := map[string]bool{
+		"/index.jet":          true,
+		"/admin/layout.jet":   true,
+		"/admin/hidden.jet":   false,
+		"/mail/signature.jet": true,
+		"/layout.jet":         false,
+		"/signature.jet":      false,
+	}
+	for name, exists := range tests {
+		if got := m.Exists(name); got != exists {
+			t.Errorf("Exists(%q): expected %v, got %v", name, exists, got)
+		}
+	}
+
+	if _, err := NewLoader().Open("/index.jet"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a not-exist error opening a template without loaders, got %v", err)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	set := jet.NewSet(newMount())
+	tests := map[string]string{
+		"/index.jet":          "<index|regards>",
+		"@admin/users/list":   "regards",
+		"/admin/users/list":   "regards",
+		"@mail/signature.jet": "regards",
+		"/mail/signature.jet": "regards",
+		"/admin/../index.jet": "<index|regards>",
+	}
+	for templatePath, expected := range tests {
+		tt, err := set.GetTemplate(templatePath)
+		if err != nil {
+			t.Errorf("%s: %v", templatePath, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tt.Execute(&buf, nil, nil); err != nil {
+			t.Errorf("%s: %v", templatePath, err)
+			continue
+		}
+		if buf.String() != expected {
+			t.Errorf("%s: expected %q, got %q", templatePath, expected, buf.String())
+		}
+	}
+
+	if _, err := set.GetTemplate("@unknown/index.jet"); err == nil {
+		t.Errorf("expected an error getting a template of an unknown namespace")
+	}
+	if tt, _ := set.GetTemplate("/index.jet"); !reflect.DeepEqual(tt.Dependencies(), []string{"/admin/layout.jet"}) {
+		t.Errorf("expected the namespaced template to be a dependency, got %v", tt.Dependencies())
+	}
+}
+
+func TestList(t *testing.T) {
+	m := newMount()
+	tests := map[string][]string{
+		"/":            {"/admin/layout.jet", "/admin/users/list.jet", "/index.jet", "/mail/signature.jet"},
+		"/admin":       {"/admin/layout.jet", "/admin/users/list.jet"},
+		"/admin/users": {"/admin/users/list.jet"},
+	}
+	for dirPath, expected := range tests {
+		got, err := m.List(dirPath)
+		if err != nil {
+			t.Errorf("List(%q): %v", dirPath, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("List(%q): expected %v, got %v", dirPath, expected, got)
+		}
+	}
+
+	unlisted := NewLoader()
+	unlisted.Mount("/", noLister{})
+	if _, err := unlisted.List("/"); err == nil {
+		t.Errorf("expected an error listing a loader that can't list its templates")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	admin := jet.NewInMemLoader()
+	admin.Set("/layout.jet", "v1")
+	m := NewLoader()
+	m.Mount("/admin/", admin)
+
+	before, err := m.Version("/admin/layout.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.Set("/layout.jet", "v2")
+	if after, err := m.Version("/admin/layout.jet"); err != nil || after == before {
+		t.Errorf("expected the version to change, got %q and %q, %v", before, after, err)
+	}
+	if _, err := m.Version("/layout.jet"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a not-exist error for an unmounted template, got %v", err)
+	}
+}
+
+type noLister struct{ jet.Loader }
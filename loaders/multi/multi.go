@@ -1,40 +1,135 @@
 package multi
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
 
 	"github.com/CloudyKit/jet/v6"
 )
 
-var _ jet.Loader = (*Multi)(nil)
+var (
+	_ jet.Loader    = (*Multi)(nil)
+	_ jet.Lister    = (*Multi)(nil)
+	_ jet.Versioner = (*Multi)(nil)
+)
 
 // Multi implements jet.Loader interface and tries to load templates from a list of custom loaders.
 // Caution: When multiple loaders have templates with the same name, the order in which you pass loaders
 // to NewLoader/AddLoaders dictates which template will be returned by Open when you request it!
+//
+// Multi is safe for concurrent use: loaders may be added, removed and reordered while templates are loaded,
+// e.g. by plugins registering their templates at runtime. Every lookup uses the list of loaders as it was
+// when the lookup started.
 type Multi struct {
-	loaders []jet.Loader
+	mu      sync.RWMutex
+	loaders []jet.Loader // never modified once stored, replaced as a whole; guarded by mu
 }
 
 // NewLoader returns a new multi loader. The order of the loaders passed as parameters
 // will define the order in which templates are loaded.
 func NewLoader(loaders ...jet.Loader) *Multi {
-	return &Multi{loaders: loaders}
+	return &Multi{loaders: append([]jet.Loader(nil), loaders...)}
+}
+
+// list returns the current list of loaders, which must not be modified.
+func (m *Multi) list() []jet.Loader {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.loaders
+}
+
+// update replaces the list of loaders by the result of fn, which gets a copy of the current list.
+func (m *Multi) update(fn func(loaders []jet.Loader) []jet.Loader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loaders = fn(append([]jet.Loader(nil), m.loaders...))
 }
 
 // AddLoaders adds the passed loaders to the list of loaders.
 func (m *Multi) AddLoaders(loaders ...jet.Loader) {
-	m.loaders = append(m.loaders, loaders...)
+	m.update(func(current []jet.Loader) []jet.Loader {
+		return append(current, loaders...)
+	})
 }
 
 // ClearLoaders clears the list of loaders.
 func (m *Multi) ClearLoaders() {
-	m.loaders = nil
+	m.update(func([]jet.Loader) []jet.Loader {
+		return nil
+	})
+}
+
+// SetLoaders replaces the list of loaders, e.g. to reorder the loaders' priorities.
+func (m *Multi) SetLoaders(loaders ...jet.Loader) {
+	loaders = append([]jet.Loader(nil), loaders...)
+	m.update(func([]jet.Loader) []jet.Loader {
+		return loaders
+	})
+}
+
+// Loaders returns a copy of the list of loaders, in the order in which they are tried.
+func (m *Multi) Loaders() []jet.Loader {
+	return append([]jet.Loader(nil), m.list()...)
+}
+
+// RemoveLoader removes loader from the list of loaders and reports whether it was in the list. Loaders are
+// compared with ==, so loader must be the same (comparable) value that was added.
+func (m *Multi) RemoveLoader(loader jet.Loader) (removed bool) {
+	m.update(func(current []jet.Loader) []jet.Loader {
+		for i, l := range current {
+			if l == loader {
+				removed = true
+				return append(current[:i], current[i+1:]...)
+			}
+		}
+		return current
+	})
+	return removed
+}
+
+// MoveLoader moves loader to position index of the list of loaders (0 being the first loader tried), shifting
+// the loaders in between, and reports whether loader was in the list. An index beyond the end of the list
+// moves loader to the end.
+func (m *Multi) MoveLoader(loader jet.Loader, index int) (moved bool) {
+	m.update(func(current []jet.Loader) []jet.Loader {
+		for i, l := range current {
+			if l == loader {
+				moved = true
+				current = append(current[:i], current[i+1:]...)
+				if index < 0 {
+					index = 0
+				}
+				if index > len(current) {
+					index = len(current)
+				}
+				current = append(current[:index], append([]jet.Loader{loader}, current[index:]...)...)
+				break
+			}
+		}
+		return current
+	})
+	return moved
+}
+
+// LoaderFor returns the loader serving the template at name and its position in the list of loaders, to find
+// out which loader overrides a template. If no loader provides the template, LoaderFor returns nil and -1.
+func (m *Multi) LoaderFor(name string) (jet.Loader, int) {
+	for i, loader := range m.list() {
+		if loader.Exists(name) {
+			return loader, i
+		}
+	}
+	return nil, -1
 }
 
 // Open will open the file passed by trying all loaders in succession.
 func (m *Multi) Open(name string) (io.ReadCloser, error) {
-	for _, loader := range m.loaders {
+	for _, loader := range m.list() {
 		if f, err := loader.Open(name); err == nil {
 			return f, nil
 		}
@@ -45,10 +140,57 @@ func (m *Multi) Open(name string) (io.ReadCloser, error) {
 // Exists checks all loaders in succession, returning true if the template file was found or false
 // if no loader can provide the file.
 func (m *Multi) Exists(name string) bool {
-	for _, loader := range m.loaders {
-		if ok := loader.Exists(name); ok {
-			return true
+	_, i := m.LoaderFor(name)
+	return i >= 0
+}
+
+// Version returns the version of the template from the first loader providing it, combined with the position
+// of that loader, so the version also changes when the template starts being served by another loader. The
+// templates of loaders not implementing jet.Versioner are assumed to never change.
+func (m *Multi) Version(name string) (string, error) {
+	for i, loader := range m.list() {
+		if !loader.Exists(name) {
+			continue
+		}
+		versioner, ok := loader.(jet.Versioner)
+		if !ok {
+			return strconv.Itoa(i), nil
+		}
+		version, err := versioner.Version(name)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(i) + "/" + version, nil
+	}
+	return "", &os.PathError{Op: "version", Path: name, Err: os.ErrNotExist}
+}
+
+// List returns the paths of the templates of all loaders in the directory at dirPath and its subdirectories.
+// A template provided by several loaders is listed once, since Open always returns the template of the first
+// loader providing it. All loaders must implement jet.Lister; a directory missing from some of the loaders is
+// fine, though.
+func (m *Multi) List(dirPath string) ([]string, error) {
+	seen := map[string]bool{}
+	var templates []string
+	for _, loader := range m.list() {
+		lister, ok := loader.(jet.Lister)
+		if !ok {
+			return nil, fmt.Errorf("multi: loader %T can't list its templates", loader)
+		}
+		listed, err := lister.List(dirPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range listed {
+			if !seen[name] {
+				seen[name] = true
+				templates = append(templates, name)
+			}
 		}
 	}
-	return false
+	sort.Strings(templates)
+	return templates, nil
 }
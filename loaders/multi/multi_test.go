@@ -2,6 +2,8 @@ package multi
 
 import (
 	"net/http"
+	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/CloudyKit/jet/v6"
@@ -33,3 +35,158 @@ func TestTwoLoaders(t *testing.T) {
 	jettest.RunWithSet(t, set, nil, nil, "base.jet", "")
 	jettest.RunWithSet(t, set, nil, nil, "simple2", "simple2\n")
 }
+
+func TestList(t *testing.T) {
+	first := jet.NewInMemLoader()
+	first.Set("/index.jet", "first")
+	first.Set("/views/a.jet", "first")
+	second := jet.NewInMemLoader()
+	second.Set("/index.jet", "second")
+	second.Set("/views/b.jet", "second")
+	osFSLoader := jet.NewOSFileSystemLoader("./testData")
+
+	l := NewLoader(first, second, osFSLoader)
+	templates, err := l.List("/")
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	if expected := []string{"/index.jet", "/simple2.jet", "/views/a.jet", "/views/b.jet"}; !reflect.DeepEqual(templates, expected) {
+		t.Errorf("expected %v, got %v", expected, templates)
+	}
+
+	// the directory doesn't exist in osFSLoader
+	templates, err = l.List("/views")
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	if expected := []string{"/views/a.jet", "/views/b.jet"}; !reflect.DeepEqual(templates, expected) {
+		t.Errorf("expected %v, got %v", expected, templates)
+	}
+
+	httpFSLoader, err := httpfs.NewLoader(http.Dir("../../testData"))
+	if err != nil {
+		t.Fatalf("unexpected error from httpfs.NewLoader: %v", err)
+	}
+	l.AddLoaders(struct{ jet.Loader }{httpFSLoader})
+	if _, err := l.List("/"); err == nil {
+		t.Errorf("expected an error listing the templates of a loader that isn't a jet.Lister")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	first := jet.NewInMemLoader()
+	second := jet.NewInMemLoader()
+	second.Set("/index.jet", "second")
+	l := NewLoader(first, second, struct{ jet.Loader }{jet.NewOSFileSystemLoader("./testData")})
+
+	v1, err := l.Version("/index.jet")
+	if err != nil {
+		t.Fatalf("unexpected error from Version: %v", err)
+	}
+	second.Set("/index.jet", "changed")
+	v2, _ := l.Version("/index.jet")
+	first.Set("/index.jet", "first")
+	v3, _ := l.Version("/index.jet")
+	if v1 == v2 || v2 == v3 {
+		t.Errorf("expected the version to change with the template and the loader serving it, got %q, %q, %q", v1, v2, v3)
+	}
+
+	// the OS loader is wrapped to hide its Version method
+	if v, err := l.Version("/simple2.jet"); err != nil || v != "2" {
+		t.Errorf("expected version 2 for a template of a loader without versions, got %q (error %v)", v, err)
+	}
+	if _, err := l.Version("/missing.jet"); err == nil {
+		t.Errorf("expected an error for a missing template")
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	first := jet.NewInMemLoader()
+	first.Set("/index.jet", "first")
+	second := jet.NewInMemLoader()
+	second.Set("/index.jet", "second")
+	second.Set("/other.jet", "second")
+	third := jet.NewInMemLoader()
+	third.Set("/index.jet", "third")
+
+	l := NewLoader(first, second)
+	l.AddLoaders(third)
+	if loader, i := l.LoaderFor("/other.jet"); loader != second || i != 1 {
+		t.Errorf("LoaderFor: expected the second loader at 1, got %v at %d", loader, i)
+	}
+	if loader, i := l.LoaderFor("/missing.jet"); loader != nil || i != -1 {
+		t.Errorf("LoaderFor: expected no loader for a missing template, got %v at %d", loader, i)
+	}
+
+	tests := []struct {
+		name     string
+		change   func() bool
+		loaders  []jet.Loader
+		serverOf jet.Loader
+	}{
+		{"move to front", func() bool { return l.MoveLoader(third, 0) }, []jet.Loader{third, first, second}, third},
+		{"move to end", func() bool { return l.MoveLoader(third, 10) }, []jet.Loader{first, second, third}, first},
+		{"remove", func() bool { return l.RemoveLoader(first) }, []jet.Loader{second, third}, second},
+		{"remove again", func() bool { return !l.RemoveLoader(first) }, []jet.Loader{second, third}, second},
+		{"move missing", func() bool { return !l.MoveLoader(first, 0) }, []jet.Loader{second, third}, second},
+		{"set", func() bool { l.SetLoaders(third, first); return true }, []jet.Loader{third, first}, third},
+		{"clear", func() bool { l.ClearLoaders(); return true }, nil, nil},
+	}
+	for _, test := range tests {
+		if !test.change() {
+			t.Errorf("%s: unexpected result", test.name)
+		}
+		if got := l.Loaders(); !reflect.DeepEqual(got, test.loaders) {
+			t.Errorf("%s: expected loaders %v, got %v", test.name, test.loaders, got)
+		}
+		if loader, _ := l.LoaderFor("/index.jet"); loader != test.serverOf {
+			t.Errorf("%s: expected /index.jet to be served by %v, got %v", test.name, test.serverOf, loader)
+		}
+	}
+}
+
+func TestNewLoaderCopiesLoaders(t *testing.T) {
+	first, second := jet.NewInMemLoader(), jet.NewInMemLoader()
+	loaders := []jet.Loader{first, second}
+	l := NewLoader(loaders...)
+	loaders[0] = second
+	if got := l.Loaders(); got[0] != first || got[1] != second {
+		t.Errorf("changing the slice passed to NewLoader changed the loaders to %v", got)
+	}
+}
+
+func TestConcurrentReconfiguration(t *testing.T) {
+	base := jet.NewInMemLoader()
+	base.Set("/index.jet", "base")
+	l := NewLoader(base)
+	set := jet.NewSet(l, jet.InDevelopmentMode())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				plugin := jet.NewInMemLoader()
+				plugin.Set("/index.jet", "plugin")
+				l.AddLoaders(plugin)
+				l.MoveLoader(plugin, 0)
+				l.RemoveLoader(plugin)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := set.GetTemplate("/index.jet"); err != nil {
+					t.Errorf("getting template: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := l.Loaders(); len(got) != 1 || got[0] != base {
+		t.Errorf("expected only the base loader to remain, got %v", got)
+	}
+}
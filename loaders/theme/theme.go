@@ -0,0 +1,164 @@
+// Package theme provides a Loader stacking layers of templates, so a theme can override single templates of
+// a default layer and extend the templates it overrides with {{ extends parent }}:
+//
+//	<!-- default layer: /layouts/base.jet -->
+//	<html><body>{{ block header() }}Default{{ end }}{{ block body() }}{{ end }}</body></html>
+//
+//	<!-- theme layer: /layouts/base.jet -->
+//	{{ extends parent }}
+//	{{ block header() }}Brand{{ end }}
+//
+// A template extending "/layouts/base.jet" gets the theme's version, which extends the default version and
+// only overrides the header block.
+package theme
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var (
+	_ jet.Loader    = (*Theme)(nil)
+	_ jet.Lister    = (*Theme)(nil)
+	_ jet.Versioner = (*Theme)(nil)
+	_ jet.Layered   = (*Theme)(nil)
+)
+
+// layerSeparator separates a template path from the index of the layer it's loaded from, as in
+// "/layouts/base.jet#1", which is the path of the templates returned by Parent.
+const layerSeparator = "#"
+
+// Theme implements the jet.Loader interface by stacking layers of loaders: a template is loaded from the
+// highest layer providing it. A template overridden by a higher layer remains available under the path
+// returned by Parent, e.g. "/layouts/base.jet#1" for the template at "/layouts/base.jet" of the second layer.
+type Theme struct {
+	layers []jet.Loader
+}
+
+// NewLoader returns a new theme loader. The layers are passed from the highest to the lowest, i.e. the
+// theme first and the default templates last.
+func NewLoader(layers ...jet.Loader) *Theme {
+	return &Theme{layers: layers}
+}
+
+// split returns the path without layer and the index of the layer from which to load the template at name,
+// -1 if name doesn't specify a layer.
+func (t *Theme) split(name string) (templatePath string, layer int) {
+	i := strings.LastIndex(name, layerSeparator)
+	if i < 0 {
+		return name, -1
+	}
+	layer, err := strconv.Atoi(name[i+len(layerSeparator):])
+	if err != nil || layer < 0 || layer >= len(t.layers) {
+		// a template named like "/a#b.jet"
+		return name, -1
+	}
+	return name[:i], layer
+}
+
+// find returns the path without layer and the index of the layer providing the template at name, -1 if no
+// layer does.
+func (t *Theme) find(name string) (string, int) {
+	templatePath, layer := t.split(name)
+	if layer >= 0 {
+		if !t.layers[layer].Exists(templatePath) {
+			return "", -1
+		}
+		return templatePath, layer
+	}
+	for i, loader := range t.layers {
+		if loader.Exists(templatePath) {
+			return templatePath, i
+		}
+	}
+	return "", -1
+}
+
+// Exists returns true if a layer provides the template at name.
+func (t *Theme) Exists(name string) bool {
+	_, layer := t.find(name)
+	return layer >= 0
+}
+
+// Open opens the template at name from the highest layer providing it, or from the layer name specifies.
+func (t *Theme) Open(name string) (io.ReadCloser, error) {
+	templatePath, layer := t.find(name)
+	if layer < 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return t.layers[layer].Open(templatePath)
+}
+
+// Parent returns the path of the template at the same path as the template at name, in the next lower layer
+// providing one.
+func (t *Theme) Parent(name string) (string, bool) {
+	templatePath, layer := t.find(name)
+	if layer < 0 {
+		return "", false
+	}
+	for i := layer + 1; i < len(t.layers); i++ {
+		if t.layers[i].Exists(templatePath) {
+			return templatePath + layerSeparator + strconv.Itoa(i), true
+		}
+	}
+	return "", false
+}
+
+// Version returns the version of the template from the layer providing it, combined with the index of that
+// layer, so the version also changes when the template starts being served by another layer. The templates of
+// layers not implementing jet.Versioner are assumed to never change.
+func (t *Theme) Version(name string) (string, error) {
+	templatePath, layer := t.find(name)
+	if layer < 0 {
+		return "", &os.PathError{Op: "version", Path: name, Err: os.ErrNotExist}
+	}
+	versioner, ok := t.layers[layer].(jet.Versioner)
+	if !ok {
+		return strconv.Itoa(layer), nil
+	}
+	version, err := versioner.Version(templatePath)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(layer) + "/" + version, nil
+}
+
+// List returns the paths of the templates of all layers in the directory at dirPath and its subdirectories.
+// A template provided by several layers is listed without a layer for the highest one, and with the layer
+// for the lower ones, like Parent returns them: "/layouts/base.jet", "/layouts/base.jet#1", ... so changes
+// to overridden templates are detected as well (see the watch package). All layers must implement
+// jet.Lister; a directory missing from some of the layers is fine, though.
+func (t *Theme) List(dirPath string) ([]string, error) {
+	seen := map[string]bool{}
+	var templates []string
+	for i, loader := range t.layers {
+		lister, ok := loader.(jet.Lister)
+		if !ok {
+			return nil, fmt.Errorf("theme: layer %T can't list its templates", loader)
+		}
+		listed, err := lister.List(dirPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range listed {
+			if seen[name] {
+				templates = append(templates, name+layerSeparator+strconv.Itoa(i))
+				continue
+			}
+			seen[name] = true
+			templates = append(templates, name)
+		}
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
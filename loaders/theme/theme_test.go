@@ -0,0 +1,168 @@
+package theme
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func newLayers() (tenant, brand, base *jet.InMemLoader) {
+	base = jet.NewInMemLoader()
+	base.Set("/layouts/base.jet", `<{{ block header() }}default header{{ end }}|{{ block body() }}{{ end }}|{{ include "footer.jet" }}>`)
+	base.Set("/layouts/footer.jet", `default footer`)
+	base.Set("/page.jet", `{{ extends "layouts/base.jet" }}{{ block body() }}page{{ end }}`)
+
+	brand = jet.NewInMemLoader()
+	brand.Set("/layouts/base.jet", `{{ extends parent }}{{ block header() }}brand header{{ end }}`)
+	brand.Set("/layouts/footer.jet", `brand footer`)
+
+	tenant = jet.NewInMemLoader()
+	tenant.Set("/layouts/base.jet", `{{ extends parent }}{{ block header() }}tenant header{{ end }}`)
+	return tenant, brand, base
+}
+
+func render(set *jet.Set, templatePath string) (string, error) {
+	tt, err := set.GetTemplate(templatePath)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tt.Execute(&buf, nil, nil)
+	return buf.String(), err
+}
+
+func TestExtendsParent(t *testing.T) {
+	tenant, brand, base := newLayers()
+	tests := map[string]struct {
+		layers   []jet.Loader
+		expected string
+	}{
+		"default": {[]jet.Loader{base}, "<default header|page|default footer>"},
+		"brand":   {[]jet.Loader{brand, base}, "<brand header|page|brand footer>"},
+	}
+	for name, test := range tests {
+		got, err := render(jet.NewSet(NewLoader(test.layers...)), "/page.jet")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, got)
+		}
+	}
+
+	got, err := render(jet.NewSet(NewLoader(tenant, brand, base)), "/layouts/base.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<tenant header||brand footer>"; got != expected {
+		t.Errorf("three layers: expected %q, got %q", expected, got)
+	}
+}
+
+func TestExtendsParentErrors(t *testing.T) {
+	_, brand, _ := newLayers()
+	tests := map[string]struct {
+		loader jet.Loader
+		error  string
+	}{
+		"not layered":    {brand, "has no layers"},
+		"not overriding": {NewLoader(brand), "doesn't override a template"},
+	}
+	for name, test := range tests {
+		_, err := jet.NewSet(test.loader).GetTemplate("/layouts/base.jet")
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, test.error, err)
+		}
+	}
+}
+
+func TestParent(t *testing.T) {
+	tenant, brand, base := newLayers()
+	l := NewLoader(tenant, brand, base)
+	tests := map[string]string{
+		"/layouts/base.jet":    "/layouts/base.jet#1",
+		"/layouts/base.jet#1":  "/layouts/base.jet#2",
+		"/layouts/base.jet#2":  "",
+		"/layouts/footer.jet":  "/layouts/footer.jet#2",
+		"/page.jet":            "",
+		"/missing.jet":         "",
+		"/layouts/base.jet#7":  "",
+		"/layouts/base.jet#-1": "",
+	}
+	for name, expected := range tests {
+		got, ok := l.Parent(name)
+		if got != expected || ok != (expected != "") {
+			t.Errorf("Parent(%q): expected %q, got %q, %v", name, expected, got, ok)
+		}
+	}
+
+	if !l.Exists("/layouts/base.jet#2") || l.Exists("/layouts/footer.jet#0") {
+		t.Errorf("templates of a specific layer aren't found as expected")
+	}
+}
+
+func TestVersionAndList(t *testing.T) {
+	tenant, brand, base := newLayers()
+	l := NewLoader(tenant, brand, base)
+
+	before, err := l.Version("/layouts/footer.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	brand.Delete("/layouts/footer.jet")
+	after, err := l.Version("/layouts/footer.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Errorf("expected the version to change when another layer serves the template, got %q twice", before)
+	}
+
+	listed, err := l.List("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/layouts/base.jet", "/layouts/base.jet#1", "/layouts/base.jet#2", "/layouts/footer.jet", "/page.jet"}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("List: expected %v, got %v", want, listed)
+	}
+	for _, name := range listed {
+		if _, err := l.Version(name); err != nil {
+			t.Errorf("Version(%q) of a listed template: %v", name, err)
+		}
+	}
+	base1, _ := l.Version("/layouts/base.jet#1")
+	brand.Set("/layouts/base.jet", `{{ extends parent }}changed`)
+	if base1After, _ := l.Version("/layouts/base.jet#1"); base1After == base1 {
+		t.Errorf("expected the version of /layouts/base.jet#1 to change with the overridden template")
+	}
+}
+
+func TestInvalidateLayers(t *testing.T) {
+	tenant, brand, base := newLayers()
+	brand.Delete("/layouts/base.jet")
+	set := jet.NewSet(NewLoader(tenant, brand, base))
+	if got, err := render(set, "/page.jet"); err != nil || got != "<tenant header|page|brand footer>" {
+		t.Fatalf("unexpected rendering %q, %v", got, err)
+	}
+	if got, err := render(set, "/layouts/base.jet"); err != nil || got != "<tenant header||brand footer>" {
+		t.Fatalf("unexpected rendering %q, %v", got, err)
+	}
+
+	// the templates extending the default layout depend on a layout added in between
+	brand.Set("/layouts/base.jet", `{{ extends parent }}{{ block body() }}brand body{{ end }}`)
+	want := []string{"/layouts/base.jet", "/page.jet"}
+	if got := set.Dependents("/layouts/base.jet#1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("dependents of /layouts/base.jet#1: expected %v, got %v", want, got)
+	}
+	if err := set.Invalidate("/layouts/base.jet#1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := render(set, "/layouts/base.jet"); err != nil || got != "<tenant header|brand body|brand footer>" {
+		t.Errorf("unexpected rendering after invalidating %q, %v", got, err)
+	}
+}
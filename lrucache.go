@@ -0,0 +1,243 @@
+package jet
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// EvictionReason tells why an LRUCache removed a template.
+type EvictionReason int
+
+const (
+	// EvictedCapacity means the template was the least recently used one when the cache was full.
+	EvictedCapacity EvictionReason = iota
+	// EvictedExpired means the template was stored longer than the cache's TTL.
+	EvictedExpired
+	// EvictedExplicitly means the template was removed by Evict(), e.g. through Set.Invalidate().
+	EvictedExplicitly
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictedCapacity:
+		return "capacity"
+	case EvictedExpired:
+		return "expired"
+	case EvictedExplicitly:
+		return "explicit"
+	}
+	return "unknown"
+}
+
+// LRUCacheStats are the counters of an LRUCache, see LRUCache.Stats().
+type LRUCacheStats struct {
+	Hits      uint64 // number of Get() calls returning a template
+	Misses    uint64 // number of Get() calls returning nil
+	Evictions uint64 // number of templates removed, for any EvictionReason
+	Entries   int    // number of templates currently stored
+	Bytes     int64  // estimated size of the templates currently stored
+}
+
+// LRUCache is a concurrency-safe Cache holding a bounded number of templates: when storing a template would
+// exceed the maximum number of entries or the maximum estimated size, the least recently used templates are
+// evicted. Templates may also expire after a fixed time to live. Unlike the default cache, which keeps every
+// template forever, this is suitable for Sets parsing templates from user-generated content or per tenant.
+//
+// The size of a template is estimated from the length of its source. An LRUCache without limits and TTL
+// behaves like the default cache, but still counts hits, misses and evictions.
+type LRUCache struct {
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	onEvict    func(templatePath string, t *Template, reason EvictionReason)
+	now        func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	order     *list.List // of *lruEntry, most recently used first
+	stats     LRUCacheStats
+	onRemoved []func(templatePath string) // see notifyRemoval()
+}
+
+type lruEntry struct {
+	templatePath string
+	t            *Template
+	size         int64
+	expires      time.Time // zero without a TTL
+}
+
+// compile-time check that LRUCache implements Cache, Evicter and removalNotifier
+var (
+	_ Cache           = (*LRUCache)(nil)
+	_ Evicter         = (*LRUCache)(nil)
+	_ removalNotifier = (*LRUCache)(nil)
+)
+
+// LRUCacheOption configures an LRUCache.
+type LRUCacheOption func(*LRUCache)
+
+// WithMaxEntries limits the number of templates an LRUCache holds. Zero, the default, means no limit.
+func WithMaxEntries(n int) LRUCacheOption {
+	return func(c *LRUCache) {
+		c.maxEntries = n
+	}
+}
+
+// WithMaxBytes limits the estimated size of the templates an LRUCache holds. A template larger than the
+// limit isn't stored at all. Zero, the default, means no limit.
+func WithMaxBytes(n int64) LRUCacheOption {
+	return func(c *LRUCache) {
+		c.maxBytes = n
+	}
+}
+
+// WithTTL makes templates expire the given time after they were stored, so they are loaded and parsed again
+// when they are used next. Zero, the default, means templates don't expire.
+func WithTTL(ttl time.Duration) LRUCacheOption {
+	return func(c *LRUCache) {
+		c.ttl = ttl
+	}
+}
+
+// WithEvictionCallback sets a function called for every template removed from an LRUCache. It's called
+// after the cache's lock is released, so it may use the cache. Replacing a template by storing another one
+// under the same path isn't an eviction.
+func WithEvictionCallback(fn func(templatePath string, t *Template, reason EvictionReason)) LRUCacheOption {
+	return func(c *LRUCache) {
+		c.onEvict = fn
+	}
+}
+
+// NewLRUCache returns an LRUCache configured by opts.
+func NewLRUCache(opts ...LRUCacheOption) *LRUCache {
+	c := &LRUCache{
+		now:     time.Now,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *LRUCache) Get(templatePath string) *Template {
+	c.mu.Lock()
+	element, ok := c.entries[templatePath]
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.remove(element)
+		c.stats.Misses++
+		c.stats.Evictions++
+		c.mu.Unlock()
+		c.evicted(entry, EvictedExpired)
+		return nil
+	}
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+	c.mu.Unlock()
+	return entry.t
+}
+
+func (c *LRUCache) Put(templatePath string, t *Template) {
+	entry := &lruEntry{templatePath: templatePath, t: t, size: int64(len(t.text))}
+	if c.ttl > 0 {
+		entry.expires = c.now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	if element, ok := c.entries[templatePath]; ok {
+		c.unlink(element)
+	}
+	if c.maxBytes > 0 && entry.size > c.maxBytes {
+		// storing the template would evict everything else, and still exceed the limit
+		c.removed(templatePath)
+		c.mu.Unlock()
+		return
+	}
+	c.entries[templatePath] = c.order.PushFront(entry)
+	c.stats.Entries++
+	c.stats.Bytes += entry.size
+	var evicted []*lruEntry
+	for (c.maxEntries > 0 && c.stats.Entries > c.maxEntries) || (c.maxBytes > 0 && c.stats.Bytes > c.maxBytes) {
+		oldest := c.order.Back()
+		c.remove(oldest)
+		c.stats.Evictions++
+		evicted = append(evicted, oldest.Value.(*lruEntry))
+	}
+	c.mu.Unlock()
+
+	for _, entry := range evicted {
+		c.evicted(entry, EvictedCapacity)
+	}
+}
+
+func (c *LRUCache) Evict(templatePath string) {
+	c.mu.Lock()
+	element, ok := c.entries[templatePath]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	c.remove(element)
+	c.stats.Evictions++
+	c.mu.Unlock()
+	c.evicted(element.Value.(*lruEntry), EvictedExplicitly)
+}
+
+// Len returns the number of templates in the cache, including expired ones not removed yet.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats.Entries
+}
+
+// Stats returns the current counters of the cache.
+func (c *LRUCache) Stats() LRUCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *LRUCache) notifyRemoval(fn func(templatePath string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRemoved = append(c.onRemoved, fn)
+}
+
+// remove unlinks element from the cache and reports its removal. It must be called with mu held.
+func (c *LRUCache) remove(element *list.Element) {
+	c.unlink(element)
+	c.removed(element.Value.(*lruEntry).templatePath)
+}
+
+// unlink removes element from the cache without reporting it, for replacing the template. It must be called
+// with mu held.
+func (c *LRUCache) unlink(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.templatePath)
+	c.stats.Entries--
+	c.stats.Bytes -= entry.size
+}
+
+// removed calls the functions registered by notifyRemoval() for a template that isn't cached anymore, or
+// wasn't stored. It must be called with mu held.
+func (c *LRUCache) removed(templatePath string) {
+	for _, fn := range c.onRemoved {
+		fn(templatePath)
+	}
+}
+
+// evicted calls the eviction callback for entry. It must be called without mu held.
+func (c *LRUCache) evicted(entry *lruEntry, reason EvictionReason) {
+	if c.onEvict != nil {
+		c.onEvict(entry.templatePath, entry.t, reason)
+	}
+}
@@ -0,0 +1,115 @@
+package jet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type evictionRecord struct {
+	templatePath string
+	reason       EvictionReason
+}
+
+func newLRUTestTemplate(name, text string) *Template {
+	return &Template{Name: name, text: text}
+}
+
+func TestLRUCacheMaxEntries(t *testing.T) {
+	var evictions []evictionRecord
+	c := NewLRUCache(WithMaxEntries(2), WithEvictionCallback(func(templatePath string, _ *Template, reason EvictionReason) {
+		evictions = append(evictions, evictionRecord{templatePath, reason})
+	}))
+
+	a, b := newLRUTestTemplate("/a.jet", "a"), newLRUTestTemplate("/b.jet", "b")
+	c.Put("/a.jet", a)
+	c.Put("/b.jet", b)
+	if c.Get("/a.jet") != a { // makes /b.jet the least recently used template
+		t.Errorf("expected /a.jet to be cached")
+	}
+	c.Put("/c.jet", newLRUTestTemplate("/c.jet", "c"))
+
+	if c.Get("/b.jet") != nil {
+		t.Errorf("expected the least recently used template to be evicted")
+	}
+	if c.Get("/a.jet") != a || c.Get("/c.jet") == nil {
+		t.Errorf("expected the recently used templates to stay cached")
+	}
+	c.Evict("/a.jet")
+	c.Evict("/missing.jet")
+
+	want := []evictionRecord{{"/b.jet", EvictedCapacity}, {"/a.jet", EvictedExplicitly}}
+	if !reflect.DeepEqual(evictions, want) {
+		t.Errorf("evictions: expected %v, got %v", want, evictions)
+	}
+	if want := (LRUCacheStats{Hits: 3, Misses: 1, Evictions: 2, Entries: 1, Bytes: 1}); c.Stats() != want {
+		t.Errorf("stats: expected %+v, got %+v", want, c.Stats())
+	}
+}
+
+func TestLRUCacheMaxBytes(t *testing.T) {
+	c := NewLRUCache(WithMaxBytes(10))
+	c.Put("/a.jet", newLRUTestTemplate("/a.jet", "aaaa"))
+	c.Put("/b.jet", newLRUTestTemplate("/b.jet", "bbbb"))
+	c.Put("/a.jet", newLRUTestTemplate("/a.jet", "aaaaa")) // replaces /a.jet, making it the most recently used
+	if stats := c.Stats(); stats.Entries != 2 || stats.Bytes != 9 || stats.Evictions != 0 {
+		t.Errorf("expected 2 entries of 9 bytes and no evictions, got %+v", stats)
+	}
+
+	c.Put("/c.jet", newLRUTestTemplate("/c.jet", "cc"))
+	if c.Get("/b.jet") != nil || c.Get("/a.jet") == nil || c.Get("/c.jet") == nil {
+		t.Errorf("expected only the least recently used template to be evicted")
+	}
+
+	c.Put("/huge.jet", newLRUTestTemplate("/huge.jet", strings.Repeat("x", 11)))
+	if c.Get("/huge.jet") != nil || c.Len() != 2 {
+		t.Errorf("expected a template exceeding the limit not to be cached, and nothing else evicted")
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	var evictions []evictionRecord
+	c := NewLRUCache(WithTTL(time.Minute), WithEvictionCallback(func(templatePath string, _ *Template, reason EvictionReason) {
+		evictions = append(evictions, evictionRecord{templatePath, reason})
+	}))
+	c.now = func() time.Time { return now }
+
+	c.Put("/a.jet", newLRUTestTemplate("/a.jet", "a"))
+	now = now.Add(30 * time.Second)
+	c.Put("/b.jet", newLRUTestTemplate("/b.jet", "b"))
+	now = now.Add(30 * time.Second)
+
+	if c.Get("/a.jet") != nil {
+		t.Errorf("expected /a.jet to expire")
+	}
+	if c.Get("/b.jet") == nil {
+		t.Errorf("expected /b.jet not to expire yet")
+	}
+	if want := []evictionRecord{{"/a.jet", EvictedExpired}}; !reflect.DeepEqual(evictions, want) {
+		t.Errorf("evictions: expected %v, got %v", want, evictions)
+	}
+}
+
+func TestLRUCacheSet(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/a.jet", "a")
+	loader.Set("/b.jet", "b")
+	c := NewLRUCache(WithMaxEntries(1))
+	set := NewSet(loader, WithCache(c))
+
+	a, err := set.GetTemplate("/a.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.GetTemplate("/b.jet"); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := set.GetTemplate("/a.jet"); err != nil || again == a {
+		t.Errorf("expected /a.jet to be parsed again after it was evicted, got %v", err)
+	}
+	if err := set.Invalidate("/a.jet"); err != nil || c.Len() != 0 {
+		t.Errorf("expected Invalidate() to evict from the LRUCache, got %d entries, %v", c.Len(), err)
+	}
+}
@@ -0,0 +1,86 @@
+package jet
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// member is what a name refers to in a type: a method or a struct field.
+type member struct {
+	method   int   // index of the method in the method set of the type, -1 if there is none
+	field    []int // index sequence of the struct field, nil if there is none
+	exported bool  // whether the field is exported
+}
+
+var (
+	cachedMembers      atomic.Value // map[reflect.Type]map[string]member, never modified once stored
+	cachedMembersMutex sync.Mutex   // serializes additions to cachedMembers
+)
+
+func init() {
+	cachedMembers.Store(map[reflect.Type]map[string]member{})
+}
+
+// membersOf returns the methods and fields of typ by name. Looking a name up with reflect's MethodByName() and
+// FieldByName() is a linear search that allocates, while resolveIndex() does it on almost every field access,
+// so the members of every type are collected once. A name missing from the returned map is neither a method
+// nor a field of typ. The map must not be modified.
+//
+// Like the globals of a Set, the cache is read without locking: adding a type publishes a copy of the cache.
+func membersOf(typ reflect.Type) map[string]member {
+	if members, ok := cachedMembers.Load().(map[reflect.Type]map[string]member)[typ]; ok {
+		return members
+	}
+
+	members := map[string]member{}
+	for i := 0; i < typ.NumMethod(); i++ {
+		members[typ.Method(i).Name] = member{method: i}
+	}
+	if typ.Kind() == reflect.Struct {
+		names := map[string]bool{}
+		collectFieldNames(typ, names, map[reflect.Type]bool{})
+		for name := range names {
+			// FieldByName() resolves promoted fields like Go does, and reports ambiguous names as missing
+			field, ok := typ.FieldByName(name)
+			if !ok {
+				continue
+			}
+			members[name] = member{method: -1, field: field.Index, exported: field.PkgPath == ""}
+		}
+	}
+
+	cachedMembersMutex.Lock()
+	old := cachedMembers.Load().(map[reflect.Type]map[string]member)
+	cache := make(map[reflect.Type]map[string]member, len(old)+1)
+	for t, m := range old {
+		cache[t] = m
+	}
+	cache[typ] = members
+	cachedMembers.Store(cache)
+	cachedMembersMutex.Unlock()
+	return members
+}
+
+// collectFieldNames adds the names of the fields of the struct type typ to names, including the names of fields
+// promoted from embedded structs and pointers to structs.
+func collectFieldNames(typ reflect.Type, names map[string]bool, visited map[reflect.Type]bool) {
+	if visited[typ] {
+		return
+	}
+	visited[typ] = true
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		names[field.Name] = true
+		if !field.Anonymous {
+			continue
+		}
+		embedded := field.Type
+		if embedded.Kind() == reflect.Ptr {
+			embedded = embedded.Elem()
+		}
+		if embedded.Kind() == reflect.Struct {
+			collectFieldNames(embedded, names, visited)
+		}
+	}
+}
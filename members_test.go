@@ -0,0 +1,146 @@
+package jet
+
+import (
+	"reflect"
+	"testing"
+)
+
+type memberBase struct {
+	ID    int
+	Title string
+}
+
+func (memberBase) Kind() string { return "base" }
+
+type memberLinks struct {
+	URL string
+}
+
+type memberItem struct {
+	memberBase
+	*memberLinks
+	Title  string // shadows memberBase.Title
+	Tags   map[string]string
+	secret string
+}
+
+func (i *memberItem) Label() string { return i.Title + "!" }
+
+func TestResolveIndexMembers(t *testing.T) {
+	item := &memberItem{memberBase: memberBase{ID: 7, Title: "base"}, memberLinks: &memberLinks{URL: "/item"}, Title: "item", Tags: map[string]string{"Label": "tag"}}
+	tests := []struct {
+		v    reflect.Value
+		name string
+		want interface{}
+		err  string
+	}{
+		{reflect.ValueOf(item), "Title", "item", ""},
+		{reflect.ValueOf(item), "ID", 7, ""},
+		{reflect.ValueOf(item), "URL", "/item", ""},
+		{reflect.ValueOf(item), "Label", "item!", ""},
+		{reflect.ValueOf(item), "Kind", "base", ""},
+		{reflect.ValueOf(*item), "Kind", "base", ""},
+		{reflect.ValueOf(item), "secret", nil, "secret is an unexported field of struct type jet.memberItem"},
+		{reflect.ValueOf(item), "Missing", nil, "can't use Missing as field name in struct type jet.memberItem"},
+		// the method set of a map value doesn't hide its keys
+		{reflect.ValueOf(item.Tags), "Label", "tag", ""},
+		{reflect.ValueOf((*memberItem)(nil)), "ID", nil, "nil pointer evaluating *jet.memberItem.ID"},
+	}
+	for _, test := range tests {
+		got, err := resolveIndex(test.v, reflect.Value{}, test.name)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s.%s: got error %v, want %s", test.v.Type(), test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s.%s: unexpected error: %v", test.v.Type(), test.name, err)
+			continue
+		}
+		if got.Kind() == reflect.Func {
+			got = got.Call(nil)[0]
+		}
+		if got.Interface() != test.want {
+			t.Errorf("%s.%s: got %v, want %v", test.v.Type(), test.name, got, test.want)
+		}
+	}
+
+	// a method found on the pointer to an addressable value
+	v := reflect.ValueOf(item).Elem()
+	got, err := resolveIndex(v, reflect.ValueOf("Label"), "")
+	if err != nil || got.Call(nil)[0].String() != "item!" {
+		t.Errorf("Label on addressable value: got %v, %v", got, err)
+	}
+}
+
+func TestExecuteSetField(t *testing.T) {
+	item := &memberItem{memberBase: memberBase{Title: "base"}, Title: "old"}
+	RunJetTest(t, nil, item, "set_field_shadowing", `{{ .Title = "new" }}{{ .Title }}`, "new")
+	if item.memberBase.Title != "base" {
+		t.Errorf("setting the shadowing field changed the promoted one to %q", item.memberBase.Title)
+	}
+}
+
+func BenchmarkResolveIndexField(b *testing.B) {
+	v := reflect.ValueOf(&memberItem{Title: "item"})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resolveIndex(v, reflect.Value{}, "Title")
+	}
+}
+
+func BenchmarkResolveIndexPromotedField(b *testing.B) {
+	v := reflect.ValueOf(&memberItem{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resolveIndex(v, reflect.Value{}, "ID")
+	}
+}
+
+func BenchmarkResolveIndexMethod(b *testing.B) {
+	v := reflect.ValueOf(&memberItem{Title: "item"})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resolveIndex(v, reflect.Value{}, "Label")
+	}
+}
+
+func BenchmarkResolveIndexMapKey(b *testing.B) {
+	v := reflect.ValueOf(map[string]string{"key": "value"})
+	index := reflect.ValueOf("key")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resolveIndex(v, index, "")
+	}
+}
+
+func BenchmarkChainFieldAccess(b *testing.B) {
+	JetTestingLoader.Set("BenchChainFieldAccess", `{{ range items }}{{ .Title }}{{ .ID }}{{ .Label() }}{{ end }}`)
+	t, _ := JetTestingSet.GetTemplate("BenchChainFieldAccess")
+	items := make([]*memberItem, 100)
+	for i := range items {
+		items[i] = &memberItem{Title: "item"}
+	}
+	vars := VarMap{}.Set("items", items)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.Execute(ww, vars, nil)
+	}
+}
+
+func BenchmarkExecuteSetField(b *testing.B) {
+	JetTestingLoader.Set("BenchExecuteSetField", `{{ range items }}{{ .Title = "x" }}{{ end }}`)
+	t, _ := JetTestingSet.GetTemplate("BenchExecuteSetField")
+	items := make([]*memberItem, 100)
+	for i := range items {
+		items[i] = &memberItem{}
+	}
+	vars := VarMap{}.Set("items", items)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.Execute(ww, vars, nil)
+	}
+}
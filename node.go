@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"reflect"
 )
 
 var textFormat = "%s" //Changed to "%q" in tests for better error messages.
@@ -27,6 +28,7 @@ type Node interface {
 	String() string
 	Position() Pos
 	line() int
+	base() *NodeBase
 	error(error)
 	errorf(string, ...interface{})
 }
@@ -57,12 +59,23 @@ func (node *NodeBase) line() int {
 	return node.Line
 }
 
+func (node *NodeBase) base() *NodeBase {
+	return node
+}
+
 func (node *NodeBase) error(err error) {
-	node.errorf("%s", err)
+	panic(&Error{
+		TemplatePath: filepath.ToSlash(node.TemplatePath),
+		Line:         node.Line,
+		Pos:          node.Pos,
+		Err:          err,
+		runtime:      true,
+		base:         node,
+	})
 }
 
 func (node *NodeBase) errorf(format string, v ...interface{}) {
-	panic(fmt.Errorf("Jet Runtime Error (%q:%d): %s", filepath.ToSlash(node.TemplatePath), node.Line, fmt.Sprintf(format, v...)))
+	node.error(fmt.Errorf(format, v...))
 }
 
 // Type returns itself and provides an easy default implementation
@@ -118,6 +131,9 @@ const (
 type ListNode struct {
 	NodeBase
 	Nodes []Node //The element nodes in lexical order.
+
+	vars []string // variables declared by the list's actions, by slot
+	exec execFunc // compiled form of the list, if the template was compiled
 }
 
 func (l *ListNode) append(n Node) {
@@ -211,6 +227,13 @@ func (c *CommandNode) String() string {
 type IdentifierNode struct {
 	NodeBase
 	Ident string //The identifier's name.
+
+	// set by resolveVariables() for variables declared in the template source
+	static bool // whether the variable lives in a slot known at parse time
+	hops   int  // number of scopes to walk up from the current one to reach the variable's scope
+	slot   int  // index of the variable in its scope's slots
+
+	constant bool // whether the identifier refers to a constant of the Set, set by markConstants()
 }
 
 func (i *IdentifierNode) String() string {
@@ -419,6 +442,8 @@ type BranchNode struct {
 	Expression Expression
 	List       *ListNode
 	ElseList   *ListNode
+
+	vars []string // variables declared by the branch's let statement, by slot
 }
 
 func (b *BranchNode) String() string {
@@ -576,6 +601,17 @@ func (node *binaryExprNode) String() string {
 	return fmt.Sprintf("%s %s %s", node.Left, node.Operator.val, node.Right)
 }
 
+// Op returns the operator of the expression as written in Go, e.g. "+", "==" or "&&" (also for "and").
+func (node *binaryExprNode) Op() string {
+	switch node.Operator.typ {
+	case itemAnd:
+		return "&&"
+	case itemOr:
+		return "||"
+	}
+	return node.Operator.val
+}
+
 // AdditiveExprNode represents an add or subtract expression
 // ex: expression ( '+' | '-' ) expression
 type AdditiveExprNode struct {
@@ -620,6 +656,16 @@ func (s *NotExprNode) String() string {
 type CallArgs struct {
 	Exprs       []Expression
 	HasPipeSlot bool
+
+	compiled []evalFunc // compiled form of Exprs, if the template was compiled; nil for '_'
+}
+
+// eval evaluates the argument expression at index i, which must not be '_'.
+func (args *CallArgs) eval(st *Runtime, i int) reflect.Value {
+	if args.compiled != nil {
+		return args.compiled[i](st)
+	}
+	return st.evalPrimaryExpressionGroup(args.Exprs[i])
 }
 
 // CallExprNode represents a call expression
@@ -706,8 +752,132 @@ type catchNode struct {
 	NodeBase
 	Err  *IdentifierNode
 	List *ListNode
+
+	vars []string // the error variable, if any
 }
 
 func (n *catchNode) String() string {
 	return fmt.Sprintf("{{catch %s}}%s{{end}}", n.Err, n.List)
 }
+
+// walk calls fn for node and, as long as fn returns true, recursively for every node below it in lexical order.
+func walk(node Node, fn func(Node) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+	switch node := node.(type) {
+	case *ListNode:
+		for _, n := range node.Nodes {
+			walk(n, fn)
+		}
+	case *ActionNode:
+		if node.Set != nil {
+			walk(node.Set, fn)
+		}
+		if node.Pipe != nil {
+			walk(node.Pipe, fn)
+		}
+	case *PipeNode:
+		for _, cmd := range node.Cmds {
+			walk(cmd, fn)
+		}
+	case *CommandNode:
+		walk(node.BaseExpr, fn)
+		for _, expr := range node.Exprs {
+			walk(expr, fn)
+		}
+	case *SetNode:
+		for _, expr := range node.Left {
+			walk(expr, fn)
+		}
+		for _, expr := range node.Right {
+			walk(expr, fn)
+		}
+	case *IfNode:
+		walkBranch(&node.BranchNode, fn)
+	case *RangeNode:
+		walkBranch(&node.BranchNode, fn)
+	case *BlockParameterList:
+		for _, p := range node.List {
+			walk(p.Expression, fn)
+		}
+	case *BlockNode:
+		if node.Parameters != nil {
+			walk(node.Parameters, fn)
+		}
+		walk(node.Expression, fn)
+		walk(node.List, fn)
+		if node.Content != nil {
+			walk(node.Content, fn)
+		}
+	case *YieldNode:
+		if node.Parameters != nil {
+			walk(node.Parameters, fn)
+		}
+		walk(node.Expression, fn)
+		if node.Content != nil {
+			walk(node.Content, fn)
+		}
+	case *IncludeNode:
+		walk(node.Name, fn)
+		walk(node.Context, fn)
+	case *ReturnNode:
+		walk(node.Value, fn)
+	case *TryNode:
+		walk(node.List, fn)
+		if node.Catch != nil {
+			walk(node.Catch, fn)
+		}
+	case *catchNode:
+		if node.Err != nil {
+			walk(node.Err, fn)
+		}
+		walk(node.List, fn)
+	case *ChainNode:
+		walk(node.Node, fn)
+	case *AdditiveExprNode:
+		walk(node.Left, fn)
+		walk(node.Right, fn)
+	case *MultiplicativeExprNode:
+		walk(node.Left, fn)
+		walk(node.Right, fn)
+	case *ComparativeExprNode:
+		walk(node.Left, fn)
+		walk(node.Right, fn)
+	case *NumericComparativeExprNode:
+		walk(node.Left, fn)
+		walk(node.Right, fn)
+	case *LogicalExprNode:
+		walk(node.Left, fn)
+		walk(node.Right, fn)
+	case *NotExprNode:
+		walk(node.Expr, fn)
+	case *CallExprNode:
+		walk(node.BaseExpr, fn)
+		for _, expr := range node.Exprs {
+			walk(expr, fn)
+		}
+	case *TernaryExprNode:
+		walk(node.Boolean, fn)
+		walk(node.Left, fn)
+		walk(node.Right, fn)
+	case *IndexExprNode:
+		walk(node.Base, fn)
+		walk(node.Index, fn)
+	case *SliceExprNode:
+		walk(node.Base, fn)
+		walk(node.Index, fn)
+		walk(node.EndIndex, fn)
+	}
+}
+
+func walkBranch(node *BranchNode, fn func(Node) bool) {
+	if node.Set != nil {
+		walk(node.Set, fn)
+	}
+	walk(node.Expression, fn)
+	walk(node.List, fn)
+	if node.ElseList != nil {
+		walk(node.ElseList, fn)
+	}
+}
@@ -0,0 +1,386 @@
+package jet
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// optimize rewrites the syntax tree of the template: constant subexpressions are replaced by their values,
+// branches of if statements that can never execute are dropped, and adjacent text nodes are merged. The
+// rewritten tree executes exactly like the original one; expressions that fail to evaluate are left alone so
+// they still fail at runtime. constants are the constants the template's identifiers refer to, see
+// markConstants().
+func (t *Template) optimize(constants VarMap) {
+	o := &optimizer{
+		t:         t,
+		constants: constants,
+		lists:     map[*ListNode]bool{},
+	}
+	o.st = &Runtime{scope: &scope{}, escapeeWriter: &escapeeWriter{set: t.set}}
+
+	o.list(t.Root)
+	for _, block := range t.passedBlocks {
+		o.list(block.List)
+		o.list(block.Content)
+	}
+}
+
+// markConstants marks the identifiers of the template that refer to a constant of the Set (see AddConstant())
+// and returns those constants. An identifier refers to a constant if no variable or block parameter of that
+// name is declared anywhere in the template; it then resolves to the constant even where a variable of the
+// same name was passed to Execute() or declared by an including template, just like when optimize() replaced
+// it by the constant's value.
+func (t *Template) markConstants() VarMap {
+	constants := t.set.loadConstants()
+	if len(constants) == 0 {
+		return constants
+	}
+	walkAll := func(fn func(Node) bool) {
+		walk(t.Root, fn)
+		for _, block := range t.passedBlocks {
+			walk(block, fn)
+		}
+	}
+	walkAll(func(n Node) bool {
+		switch n := n.(type) {
+		case *SetNode:
+			if n.Let {
+				shadow(constants, n.Left...)
+			}
+		case *catchNode:
+			if n.Err != nil {
+				shadow(constants, n.Err)
+			}
+		case *BlockNode:
+			if n.Parameters != nil {
+				for _, p := range n.Parameters.List {
+					delete(constants, p.Identifier)
+				}
+			}
+		}
+		return true
+	})
+	walkAll(func(n Node) bool {
+		if ident, ok := n.(*IdentifierNode); ok && !ident.static {
+			_, ident.constant = constants[ident.Ident]
+		}
+		return true
+	})
+	return constants
+}
+
+// shadow removes the variables declared by exprs from constants.
+func shadow(constants VarMap, exprs ...Expression) {
+	for _, expr := range exprs {
+		if ident, ok := expr.(*IdentifierNode); ok {
+			delete(constants, ident.Ident)
+		}
+	}
+}
+
+type optimizer struct {
+	t         *Template
+	constants VarMap             // constants that can be substituted
+	lists     map[*ListNode]bool // lists optimized already
+	st        *Runtime           // to evaluate constant expressions
+}
+
+// list optimizes the nodes of list.
+func (o *optimizer) list(list *ListNode) {
+	if list == nil || o.lists[list] {
+		return
+	}
+	o.lists[list] = true
+
+	nodes := make([]Node, 0, len(list.Nodes))
+	returns := false // whether a node before the current one sets the list's return value, see executeList()
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *ActionNode:
+			o.set(node.Set)
+			o.pipe(node.Pipe)
+		case *IfNode:
+			o.set(node.Set)
+			node.Expression = o.expr(node.Expression)
+			o.list(node.List)
+			o.list(node.ElseList)
+			if node.Set != nil {
+				break
+			}
+			v, ok := o.eval(node.Expression)
+			if !ok {
+				break
+			}
+			body := node.ElseList
+			if isTrue(v) {
+				body = node.List
+			} else if body == nil {
+				continue // like executeList(), neither executes anything nor changes the return value
+			}
+			if !returns && !declares(body) {
+				// the list's return value is still unset, so it ends up the same as when executing body
+				// as a list of its own; without declarations, body doesn't need a scope of its own either
+				nodes = append(nodes, body.Nodes...)
+				for _, n := range body.Nodes {
+					returns = returns || setsReturnValue(n)
+				}
+				continue
+			}
+			node.Expression = &BoolNode{NodeBase: NodeBase{TemplatePath: node.TemplatePath, NodeType: NodeBool, Pos: node.Pos, Line: node.Line}, True: true}
+			node.List, node.ElseList = body, nil
+		case *RangeNode:
+			o.set(node.Set)
+			o.list(node.List)
+			o.list(node.ElseList)
+		case *TryNode:
+			o.list(node.List)
+			if node.Catch != nil {
+				o.list(node.Catch.List)
+			}
+		case *YieldNode:
+			o.parameters(node.Parameters)
+			node.Expression = o.expr(node.Expression)
+			o.list(node.Content)
+		case *BlockNode:
+			o.parameters(node.Parameters)
+			node.Expression = o.expr(node.Expression)
+			o.list(node.List)
+			o.list(node.Content)
+		case *IncludeNode:
+			node.Name = o.expr(node.Name)
+			node.Context = o.expr(node.Context)
+		case *ReturnNode:
+			node.Value = o.expr(node.Value)
+		}
+		returns = returns || setsReturnValue(node)
+		nodes = append(nodes, node)
+	}
+	list.Nodes = mergeText(nodes)
+}
+
+// declares reports whether list declares variables in its own scope.
+func declares(list *ListNode) bool {
+	for _, node := range list.Nodes {
+		if action, ok := node.(*ActionNode); ok && action.Set != nil && action.Set.Let {
+			return true
+		}
+	}
+	return false
+}
+
+// setsReturnValue reports whether executeList() sets the list's return value when executing node.
+func setsReturnValue(node Node) bool {
+	switch node.Type() {
+	case NodeIf, NodeRange, NodeTry, NodeInclude, NodeReturn:
+		return true
+	}
+	return false
+}
+
+// mergeText merges adjacent text nodes in nodes and drops empty ones.
+func mergeText(nodes []Node) []Node {
+	merged := nodes[:0]
+	var last *TextNode
+	for _, node := range nodes {
+		text, ok := node.(*TextNode)
+		if !ok {
+			merged = append(merged, node)
+			last = nil
+			continue
+		}
+		if len(text.Text) == 0 {
+			continue
+		}
+		if last == nil {
+			last = text
+			merged = append(merged, node)
+			continue
+		}
+		// the text of the original nodes may be shared, so the merged node gets a copy
+		joined := make([]byte, 0, len(last.Text)+len(text.Text))
+		joined = append(append(joined, last.Text...), text.Text...)
+		last = &TextNode{NodeBase: last.NodeBase, Text: joined}
+		merged[len(merged)-1] = last
+	}
+	return merged
+}
+
+func (o *optimizer) set(set *SetNode) {
+	if set == nil {
+		return
+	}
+	for i, expr := range set.Right {
+		set.Right[i] = o.expr(expr)
+	}
+}
+
+func (o *optimizer) parameters(params *BlockParameterList) {
+	if params == nil {
+		return
+	}
+	for i := range params.List {
+		params.List[i].Expression = o.expr(params.List[i].Expression)
+	}
+}
+
+func (o *optimizer) pipe(pipe *PipeNode) {
+	if pipe == nil {
+		return
+	}
+	for i, cmd := range pipe.Cmds {
+		if i == 0 && cmd.Exprs == nil {
+			// the base expression is only a value (and not a function to call) in the first command without arguments
+			cmd.BaseExpr = o.expr(cmd.BaseExpr)
+		}
+		o.args(cmd.Exprs)
+	}
+}
+
+func (o *optimizer) args(exprs []Expression) {
+	for i, expr := range exprs {
+		exprs[i] = o.expr(expr)
+	}
+}
+
+// expr returns node with its constant subexpressions folded.
+func (o *optimizer) expr(node Expression) Expression {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *IdentifierNode:
+		if _, ok := o.constants[n.Ident]; !ok {
+			return node
+		}
+	case *PipeNode:
+		o.pipe(n)
+		return node
+	case *ChainNode:
+		if expr, ok := n.Node.(Expression); ok {
+			n.Node = o.expr(expr)
+		}
+		return node
+	case *CallExprNode:
+		o.args(n.Exprs)
+		return node
+	case *IndexExprNode:
+		n.Base, n.Index = o.expr(n.Base), o.expr(n.Index)
+		return node
+	case *SliceExprNode:
+		n.Base, n.Index, n.EndIndex = o.expr(n.Base), o.expr(n.Index), o.expr(n.EndIndex)
+		return node
+	case *AdditiveExprNode:
+		n.Left, n.Right = o.expr(n.Left), o.expr(n.Right)
+		if !o.isConstant(n.Left) || !o.isConstant(n.Right) {
+			return node
+		}
+	case *MultiplicativeExprNode:
+		n.Left, n.Right = o.expr(n.Left), o.expr(n.Right)
+		if !o.isConstant(n.Left) || !o.isConstant(n.Right) {
+			return node
+		}
+	case *ComparativeExprNode:
+		n.Left, n.Right = o.expr(n.Left), o.expr(n.Right)
+		if !o.isConstant(n.Left) || !o.isConstant(n.Right) {
+			return node
+		}
+	case *NumericComparativeExprNode:
+		n.Left, n.Right = o.expr(n.Left), o.expr(n.Right)
+		if !o.isConstant(n.Left) || !o.isConstant(n.Right) {
+			return node
+		}
+	case *LogicalExprNode:
+		n.Left, n.Right = o.expr(n.Left), o.expr(n.Right)
+		left, ok := o.eval(n.Left)
+		if !ok {
+			return node
+		}
+		// the right operand doesn't have to be constant if it isn't evaluated
+		if short := n.Operator.typ == itemAnd && !isTrue(left) || n.Operator.typ == itemOr && isTrue(left); !short && !o.isConstant(n.Right) {
+			return node
+		}
+	case *NotExprNode:
+		n.Expr = o.expr(n.Expr)
+		if !o.isConstant(n.Expr) {
+			return node
+		}
+	case *TernaryExprNode:
+		n.Boolean, n.Left, n.Right = o.expr(n.Boolean), o.expr(n.Left), o.expr(n.Right)
+		if v, ok := o.eval(n.Boolean); ok {
+			if isTrue(v) {
+				return n.Left
+			}
+			return n.Right
+		}
+		return node
+	default:
+		return node
+	}
+
+	v, ok := o.try(node)
+	if !ok {
+		return node
+	}
+	if literal := o.literal(node, v); literal != nil {
+		return literal
+	}
+	return node
+}
+
+// isConstant reports whether node is a literal or a constant identifier.
+func (o *optimizer) isConstant(node Expression) bool {
+	switch n := node.(type) {
+	case *BoolNode, *NumberNode, *StringNode, *NilNode:
+		return true
+	case *IdentifierNode:
+		_, ok := o.constants[n.Ident]
+		return ok
+	}
+	return false
+}
+
+// eval evaluates node if it's constant. Nodes that aren't literals or constant identifiers were folded
+// by expr() already where possible, so they aren't constant.
+func (o *optimizer) eval(node Expression) (v reflect.Value, ok bool) {
+	if !o.isConstant(node) {
+		return reflect.Value{}, false
+	}
+	if ident, isIdent := node.(*IdentifierNode); isIdent {
+		return indirectEface(o.constants[ident.Ident]), true
+	}
+	return o.try(node)
+}
+
+// try evaluates node, reporting false if that fails.
+func (o *optimizer) try(node Expression) (v reflect.Value, ok bool) {
+	defer func() {
+		if recover() != nil {
+			v, ok = reflect.Value{}, false
+		}
+	}()
+	return o.st.evalPrimaryExpressionGroup(node), true
+}
+
+// literal returns a literal node evaluating to v in place of node, or nil if v can't be written as a literal.
+func (o *optimizer) literal(node Expression, v reflect.Value) Expression {
+	base := NodeBase{TemplatePath: o.t.Name, Pos: node.Position(), Line: node.line()}
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Type() {
+	case boolType:
+		base.NodeType = NodeBool
+		return &BoolNode{NodeBase: base, True: v.Bool()}
+	case stringType:
+		base.NodeType = NodeString
+		return &StringNode{NodeBase: base, Quoted: strconv.Quote(v.String()), Text: v.String()}
+	case float64Type:
+		// number literals evaluate to float64 values, see evalBaseExpressionGroup()
+		n, err := o.t.newNumber(base.Pos, strconv.FormatFloat(v.Float(), 'g', -1, 64), itemNumber)
+		if err != nil || !n.IsFloat || n.Float64 != v.Float() {
+			return nil
+		}
+		n.Line = base.Line
+		return n
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package jet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOptimizeTree(t *testing.T) {
+	set := NewSet(NewInMemLoader(), WithSafeWriter(nil), WithOptimization())
+	set.AddConstant("debug", false)
+	set.AddConstant("title", "Jet")
+	set.AddConstant("perPage", 20)
+	set.AddGlobal("user", "admin")
+	p := ParserTestCase{T: t, set: set}
+
+	p.ExpectPrint(`{{ "a" + "b" }}`, `{{"ab"}}`)
+	p.ExpectPrint(`{{ 2 * 60 }}`, `{{120}}`)
+	p.ExpectPrint(`{{ !true }}`, `{{false}}`)
+	p.ExpectPrint(`{{ 1 < 2 && "x" == "x" }}`, `{{true}}`)
+	p.ExpectPrint(`{{ false && user }}`, `{{false}}`)
+	p.ExpectPrint(`{{ true ? user : "nobody" }}`, `{{user}}`)
+	p.ExpectPrint(`{{ user + ("!" + "!") }}`, `{{user + "!!"}}`)
+	p.ExpectPrint(`{{ title + " " + user }}`, `{{"Jet " + user}}`)
+	p.ExpectPrint(`{{ upper("a" + "b") }}`, `{{upper("ab")}}`)
+	p.ExpectPrint(`{{ perPage * 2 }}`, `{{40}}`)
+	// int values can't be written as number literals, which always evaluate to float64 values
+	p.ExpectPrint(`{{ perPage }}{{ perPage % 7 }}`, `{{perPage}}{{perPage % 7}}`)
+	// failing expressions are left alone
+	p.ExpectPrint(`{{ "a" - "b" }}`, `{{"a" - "b"}}`)
+
+	p.ExpectPrint(`a{{ if false }}b{{ end }}c`, `ac`)
+	p.ExpectPrint(`a{{ if 1 > 2 }}b{{ else }}c{{ end }}d`, `acd`)
+	p.ExpectPrint(`a{{ if debug }}b{{ else if user }}c{{ end }}d`, "a{{if user}}c{{end}}d")
+	p.ExpectPrint(`{{ if perPage > 10 }}many{{ end }}`, `many`)
+	// lists with declarations keep their scope
+	p.ExpectPrint(`{{ if true }}{{ x := 1 }}{{ x }}{{ end }}`, "{{if true}}{{x:=1}}{{x}}{{end}}")
+	// a preceding return value must not be overwritten by the body
+	p.ExpectPrint(`{{ return 1 }}{{ if true }}a{{ end }}`, "return 1{{if true}}a{{end}}")
+	// variables and block parameters shadow constants
+	p.ExpectPrint(`{{ debug := true }}{{ if debug }}a{{ end }}`, "{{debug:=true}}{{if debug}}a{{end}}")
+	p.ExpectPrint(`{{ block b(title) }}{{ title }}{{ end }}`, "{{block b(title)}}{{title}}{{end}}")
+}
+
+func TestAddConstant(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/flags.jet", `{{ if beta }}beta{{ else }}stable{{ end }} {{ version + 1 }}`)
+	set := NewSet(loader, WithOptimization())
+	set.AddConstant("beta", true)
+	set.AddConstant("version", 2)
+
+	tt, err := set.GetTemplate("/flags.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tt.Root.String(), "beta {{3}}"; got != want {
+		t.Errorf("got tree %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "beta 3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// a global replacing a constant isn't constant anymore
+	set.AddGlobal("beta", true)
+	if _, ok := set.loadConstants()["beta"]; ok {
+		t.Error("beta is still a constant after AddGlobal()")
+	}
+	tt, err = set.Parse("/flags2.jet", `{{ if beta }}beta{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tt.Root.String(), "{{if beta}}beta{{end}}"; got != want {
+		t.Errorf("got tree %q, want %q", got, want)
+	}
+}
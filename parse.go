@@ -39,12 +39,16 @@ type Template struct {
 	passedBlocks    map[string]*BlockNode
 	Root            *ListNode // top-level root of the tree.
 
-	text string // text parsed to create the template (or its parent)
+	text         string   // text parsed to create the template (or its parent)
+	version      string   // version of the template when it was loaded, see Versioner
+	dependencies []string // paths of the templates the template depends on, see Dependencies()
 
 	// Parsing only; cleared after parse.
-	lex       *lexer
-	token     [3]item // three-token lookahead for parser.
-	peekCount int
+	lex         *lexer
+	token       [3]item // three-token lookahead for parser.
+	peekCount   int
+	parseErrors []*Error  // errors recovered from so far, in error recovery mode
+	loading     *loadCall // load of the template in flight, see Set.loadOnce()
 }
 
 func (t *Template) String() (template string) {
@@ -74,6 +78,26 @@ func (t *Template) String() (template string) {
 	return
 }
 
+// Extends returns the template t extends, or nil if t doesn't extend another template.
+func (t *Template) Extends() *Template {
+	return t.extends
+}
+
+// Imports returns the templates imported by t, in the order of the import statements.
+func (t *Template) Imports() []*Template {
+	return append([]*Template(nil), t.imports...)
+}
+
+// Blocks returns the blocks yielded by name when executing t: the blocks defined in t and in the
+// templates it extends and imports, with blocks defined in t overriding inherited and imported ones.
+func (t *Template) Blocks() map[string]*BlockNode {
+	blocks := make(map[string]*BlockNode, len(t.processedBlocks))
+	for name, block := range t.processedBlocks {
+		blocks[name] = block
+	}
+	return blocks
+}
+
 func (t *Template) addBlocks(blocks map[string]*BlockNode) {
 	if len(blocks) == 0 {
 		return
@@ -152,14 +176,25 @@ func (t *Template) peekNonSpace() (token item) {
 
 // errorf formats the error and terminates processing.
 func (t *Template) errorf(format string, args ...interface{}) {
-	t.Root = nil
-	format = fmt.Sprintf("template: %s:%d: %s", t.ParseName, t.lex.lineNumber(), format)
-	panic(fmt.Errorf(format, args...))
+	t.error(fmt.Errorf(format, args...))
 }
 
 // error terminates processing.
 func (t *Template) error(err error) {
-	t.errorf("%s", err)
+	panic(t.newError(err))
+}
+
+// newError returns an *Error for err at the current position of the parser.
+func (t *Template) newError(err error) *Error {
+	e := &Error{
+		TemplatePath: t.ParseName,
+		Line:         t.lex.lineNumber(),
+		Pos:          t.lex.lastPos,
+		Err:          err,
+		template:     t,
+	}
+	e.locate(t.text)
+	return e
 }
 
 // expect consumes the next token and guarantees it has the required type.
@@ -204,22 +239,118 @@ func (t *Template) recover(errp *error) {
 		if _, ok := e.(runtime.Error); ok {
 			panic(e)
 		}
+		*errp = e.(error)
 		if t != nil {
+			t.Root = nil
 			t.lex.drain()
 			t.stopParse()
+			if err, ok := e.(*Error); ok && t.set.parseErrorRecovery {
+				t.recordError(err)
+				*errp = ParseErrors(t.parseErrors)
+			}
 		}
-		*errp = e.(error)
 	}
 	return
 }
 
+// recordError adds err to the errors recovered from, unless it's a repetition of the previous error (as happens
+// when an unexpected EOF bubbles up through several nested lists).
+func (t *Template) recordError(err *Error) {
+	if n := len(t.parseErrors); n > 0 && t.parseErrors[n-1].Pos == err.Pos && t.parseErrors[n-1].Err.Error() == err.Err.Error() {
+		return
+	}
+	t.parseErrors = append(t.parseErrors, err)
+}
+
+// recoveringTextOrAction is textOrAction for use in loops over a list of nodes. In error recovery mode, it records a
+// syntax error instead of terminating processing, skips to the end of the broken action (and to the matching {{end}}
+// if the action opens a list of its own, e.g. {{if}}), and returns nil. Processing still terminates at EOF and after
+// lexing errors, since the lexer stops at the first error it encounters.
+func (t *Template) recoveringTextOrAction() (n Node) {
+	if !t.set.parseErrorRecovery {
+		return t.textOrAction()
+	}
+
+	keyword := itemError
+	if token := t.nextNonSpace(); token.typ == itemLeftDelim {
+		keyword = t.peekNonSpace().typ
+		t.backup2(token)
+	} else {
+		t.backup()
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		err, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		t.recordError(err)
+		t.skipAction()
+		switch t.peek().typ {
+		case itemError:
+			panic(r) // the lexer gave up, so must we
+		case itemEOF:
+			return
+		}
+		switch keyword {
+		case itemIf, itemRange, itemBlock, itemTry:
+			t.skipList()
+		}
+	}()
+
+	return t.textOrAction()
+}
+
+// skipAction consumes tokens up to and including the next closing delimiter.
+func (t *Template) skipAction() {
+	if t.peekCount == 0 && t.token[0].typ == itemRightDelim {
+		return // the offending token was the closing delimiter
+	}
+	for {
+		switch t.next().typ {
+		case itemRightDelim:
+			return
+		case itemEOF, itemError:
+			t.backup()
+			return
+		}
+	}
+}
+
+// skipList parses and discards the remaining items of a list up to and including its {{end}}, still recording
+// any errors found along the way.
+func (t *Template) skipList() {
+	for {
+		_, next := t.itemList(nodeElse, nodeCatch, nodeContent, nodeEnd)
+		switch next.Type() {
+		case nodeEnd:
+			return
+		case nodeElse:
+			if t.peekNonSpace().typ == itemIf {
+				// {{else if ...}}: the condition is irrelevant
+				t.skipAction()
+			}
+		}
+	}
+}
+
 func (s *Set) parse(name, text string, cacheAfterParsing bool) (t *Template, err error) {
+	return s.parseLoaded(nil, name, text, cacheAfterParsing)
+}
+
+// parseLoaded is parse for a template loaded as the load in flight call, see Set.loadOnce().
+func (s *Set) parseLoaded(call *loadCall, name, text string, cacheAfterParsing bool) (t *Template, err error) {
 	t = &Template{
 		Name:         name,
 		ParseName:    name,
 		text:         text,
 		set:          s,
 		passedBlocks: make(map[string]*BlockNode),
+		loading:      call,
 	}
 	defer t.recover(&err)
 
@@ -241,6 +372,21 @@ func (s *Set) parse(name, text string, cacheAfterParsing bool) (t *Template, err
 
 	t.addBlocks(t.passedBlocks)
 
+	if len(t.parseErrors) > 0 {
+		t.Root = nil
+		return t, ParseErrors(t.parseErrors)
+	}
+
+	t.dependencies = t.findDependencies()
+	resolveVariables(t.Root)
+	constants := t.markConstants()
+	if s.optimizeTemplates {
+		t.optimize(constants)
+	}
+	if s.compileTemplates {
+		t.compile()
+	}
+
 	return t, err
 }
 
@@ -253,6 +399,20 @@ func (t *Template) expectString(context string) string {
 	return s
 }
 
+// parentPath returns the path of the template t overrides in a lower layer of the Set's Loader, for
+// {{ extends parent }}.
+func (t *Template) parentPath() string {
+	layered, ok := t.set.loader.(Layered)
+	if !ok {
+		t.errorf("extends parent: the loader %T has no layers", t.set.loader)
+	}
+	parentPath, ok := layered.Parent(t.Name)
+	if !ok {
+		t.errorf("extends parent: %s doesn't override a template of a lower layer", t.Name)
+	}
+	return parentPath
+}
+
 // parse is the top-level parser for a template, essentially the same
 // It runs to EOF.
 func (t *Template) parseTemplate(cacheAfterParsing bool) (next Node) {
@@ -266,7 +426,13 @@ func (t *Template) parseTemplate(cacheAfterParsing bool) (next Node) {
 		if delim.typ == itemLeftDelim {
 			token := t.nextNonSpace()
 			if token.typ == itemExtends || token.typ == itemImport {
-				s := t.expectString("extends|import")
+				var s string
+				if next := t.peekNonSpace(); token.typ == itemExtends && next.typ == itemIdentifier && next.val == "parent" {
+					t.nextNonSpace()
+					s = t.parentPath()
+				} else {
+					s = t.expectString("extends|import")
+				}
 				if token.typ == itemExtends {
 					if t.extends != nil {
 						t.errorf("Unexpected extends clause: each template can only extend one template")
@@ -274,12 +440,12 @@ func (t *Template) parseTemplate(cacheAfterParsing bool) (next Node) {
 						t.errorf("Unexpected extends clause: the 'extends' clause should come before all import clauses")
 					}
 					var err error
-					t.extends, err = t.set.getSiblingTemplate(s, t.Name, cacheAfterParsing)
+					t.extends, err = t.set.getDependency(t, s, cacheAfterParsing)
 					if err != nil {
 						t.error(err)
 					}
 				} else {
-					tt, err := t.set.getSiblingTemplate(s, t.Name, cacheAfterParsing)
+					tt, err := t.set.getDependency(t, s, cacheAfterParsing)
 					if err != nil {
 						t.error(err)
 					}
@@ -297,8 +463,16 @@ func (t *Template) parseTemplate(cacheAfterParsing bool) (next Node) {
 	}
 
 	for t.peek().typ != itemEOF {
-		switch n := t.textOrAction(); n.Type() {
+		n := t.recoveringTextOrAction()
+		if n == nil {
+			continue
+		}
+		switch n.Type() {
 		case nodeEnd, nodeElse, nodeContent:
+			if t.set.parseErrorRecovery {
+				t.recordError(t.newError(fmt.Errorf("unexpected %s", n)))
+				continue
+			}
 			t.errorf("unexpected %s", n)
 		default:
 			t.Root.append(n)
@@ -316,6 +490,7 @@ func (t *Template) startParse(lex *lexer) {
 // stopParse terminates parsing.
 func (t *Template) stopParse() {
 	t.lex = nil
+	t.loading = nil
 }
 
 // IsEmptyTree reports whether this tree (node) is empty of everything but space.
@@ -491,7 +666,10 @@ func (t *Template) parseReturn() Node {
 func (t *Template) itemList(terminatedBy ...NodeType) (list *ListNode, next Node) {
 	list = t.newList(t.peekNonSpace().pos)
 	for t.peekNonSpace().typ != itemEOF {
-		n := t.textOrAction()
+		n := t.recoveringTextOrAction()
+		if n == nil {
+			continue
+		}
 		for _, terminatorType := range terminatedBy {
 			if n.Type() == terminatorType {
 				return list, n
@@ -1004,7 +1182,7 @@ func (t *Template) parseCatch() *catchNode {
 	if peek.typ != itemRightDelim {
 		_errVar := t.term()
 		if typ := _errVar.Type(); typ != NodeIdentifier {
-			t.errorf("unexpected node type '%s' in catch", typ)
+			t.errorf("unexpected node '%s' in catch (expected identifier)", _errVar)
 		}
 		errVar = _errVar.(*IdentifierNode)
 	}
@@ -16,8 +16,10 @@ package jet
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"path"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -136,3 +138,60 @@ func TestParseTemplateWithCustomDelimiters(t *testing.T) {
 	p := ParserTestCase{T: t, set: set}
 	p.TestPrintFile("custom_delimiters.jet")
 }
+
+func TestParseErrorRecovery(t *testing.T) {
+	set := NewSet(NewInMemLoader(), WithParseErrorRecovery())
+
+	tests := []struct {
+		input  string
+		errors []string
+	}{
+		{
+			"{{ 1 + }}\nok {{ .Name }}\n{{ foo(1, *) }}\n{{ if }}{{ bar[ }}{{ else }}x{{ end }}\n{{ end }}",
+			[]string{
+				"template: /t.jet:1: parsing command: unexpected token '}}' (expected term)",
+				"template: /t.jet:3: parsing call expression argument list: unexpected token '*' (expected term)",
+				"template: /t.jet:4: parsing if: unexpected token '}}' (expected term)",
+				"template: /t.jet:4: parsing index|slice expression: unexpected token '}}' (expected term)",
+				"template: /t.jet:5: unexpected {{end}}",
+			},
+		},
+		{
+			"{{ range .Items }}{{ . + }}",
+			[]string{
+				"template: /t.jet:1: parsing command: unexpected token '}}' (expected term)",
+				"template: /t.jet:1: unexpected EOF",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := set.Parse("/t.jet", test.input)
+		var errs ParseErrors
+		if !errors.As(err, &errs) {
+			t.Errorf("%q: expected ParseErrors, got %T: %v", test.input, err, err)
+			continue
+		}
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		if !reflect.DeepEqual(got, test.errors) {
+			t.Errorf("%q: expected errors\n%s\ngot\n%s", test.input, strings.Join(test.errors, "\n"), strings.Join(got, "\n"))
+		}
+		var e *Error
+		if !errors.As(err, &e) || e != errs[0] {
+			t.Errorf("%q: expected errors.As to find the first *Error", test.input)
+		}
+	}
+
+	// the lexer stops at the first error, so recovery stops there as well
+	_, err := set.Parse("/t.jet", "{{ 1 + }}{{ foo( }}{{ 1 + }}")
+	if expected := "template: /t.jet:1: parsing command: unexpected token '}}' (expected term)\ntemplate: /t.jet:1: unclosed left parenthesis"; err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+
+	if _, err := set.Parse("/ok.jet", "{{ if true }}fine{{ end }}"); err != nil {
+		t.Errorf("unexpected error parsing valid template: %v", err)
+	}
+}
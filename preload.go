@@ -0,0 +1,126 @@
+package jet
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PreloadAll parses all templates of the Set's Loader up front and puts them into the Set's cache, so no
+// request has to wait for a template to be parsed and broken templates are found right away. The Loader must
+// implement Lister. Templates are recognized by the extensions configured for the Set (see
+// WithTemplateNameExtensions()); if the Set only uses the empty extension, every file of the Loader is a template.
+//
+// The templates are parsed in parallel, by as many workers as Go runs goroutines simultaneously
+// (see runtime.GOMAXPROCS()). PreloadAll parses all templates even if some fail, and then returns a
+// PreloadErrors listing every failure. If ctx is done before all templates are parsed, PreloadAll stops
+// early and returns ctx.Err().
+func (s *Set) PreloadAll(ctx context.Context) error {
+	lister, ok := s.loader.(Lister)
+	if !ok {
+		return fmt.Errorf("jet: PreloadAll() needs a Loader implementing Lister, %T doesn't", s.loader)
+	}
+	files, err := lister.List("/")
+	if err != nil {
+		return err
+	}
+
+	paths := make(chan string)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures PreloadErrors
+	)
+	workers := runtime.GOMAXPROCS(0)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for templatePath := range paths {
+				if _, err := s.getTemplate(templatePath, true); err != nil {
+					mu.Lock()
+					failures = append(failures, &PreloadError{TemplatePath: templatePath, Err: err})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, templatePath := range files {
+		if !s.IsTemplateFile(templatePath) {
+			continue
+		}
+		select {
+		case paths <- templatePath:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(paths)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].TemplatePath < failures[j].TemplatePath })
+		return failures
+	}
+	return nil
+}
+
+// IsTemplateFile reports whether the file at filePath has one of the Set's template name extensions. All
+// files are templates if the Set only uses the empty extension.
+func (s *Set) IsTemplateFile(filePath string) bool {
+	onlyEmpty := true
+	for _, extension := range s.extensions {
+		if extension == "" {
+			continue
+		}
+		if strings.HasSuffix(filePath, extension) {
+			return true
+		}
+		onlyEmpty = false
+	}
+	return onlyEmpty
+}
+
+// PreloadError is the failure of a single template to load or parse in Set.PreloadAll().
+type PreloadError struct {
+	TemplatePath string // path of the template, as listed by the Loader
+	Err          error  // the error loading or parsing the template
+}
+
+func (e *PreloadError) Error() string {
+	return e.TemplatePath + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error loading or parsing the template.
+func (e *PreloadError) Unwrap() error {
+	return e.Err
+}
+
+// PreloadErrors is the error returned by Set.PreloadAll() when templates fail to load or parse. It holds
+// an error per failed template, in lexical order of the templates' paths.
+type PreloadErrors []*PreloadError
+
+func (errs PreloadErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("jet: %d template(s) failed to preload:\n%s", len(errs), strings.Join(msgs, "\n"))
+}
+
+// Unwrap returns the individual errors, making them available to errors.Is() and errors.As().
+func (errs PreloadErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+	for i, err := range errs {
+		unwrapped[i] = err
+	}
+	return unwrapped
+}
@@ -0,0 +1,77 @@
+package jet
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPreloadAll(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/layout.jet", `<html>{{ block body() }}{{ end }}</html>`)
+	loader.Set("/views/index.html.jet", `{{ extends "/layout.jet" }}{{ block body() }}index{{ end }}`)
+	loader.Set("/views/about.jet", `{{ extends "/layout.jet" }}{{ block body() }}about{{ end }}`)
+	loader.Set("/static/style.css", `body { color: red }`)
+	set := NewSet(loader)
+
+	if err := set.PreloadAll(context.Background()); err != nil {
+		t.Fatalf("preloading templates: %v", err)
+	}
+	cached := map[string]bool{}
+	set.cache.(*cache).m.Range(func(templatePath, _ interface{}) bool {
+		cached[templatePath.(string)] = true
+		return true
+	})
+	for _, templatePath := range []string{"/layout.jet", "/views/index.html.jet", "/views/about.jet"} {
+		if !cached[templatePath] {
+			t.Errorf("%s wasn't cached", templatePath)
+		}
+	}
+	if cached["/static/style.css"] {
+		t.Errorf("/static/style.css was parsed, but isn't a template")
+	}
+}
+
+func TestPreloadAllErrors(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/ok.jet", `fine`)
+	loader.Set("/b/broken.jet", `{{ if }}`)
+	loader.Set("/a/missing_parent.jet", `{{ extends "/nope.jet" }}`)
+	set := NewSet(loader)
+
+	err := set.PreloadAll(context.Background())
+	var errs PreloadErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected PreloadErrors, got %v", err)
+	}
+	if len(errs) != 2 || errs[0].TemplatePath != "/a/missing_parent.jet" || errs[1].TemplatePath != "/b/broken.jet" {
+		t.Fatalf("expected errors for /a/missing_parent.jet and /b/broken.jet, got %v", err)
+	}
+	var parseErr *Error
+	if !errors.As(errs[1], &parseErr) || parseErr.TemplatePath != "/b/broken.jet" {
+		t.Errorf("expected the parse error of /b/broken.jet, got %v", errs[1].Err)
+	}
+	if !strings.Contains(err.Error(), "2 template(s) failed") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	if set.cache.Get("/ok.jet") == nil {
+		t.Errorf("/ok.jet wasn't cached despite the other failures")
+	}
+}
+
+func TestPreloadAllCanceled(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/a.jet", `a`)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewSet(loader).PreloadAll(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPreloadAllNeedsLister(t *testing.T) {
+	if err := NewSet(noLoader{}).PreloadAll(context.Background()); err == nil {
+		t.Errorf("expected an error preloading from a Loader that can't list its templates")
+	}
+}
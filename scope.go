@@ -0,0 +1,297 @@
+package jet
+
+import "reflect"
+
+// slot holds a variable declared in the template source.
+type slot struct {
+	value reflect.Value
+	set   bool // false until the declaration was executed
+}
+
+// lookup returns the variable called name if it was declared in sc.
+func (sc *scope) lookup(name string) (reflect.Value, bool) {
+	for i := range sc.names {
+		if sc.names[i] == name && sc.slots[i].set {
+			return sc.slots[i].value, true
+		}
+	}
+	v, ok := sc.variables[name]
+	return v, ok
+}
+
+// let declares a variable in sc, or overwrites it if it was already declared in sc.
+func (sc *scope) let(name string, val reflect.Value) {
+	for i := range sc.names {
+		if sc.names[i] == name {
+			sc.slots[i] = slot{value: val, set: true}
+			return
+		}
+	}
+	if sc.variables == nil {
+		sc.variables = make(VarMap)
+	}
+	sc.variables[name] = val
+}
+
+// assign overwrites the variable called name and reports whether it was declared in sc.
+func (sc *scope) assign(name string, val reflect.Value) bool {
+	for i := range sc.names {
+		if sc.names[i] == name && sc.slots[i].set {
+			sc.slots[i].value = val
+			return true
+		}
+	}
+	if _, ok := sc.variables[name]; ok {
+		sc.variables[name] = val
+		return true
+	}
+	return false
+}
+
+// variableNames returns the names of all variables declared in sc.
+func (sc *scope) variableNames() []string {
+	names := make([]string, 0, len(sc.names)+len(sc.variables))
+	for i := range sc.names {
+		if sc.slots[i].set {
+			names = append(names, sc.names[i])
+		}
+	}
+	for name := range sc.variables {
+		names = append(names, name)
+	}
+	return names
+}
+
+// slotOf returns the slot of a variable resolved by resolveVariables().
+func (st *Runtime) slotOf(ident *IdentifierNode) *slot {
+	sc := st.scope
+	for i := 0; i < ident.hops; i++ {
+		sc = sc.parent
+	}
+	return &sc.slots[ident.slot]
+}
+
+// letIdent declares the variable ident in the current scope.
+func (st *Runtime) letIdent(ident Expression, val reflect.Value) {
+	if ident, ok := ident.(*IdentifierNode); ok && ident.static {
+		st.scope.slots[ident.slot] = slot{value: val, set: true}
+		return
+	}
+	st.scope.let(ident.String(), val)
+}
+
+// varFrame is the parse-time view of a scope pushed while executing a template.
+type varFrame struct {
+	names   *[]string      // the scope's slot layout, stored in the node that pushes the scope
+	visible map[string]int // slots of the variables declared so far
+	pushed  bool           // whether the scope exists at this point; a list's scope is only pushed by its first declaration
+}
+
+// varResolver mirrors the way the runtime pushes and pops scopes to resolve variables to slots at parse time.
+type varResolver struct {
+	frames []*varFrame
+}
+
+// resolveVariables assigns a slot to every variable declared in the template source, and resolves every
+// reference to such a variable to the slot, so it can be read without looking it up by name at runtime.
+//
+// Only references to variables declared in the same template region are resolved: blocks, yield contents,
+// and the parameters and context of blocks and yields run in scopes that depend on the caller and are left
+// to lookups by name, as are references to anything else (variables passed to Execute(), block parameters,
+// variables of including templates, globals, ...).
+func resolveVariables(root *ListNode) {
+	new(varResolver).list(root)
+}
+
+func (r *varResolver) push(names *[]string, pushed bool) *varFrame {
+	f := &varFrame{names: names, visible: map[string]int{}, pushed: pushed}
+	r.frames = append(r.frames, f)
+	return f
+}
+
+func (r *varResolver) pop() {
+	r.frames = r.frames[:len(r.frames)-1]
+}
+
+// region resolves the nodes visited by fn without access to the variables declared so far.
+func (r *varResolver) region(fn func()) {
+	frames := r.frames
+	r.frames = nil
+	fn()
+	r.frames = frames
+}
+
+func (r *varResolver) declare(node Expression) {
+	ident, ok := node.(*IdentifierNode)
+	if !ok {
+		return
+	}
+	f := r.frames[len(r.frames)-1]
+	idx, ok := f.visible[ident.Ident]
+	if !ok {
+		idx = len(*f.names)
+		for i, name := range *f.names {
+			if name == ident.Ident {
+				idx = i
+			}
+		}
+		if idx == len(*f.names) {
+			*f.names = append(*f.names, ident.Ident)
+		}
+		f.visible[ident.Ident] = idx
+	}
+	ident.static, ident.hops, ident.slot = true, 0, idx
+}
+
+func (r *varResolver) reference(ident *IdentifierNode) {
+	hops := 0
+	for i := len(r.frames) - 1; i >= 0; i-- {
+		f := r.frames[i]
+		if !f.pushed {
+			continue
+		}
+		if idx, ok := f.visible[ident.Ident]; ok {
+			ident.static, ident.hops, ident.slot = true, hops, idx
+			return
+		}
+		hops++
+	}
+	ident.static = false
+}
+
+func (r *varResolver) expr(node Node) {
+	walk(node, func(n Node) bool {
+		if ident, ok := n.(*IdentifierNode); ok {
+			r.reference(ident)
+		}
+		return true
+	})
+}
+
+// declarations resolves a let statement, see executeLetList().
+func (r *varResolver) declarations(set *SetNode) {
+	if set.IndexExprGetLookup {
+		r.expr(set.Right[0])
+		r.declare(set.Left[0])
+		r.declare(set.Left[1])
+		return
+	}
+	for i := range set.Left {
+		r.expr(set.Right[i])
+		r.declare(set.Left[i])
+	}
+}
+
+// assignments resolves an assignment statement, see executeSetList().
+func (r *varResolver) assignments(set *SetNode) {
+	for _, right := range set.Right {
+		r.expr(right)
+	}
+	for _, left := range set.Left {
+		r.expr(left)
+	}
+}
+
+func (r *varResolver) list(list *ListNode) {
+	if list == nil {
+		return
+	}
+	f := r.push(&list.vars, false)
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *ActionNode:
+			if node.Set != nil {
+				if node.Set.Let {
+					f.pushed = true
+					r.declarations(node.Set)
+				} else {
+					r.assignments(node.Set)
+				}
+			}
+			if node.Pipe != nil {
+				r.expr(node.Pipe)
+			}
+		case *IfNode:
+			r.branch(&node.BranchNode)
+		case *RangeNode:
+			r.branch(&node.BranchNode)
+		case *TryNode:
+			r.list(node.List)
+			if node.Catch != nil {
+				if node.Catch.Err != nil {
+					r.push(&node.Catch.vars, true)
+					r.declare(node.Catch.Err)
+					r.list(node.Catch.List)
+					r.pop()
+				} else {
+					r.list(node.Catch.List)
+				}
+			}
+		case *YieldNode:
+			r.region(func() {
+				r.parameters(node.Parameters)
+				r.expr(node.Expression)
+				r.list(node.Content)
+			})
+		case *BlockNode:
+			r.region(func() {
+				r.parameters(node.Parameters)
+				r.expr(node.Expression)
+				r.list(node.List)
+				r.list(node.Content)
+			})
+		case *IncludeNode:
+			r.expr(node.Name)
+			if node.Context != nil {
+				// the context is evaluated in the scope pushed for the included template
+				r.push(new([]string), true)
+				r.expr(node.Context)
+				r.pop()
+			}
+		case *ReturnNode:
+			r.expr(node.Value)
+		}
+	}
+	r.pop()
+}
+
+func (r *varResolver) parameters(params *BlockParameterList) {
+	if params != nil {
+		r.expr(params)
+	}
+}
+
+// branch resolves an if or range node, see executeList().
+func (r *varResolver) branch(node *BranchNode) {
+	if node.Set == nil || !node.Set.Let {
+		if node.Set != nil {
+			r.assignments(node.Set)
+		}
+		r.expr(node.Expression)
+		r.list(node.List)
+		r.list(node.ElseList)
+		return
+	}
+
+	if node.NodeType == NodeIf {
+		r.push(&node.vars, true)
+		r.declarations(node.Set)
+		r.expr(node.Expression)
+		r.list(node.List)
+		r.list(node.ElseList)
+		r.pop()
+		return
+	}
+
+	// the range expression is evaluated before the range's scope is pushed
+	r.expr(node.Set.Right[0])
+	f := r.push(&node.vars, true)
+	for _, left := range node.Set.Left {
+		r.declare(left)
+	}
+	r.list(node.List)
+	// the range variables are not set when running the else branch
+	f.visible = map[string]int{}
+	r.list(node.ElseList)
+	r.pop()
+}
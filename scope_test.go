@@ -0,0 +1,84 @@
+package jet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveVariables(t *testing.T) {
+	set := NewSet(NewInMemLoader())
+	tt, err := set.Parse("/vars.jet", `{{ a := 1 }}{{ if b := 2; b > a }}{{ c := a + b }}{{ c }}{{ end }}{{ block x() }}{{ a }}{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var idents []*IdentifierNode
+	walk(tt.Root, func(n Node) bool {
+		if ident, ok := n.(*IdentifierNode); ok {
+			idents = append(idents, ident)
+		}
+		return true
+	})
+
+	expected := []struct {
+		name      string
+		static    bool
+		hops, pos int
+	}{
+		{"a", true, 0, 0}, // a := 1
+		{"b", true, 0, 0}, // b := 2
+		{"b", true, 0, 0}, // b > a
+		{"a", true, 1, 0},
+		{"c", true, 0, 0}, // c := a + b
+		{"a", true, 2, 0},
+		{"b", true, 1, 0},
+		{"c", true, 0, 0},  // {{ c }}
+		{"a", false, 0, 0}, // blocks run in the caller's scopes
+	}
+	if len(idents) != len(expected) {
+		t.Fatalf("expected %d identifiers, got %d", len(expected), len(idents))
+	}
+	for i, e := range expected {
+		ident := idents[i]
+		if ident.Ident != e.name || ident.static != e.static || (e.static && (ident.hops != e.hops || ident.slot != e.pos)) {
+			t.Errorf("identifier %d: expected %s static=%v hops=%d slot=%d, got %s static=%v hops=%d slot=%d",
+				i, e.name, e.static, e.hops, e.pos, ident.Ident, ident.static, ident.hops, ident.slot)
+		}
+	}
+}
+
+func TestSlotScoping(t *testing.T) {
+	vars := make(VarMap)
+	vars.Set("outer", "from Execute")
+	vars.SetFunc("letInner", func(a Arguments) reflect.Value {
+		a.runtime.Let("inner", "from Go")
+		return reflect.Value{}
+	})
+
+	RunJetTest(t, vars, nil, "slots_redeclare", `{{ x := 1 }}{{ x := x + 1 }}{{ x }}`, "2")
+	RunJetTest(t, vars, nil, "slots_shadow", `{{ x := 1 }}{{ if true }}{{ x }}{{ x := 2 }}{{ x }}{{ end }}{{ x }}`, "121")
+	RunJetTest(t, vars, nil, "slots_assign_outer", `{{ x := 1 }}{{ if true }}{{ x = 2 }}{{ end }}{{ x }}`, "2")
+	RunJetTest(t, vars, nil, "slots_multi_let", `{{ a, b := 1, 2 }}{{ a, b := b, a }}{{ a }}{{ b }}`, "22")
+	RunJetTest(t, vars, nil, "slots_range_else", `{{ v := "outer" }}{{ range v := slice() }}{{ v }}{{ else }}{{ v }}{{ end }}`, "outer")
+	RunJetTest(t, vars, nil, "slots_range_vars", `{{ s := "" }}{{ range i, v := slice("a", "b") }}{{ s = s + v }}{{ end }}{{ s }}`, "ab")
+	RunJetTest(t, vars, nil, "slots_catch", `{{ try }}{{ missing }}{{ catch err }}{{ if err }}caught{{ end }}{{ end }}`, "caught")
+	RunJetTest(t, vars, nil, "slots_execute_vars", `{{ outer }}`, "from Execute")
+	RunJetTest(t, vars, nil, "slots_block", `{{ y := "from caller" }}{{ block b() }}{{ y }}{{ end }}`, "from caller")
+	RunJetTest(t, vars, nil, "slots_runtime_let", `{{ letInner() }}{{ inner }}{{ isset(inner) ? "set" : "unset" }}`, "from Goset")
+	RunJetTest(t, vars, nil, "slots_nil", `{{ x := nil }}{{ isset(x) ? "set" : "unset" }}`, "unset")
+	JetTestingLoader.Set("slots_include_partial", `{{ . }}{{ c }}`)
+	RunJetTest(t, vars, nil, "slots_include_context", `{{ c := "ctx" }}{{ include "slots_include_partial" c }}`, "ctxctx")
+	RunJetTest(t, vars, nil, "slots_include_if_exists", `{{ c := "ctx" }}{{ includeIfExists("slots_include_partial", c) }}`, "ctxctx")
+}
+
+func BenchmarkLocalVariables(b *testing.B) {
+	JetTestingLoader.Set("BenchLocalVariables", `{{ range i := ints(0, 10) }}{{ a := i }}{{ b := a * 2 }}{{ if c := a + b; c > 5 }}{{ c }}{{ end }}{{ end }}`)
+	t, _ := JetTestingSet.GetTemplate("BenchLocalVariables")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := t.Execute(ww, nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
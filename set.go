@@ -7,24 +7,42 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
+	"time"
 )
 
 // Set is responsible to load, parse and cache templates.
 // Every Jet template is associated with a Set.
 type Set struct {
-	loader          Loader
-	cache           Cache
-	escapee         SafeWriter    // escapee to use at runtime
-	globals         VarMap        // global scope for this template set
-	gmx             *sync.RWMutex // global variables map mutex
-	extensions      []string
-	developmentMode bool
-	leftDelim       string
-	rightDelim      string
-	leftComment       string
-	rightComment     string
+	loader             Loader
+	cache              Cache
+	escapee            SafeWriter      // escapee to use at runtime
+	globals            atomic.Value    // global scope for this template set; holds a VarMap that is never modified once stored
+	gmx                *sync.Mutex     // serializes changes to globals and constants
+	constants          map[string]bool // names of the globals added by AddConstant(); guarded by gmx
+	extensions         []string
+	developmentMode    bool
+	leftDelim          string
+	rightDelim         string
+	leftComment        string
+	rightComment       string
+	parseErrorRecovery bool
+	compileTemplates   bool
+	optimizeTemplates  bool
+	bundle             *Bundle // templates to use instead of parsing them, see WithBundle()
+
+	depsMutex sync.Mutex
+	deps      map[string][]string // dependencies of the cached templates, by name; guarded by depsMutex
+
+	loadsMutex sync.Mutex
+	loads      map[string]*loadCall // loads of templates in flight, by canonical path; guarded by loadsMutex
+
+	missTTL     time.Duration // how long a template is remembered as missing, see WithNegativeCache()
+	missesMutex sync.Mutex
+	misses      map[string]time.Time // expiry of the templates found missing, by path; guarded by missesMutex
 }
 
 // Option is the type of option functions that can be used in NewSet().
@@ -40,8 +58,7 @@ func NewSet(loader Loader, opts ...Option) *Set {
 		loader:  loader,
 		cache:   &cache{},
 		escapee: template.HTMLEscape,
-		globals: VarMap{},
-		gmx:     &sync.RWMutex{},
+		gmx:     &sync.Mutex{},
 		extensions: []string{
 			"", // in case the path is given with the correct extension already
 			".jet",
@@ -50,16 +67,29 @@ func NewSet(loader Loader, opts ...Option) *Set {
 		},
 	}
 
+	s.globals.Store(VarMap{})
+
 	for _, opt := range opts {
 		opt(s)
 	}
 
+	if notifier, ok := s.cache.(removalNotifier); ok {
+		notifier.notifyRemoval(s.forgetDependencies)
+	}
+	if s.bundle != nil {
+		s.cache = &bundleCache{Cache: s.cache, bundle: s.bundle, set: s}
+		s.deps = make(map[string][]string, len(s.bundle.dependencies))
+		for name, dependencies := range s.bundle.dependencies {
+			s.deps[name] = dependencies
+		}
+	}
+
 	return s
 }
 
 // WithCache returns an option function that sets the cache to use for template parsing results.
 // Use InDevelopmentMode() to disable caching of parsed templates. By default, Jet uses a
-// concurrency-safe in-memory cache that holds templates forever.
+// concurrency-safe in-memory cache that holds templates forever; see NewLRUCache() for a bounded one.
 func WithCache(c Cache) Option {
 	if c == nil {
 		panic(errors.New("jet: WithCache() must not be called with a nil cache"))
@@ -109,7 +139,8 @@ func WithTemplateNameExtensions(extensions []string) Option {
 }
 
 // InDevelopmentMode returns an option function that toggles development mode on, meaning the cache will
-// always be bypassed and every template lookup will go to the loader.
+// always be bypassed and every template lookup will go to the loader. To pick up changed templates without
+// parsing them on every lookup, use a VersionedCache instead (see WithCache()).
 func InDevelopmentMode() Option {
 	return DevelopmentMode(true)
 }
@@ -122,6 +153,49 @@ func DevelopmentMode(mode bool) Option {
 	}
 }
 
+// WithNegativeCache returns an option function making the Set remember for the given time that a template
+// could not be found, so repeated requests for it don't probe the Loader with every extension again. A
+// template added meanwhile is found once the time passed, or right away after calling Invalidate() for it.
+// Negative results aren't cached in development mode.
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(s *Set) {
+		s.missTTL = ttl
+	}
+}
+
+// WithParseErrorRecovery returns an option function that makes the parser report all syntax errors in a template
+// at once instead of stopping at the first one: after an error, the parser skips to the end of the broken action
+// (or to the {{end}} of a broken {{if}}, {{range}}, {{block}} or {{try}}) and carries on. Parsing a template with
+// errors then fails with a ParseErrors value holding every error found, in source order. This is mostly useful
+// for development and linting.
+func WithParseErrorRecovery() Option {
+	return func(s *Set) {
+		s.parseErrorRecovery = true
+	}
+}
+
+// WithCompilation returns an option function that makes the Set compile every template after parsing it: the
+// syntax tree is turned into a tree of pre-bound Go closures (with constants converted and pipelines split
+// up front), which Template.Execute() then runs instead of interpreting the syntax tree node by node. Compiling
+// makes parsing slower and templates bigger in memory in exchange for faster rendering.
+func WithCompilation() Option {
+	return func(s *Set) {
+		s.compileTemplates = true
+	}
+}
+
+// WithOptimization returns an option function that makes the Set optimize every template after parsing it:
+// constant expressions like `"a" + "b"`, `2 * 60` or `!true` are evaluated once instead of on every render,
+// branches of if statements with constant conditions that can never execute are removed, and adjacent text is
+// merged. Constants added with AddConstant() are folded as well, so templates can drop whole branches
+// depending on them, for example on a feature flag. The optimized templates render like the unoptimized ones,
+// since constants take precedence over variables of the same name either way (see AddConstant()).
+func WithOptimization() Option {
+	return func(s *Set) {
+		s.optimizeTemplates = true
+	}
+}
+
 // GetTemplate tries to find (and parse, if not yet parsed) the template at the specified path.
 //
 // For example, GetTemplate("catalog/products.list") with extensions set to []string{"", ".html.jet",".jet"}
@@ -136,29 +210,58 @@ func (s *Set) GetTemplate(templatePath string) (t *Template, err error) {
 }
 
 func (s *Set) getSiblingTemplate(templatePath, siblingPath string, cacheAfterParsing bool) (t *Template, err error) {
+	return s.getTemplate(s.SiblingTemplatePath(templatePath, siblingPath), cacheAfterParsing)
+}
+
+// SiblingTemplatePath returns the absolute path of the template at templatePath, relative to the directory
+// of the template at siblingPath unless it's absolute or a path like "@namespace/path" of a Loader
+// implementing Namespaced. This is how the paths of extends, import and include statements are resolved,
+// e.g. by tools compiling templates ahead of time.
+func (s *Set) SiblingTemplatePath(templatePath, siblingPath string) string {
 	templatePath = filepath.ToSlash(templatePath)
-	siblingPath = filepath.ToSlash(siblingPath)
+	if namespaced, ok := s.loader.(Namespaced); ok && strings.HasPrefix(templatePath, "@") {
+		name, rest := templatePath[1:], ""
+		if i := strings.Index(name, "/"); i >= 0 {
+			name, rest = name[:i], name[i+1:]
+		}
+		if dir, ok := namespaced.Namespace(name); ok {
+			return path.Join("/", dir, rest)
+		}
+	}
 	if !path.IsAbs(templatePath) {
-		siblingDir := path.Dir(siblingPath)
+		siblingDir := path.Dir(filepath.ToSlash(siblingPath))
 		templatePath = path.Join(siblingDir, templatePath)
 	}
-	return s.getTemplate(templatePath, cacheAfterParsing)
+	return templatePath
 }
 
 // same as GetTemplate, but doesn't cache a template when found through the loader.
 func (s *Set) getTemplate(templatePath string, cacheAfterParsing bool) (t *Template, err error) {
+	return s.getTemplateFor(nil, templatePath, cacheAfterParsing)
+}
+
+// getDependency returns the template at templatePath (relative to t) that t extends or imports, while t is
+// being parsed.
+func (s *Set) getDependency(t *Template, templatePath string, cacheAfterParsing bool) (*Template, error) {
+	return s.getTemplateFor(t.loading, s.SiblingTemplatePath(templatePath, t.Name), cacheAfterParsing)
+}
+
+// getTemplateFor is getTemplate for the template needed by the load in flight parent, nil if the template
+// isn't needed to parse another one.
+func (s *Set) getTemplateFor(parent *loadCall, templatePath string, cacheAfterParsing bool) (t *Template, err error) {
 	if !s.developmentMode {
+		if c, ok := s.cache.(*bundleCache); ok {
+			if err := c.decodeErr(); err != nil {
+				return nil, err
+			}
+		}
 		t, found := s.getTemplateFromCache(templatePath)
 		if found {
 			return t, nil
 		}
 	}
 
-	t, err = s.getTemplateFromLoader(templatePath, cacheAfterParsing)
-	if err == nil && cacheAfterParsing && !s.developmentMode {
-		s.cache.Put(templatePath, t)
-	}
-	return t, err
+	return s.getTemplateFromLoader(parent, templatePath, cacheAfterParsing)
 }
 
 func (s *Set) getTemplateFromCache(templatePath string) (t *Template, ok bool) {
@@ -172,18 +275,161 @@ func (s *Set) getTemplateFromCache(templatePath string) (t *Template, ok bool) {
 	return nil, false
 }
 
-func (s *Set) getTemplateFromLoader(templatePath string, cacheAfterParsing bool) (t *Template, err error) {
+func (s *Set) getTemplateFromLoader(parent *loadCall, templatePath string, cacheAfterParsing bool) (t *Template, err error) {
+	if s.isMissing(templatePath) {
+		return nil, fmt.Errorf("template %s could not be found", templatePath)
+	}
 	// check path with all possible extensions in loader
 	for _, extension := range s.extensions {
 		canonicalPath := templatePath + extension
 		if found := s.loader.Exists(canonicalPath); found {
-			return s.loadFromFile(canonicalPath, cacheAfterParsing)
+			if cacheAfterParsing && !s.developmentMode {
+				return s.loadOnce(parent, canonicalPath)
+			}
+			return s.loadFromFile(nil, canonicalPath, cacheAfterParsing)
 		}
 	}
+	s.setMissing(templatePath)
 	return nil, fmt.Errorf("template %s could not be found", templatePath)
 }
 
-func (s *Set) loadFromFile(templatePath string, cacheAfterParsing bool) (template *Template, err error) {
+// loadCall is a load of a template in flight, shared by all goroutines requesting the template meanwhile.
+type loadCall struct {
+	done chan struct{} // closed when the load finished
+	t    *Template
+	err  error
+
+	// the graph of loads waiting for each other, to detect cycles of templates extending or importing each
+	// other; guarded by Set.loadsMutex
+	parent     *loadCall // load the template is needed for, nil if none
+	child      *loadCall // load of a template needed by this one, in flight on the same goroutine
+	waitingFor *loadCall // load of a template needed by this one, in flight on another goroutine
+}
+
+// loadOnce loads, parses and caches the template at the canonical path templatePath. Concurrent requests
+// for the same template wait for the first one instead of parsing the template again.
+func (s *Set) loadOnce(parent *loadCall, templatePath string) (*Template, error) {
+	s.loadsMutex.Lock()
+	if call, ok := s.loads[templatePath]; ok {
+		if parent != nil {
+			if s.waitsFor(call, parent) {
+				s.loadsMutex.Unlock()
+				return nil, fmt.Errorf("template %s extends or imports itself", templatePath)
+			}
+			parent.waitingFor = call
+		}
+		s.loadsMutex.Unlock()
+		<-call.done
+		if parent != nil {
+			s.loadsMutex.Lock()
+			parent.waitingFor = nil
+			s.loadsMutex.Unlock()
+		}
+		return call.t, call.err
+	}
+	call := &loadCall{done: make(chan struct{}), parent: parent}
+	if s.loads == nil {
+		s.loads = map[string]*loadCall{}
+	}
+	s.loads[templatePath] = call
+	if parent != nil {
+		parent.child = call
+	}
+	s.loadsMutex.Unlock()
+
+	defer func() {
+		s.loadsMutex.Lock()
+		delete(s.loads, templatePath)
+		if parent != nil {
+			parent.child = nil
+		}
+		s.loadsMutex.Unlock()
+		close(call.done)
+	}()
+	// what the requests waiting for this one get if loading the template panics
+	call.err = fmt.Errorf("template %s: loading panicked", templatePath)
+	call.t, call.err = s.loadFromFile(call, templatePath, true)
+	if call.err == nil {
+		// recorded first, so a cache dropping the template right away drops its dependencies, too
+		s.recordDependencies(call.t)
+		s.cache.Put(templatePath, call.t)
+	}
+	return call.t, call.err
+}
+
+// waitsFor reports whether call (directly or through the loads it waits for) waits for the load requester
+// or one of the loads requester is needed for, in which case requester must not wait for call. It must be
+// called with loadsMutex held.
+func (s *Set) waitsFor(call, requester *loadCall) bool {
+	for seen := map[*loadCall]bool{}; call != nil && !seen[call]; call = call.waitingFor {
+		seen[call] = true
+		for ; call.child != nil; call = call.child {
+			if call.isNeededBy(requester) {
+				return true
+			}
+		}
+		if call.isNeededBy(requester) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNeededBy reports whether c is requester or one of the loads requester is needed for.
+func (c *loadCall) isNeededBy(requester *loadCall) bool {
+	for ; requester != nil; requester = requester.parent {
+		if requester == c {
+			return true
+		}
+	}
+	return false
+}
+
+// isMissing reports whether the template at templatePath was recently found missing, see WithNegativeCache().
+func (s *Set) isMissing(templatePath string) bool {
+	if s.missTTL <= 0 || s.developmentMode {
+		return false
+	}
+	s.missesMutex.Lock()
+	defer s.missesMutex.Unlock()
+	expires, ok := s.misses[templatePath]
+	if ok && !time.Now().Before(expires) {
+		delete(s.misses, templatePath)
+		return false
+	}
+	return ok
+}
+
+// setMissing remembers the template at templatePath as missing, see WithNegativeCache().
+func (s *Set) setMissing(templatePath string) {
+	if s.missTTL <= 0 || s.developmentMode {
+		return
+	}
+	s.missesMutex.Lock()
+	defer s.missesMutex.Unlock()
+	if s.misses == nil {
+		s.misses = map[string]time.Time{}
+	}
+	s.misses[templatePath] = time.Now().Add(s.missTTL)
+}
+
+// forgetMissing forgets all templates found missing, see WithNegativeCache().
+func (s *Set) forgetMissing() {
+	s.missesMutex.Lock()
+	defer s.missesMutex.Unlock()
+	s.misses = nil
+}
+
+// loadFromFile loads and parses the template at the canonical path templatePath, as the load in flight call
+// (nil if it isn't shared).
+func (s *Set) loadFromFile(call *loadCall, templatePath string, cacheAfterParsing bool) (template *Template, err error) {
+	// the version is taken before reading the template, so a change while reading makes it outdated right away
+	var version string
+	if versioner, ok := s.loader.(Versioner); ok {
+		if version, err = versioner.Version(templatePath); err != nil {
+			return nil, err
+		}
+	}
 	f, err := s.loader.Open(templatePath)
 	if err != nil {
 		return nil, err
@@ -193,7 +439,9 @@ func (s *Set) loadFromFile(templatePath string, cacheAfterParsing bool) (templat
 	if err != nil {
 		return nil, err
 	}
-	return s.parse(templatePath, string(content), cacheAfterParsing)
+	template, err = s.parseLoaded(call, templatePath, string(content), cacheAfterParsing)
+	template.version = version
+	return template, err
 }
 
 // Parse parses `contents` as if it were located at `templatePath`, but won't put the result into the cache.
@@ -214,19 +462,69 @@ func (s *Set) Parse(templatePath, contents string) (template *Template, err erro
 // AddGlobal adds a global variable into the Set,
 // overriding any value previously set under the specified key.
 // It returns the Set it was called on to allow for method chaining.
+//
+// Globals are read without locking while templates execute: AddGlobal publishes a
+// copy of the globals including the new variable, so adding globals is comparatively
+// expensive and should mostly happen when setting up the Set.
 func (s *Set) AddGlobal(key string, i interface{}) *Set {
 	s.gmx.Lock()
 	defer s.gmx.Unlock()
-	s.globals[key] = reflect.ValueOf(i)
+	delete(s.constants, key)
+	s.addGlobal(key, i)
+	return s
+}
+
+// AddConstant adds a global variable into the Set like AddGlobal() does, and declares that its value won't
+// change: when the Set optimizes templates (see WithOptimization()), templates parsed from now on use the
+// value directly, evaluating expressions depending only on constants when parsing and dropping branches that
+// can never execute. A constant is only used where it isn't shadowed by a variable or block parameter of the
+// same name declared in the template; unlike other globals, it takes precedence over variables passed to
+// Execute() or declared by including templates, whether the Set optimizes templates or not. Adding a global
+// under the same key makes the variable non-constant again for templates parsed from now on.
+// It returns the Set it was called on to allow for method chaining.
+func (s *Set) AddConstant(key string, i interface{}) *Set {
+	s.gmx.Lock()
+	defer s.gmx.Unlock()
+	if s.constants == nil {
+		s.constants = map[string]bool{}
+	}
+	s.constants[key] = true
+	s.addGlobal(key, i)
 	return s
 }
 
+// addGlobal publishes a copy of the globals including key. It must be called with gmx held.
+func (s *Set) addGlobal(key string, i interface{}) {
+	old := s.loadGlobals()
+	globals := make(VarMap, len(old)+1)
+	for k, v := range old {
+		globals[k] = v
+	}
+	globals[key] = reflect.ValueOf(i)
+	s.globals.Store(globals)
+}
+
+// loadGlobals returns the current global variables. The returned map must not be modified.
+func (s *Set) loadGlobals() VarMap {
+	return s.globals.Load().(VarMap)
+}
+
+// loadConstants returns a copy of the globals added by AddConstant().
+func (s *Set) loadConstants() VarMap {
+	s.gmx.Lock()
+	defer s.gmx.Unlock()
+	globals := s.loadGlobals()
+	constants := make(VarMap, len(s.constants))
+	for key := range s.constants {
+		constants[key] = globals[key]
+	}
+	return constants
+}
+
 // LookupGlobal returns the global variable previously set under the specified key.
 // It returns the nil interface and false if no variable exists under that key.
 func (s *Set) LookupGlobal(key string) (val interface{}, found bool) {
-	s.gmx.RLock()
-	defer s.gmx.RUnlock()
-	val, found = s.globals[key]
+	val, found = s.loadGlobals()[key]
 	return
 }
 
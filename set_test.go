@@ -15,9 +15,15 @@
 package jet
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestSetSetExtensions(t *testing.T) {
@@ -74,3 +80,235 @@ func TestGetTemplateConcurrency(t *testing.T) {
 		})
 	}
 }
+
+// countingLoader counts the calls of a Loader's methods, and delays Open() to let concurrent requests pile up.
+type countingLoader struct {
+	*InMemLoader
+	delay  time.Duration
+	mu     sync.Mutex
+	exists map[string]int
+	opens  map[string]int
+}
+
+func newCountingLoader(delay time.Duration) *countingLoader {
+	return &countingLoader{InMemLoader: NewInMemLoader(), delay: delay, exists: map[string]int{}, opens: map[string]int{}}
+}
+
+func (l *countingLoader) Exists(templatePath string) bool {
+	l.mu.Lock()
+	l.exists[templatePath]++
+	l.mu.Unlock()
+	return l.InMemLoader.Exists(templatePath)
+}
+
+func (l *countingLoader) Open(templatePath string) (io.ReadCloser, error) {
+	l.mu.Lock()
+	l.opens[templatePath]++
+	l.mu.Unlock()
+	time.Sleep(l.delay)
+	return l.InMemLoader.Open(templatePath)
+}
+
+func TestGetTemplateDeduplicatesLoads(t *testing.T) {
+	loader := newCountingLoader(20 * time.Millisecond)
+	loader.Set("/layout.jet", `<{{ block body() }}{{ end }}>`)
+	loader.Set("/page.jet", `{{ extends "layout" }}{{ block body() }}page{{ end }}`)
+	set := NewSet(loader)
+
+	var wg sync.WaitGroup
+	templates := make([]*Template, 50)
+	for i := range templates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tt, err := set.GetTemplate("/page")
+			if err != nil {
+				t.Errorf("getting template: %v", err)
+			}
+			templates[i] = tt
+		}(i)
+	}
+	wg.Wait()
+
+	for _, tt := range templates {
+		if tt != templates[0] {
+			t.Fatalf("concurrent requests got different templates")
+		}
+	}
+	if want := map[string]int{"/layout.jet": 1, "/page.jet": 1}; !reflect.DeepEqual(loader.opens, want) {
+		t.Errorf("opened templates: expected %v, got %v", want, loader.opens)
+	}
+}
+
+// panickingLoader panics opening a template after a delay.
+type panickingLoader struct {
+	*InMemLoader
+	delay time.Duration
+}
+
+func (l panickingLoader) Open(templatePath string) (io.ReadCloser, error) {
+	time.Sleep(l.delay)
+	panic(fmt.Errorf("can't open %s", templatePath))
+}
+
+func TestGetTemplatePanic(t *testing.T) {
+	loader := panickingLoader{NewInMemLoader(), 50 * time.Millisecond}
+	loader.Set("/page.jet", `page`)
+	set := NewSet(loader)
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		set.GetTemplate("/page.jet")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// waits for the load panicking in the other goroutine
+	tt, err := set.GetTemplate("/page.jet")
+	if tt != nil || err == nil {
+		t.Errorf("expected an error waiting for a panicking load, got %v, %v", tt, err)
+	}
+	if p := <-panicked; p == nil {
+		t.Errorf("expected the panic to propagate to the loading goroutine")
+	}
+}
+
+func TestGetTemplateCycle(t *testing.T) {
+	loader := newCountingLoader(20 * time.Millisecond)
+	loader.Set("/a.jet", `{{ extends "b.jet" }}`)
+	loader.Set("/b.jet", `{{ import "c.jet" }}`)
+	loader.Set("/c.jet", `{{ extends "a.jet" }}`)
+	if _, err := NewSet(loader).GetTemplate("/a.jet"); err == nil || !strings.Contains(err.Error(), "extends or imports itself") {
+		t.Errorf("expected an error about the cycle, got %v", err)
+	}
+
+	set := NewSet(loader)
+	done := make(chan error)
+	for _, templatePath := range []string{"/a.jet", "/b.jet", "/c.jet", "/a.jet"} {
+		go func(templatePath string) {
+			_, err := set.GetTemplate(templatePath)
+			done <- err
+		}(templatePath)
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-done:
+			if err == nil || !strings.Contains(err.Error(), "extends or imports itself") {
+				t.Errorf("expected an error about the cycle, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("loading templates extending each other didn't finish")
+		}
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loader := newCountingLoader(0)
+	set := NewSet(loader, WithNegativeCache(time.Minute))
+
+	for i := 0; i < 3; i++ {
+		if _, err := set.GetTemplate("/missing"); err == nil {
+			t.Fatalf("expected an error getting a missing template")
+		}
+	}
+	if loader.exists["/missing.jet"] != 1 {
+		t.Errorf("expected the loader to be probed once, got %d times", loader.exists["/missing.jet"])
+	}
+
+	loader.Set("/missing.jet", "found")
+	if _, err := set.GetTemplate("/missing"); err == nil {
+		t.Errorf("expected the template to be remembered as missing")
+	}
+	if err := set.Invalidate("/missing.jet"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.GetTemplate("/missing"); err != nil {
+		t.Errorf("expected the template to be found after invalidating it, got %v", err)
+	}
+
+	devSet := NewSet(loader, WithNegativeCache(time.Minute), InDevelopmentMode())
+	devSet.GetTemplate("/other")
+	devSet.GetTemplate("/other")
+	if loader.exists["/other.jet"] != 2 {
+		t.Errorf("expected no negative caching in development mode, got %d probes", loader.exists["/other.jet"])
+	}
+}
+
+func TestAddGlobalConcurrency(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/globals.jet", "{{ greeting }}")
+	set := NewSet(l)
+	set.AddGlobal("greeting", "hi")
+	tt, _ := set.GetTemplate("/globals.jet")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			set.AddGlobal(fmt.Sprintf("g%d", i), i)
+		}(i)
+		go func() {
+			defer wg.Done()
+			var b bytes.Buffer
+			if err := tt.Execute(&b, nil, nil); err != nil || b.String() != "hi" {
+				t.Errorf("unexpected result %q, error: %v", b.String(), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		if v, ok := set.LookupGlobal(fmt.Sprintf("g%d", i)); !ok || v.(reflect.Value).Interface() != i {
+			t.Errorf("global g%d: expected %d, got %v", i, i, v)
+		}
+	}
+}
+
+// BenchmarkResolveGlobalParallel benchmarks resolving globals from many goroutines executing templates of the
+// same Set, which is the common case in web servers.
+func BenchmarkResolveGlobalParallel(b *testing.B) {
+	set := NewSet(NewInMemLoader())
+	for i := 0; i < 20; i++ {
+		set.AddGlobal(fmt.Sprintf("g%d", i), i)
+	}
+	tt, _ := set.Parse("/globals.jet", "{{ g0 }}{{ g5 }}{{ g10 }}{{ g15 }}{{ g19 }}")
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tt.Execute(ioutil.Discard, nil, nil)
+		}
+	})
+}
+
+// BenchmarkResolveGlobalParallelWithWriter is like BenchmarkResolveGlobalParallel, but with a goroutine adding
+// globals concurrently.
+func BenchmarkResolveGlobalParallelWithWriter(b *testing.B) {
+	set := NewSet(NewInMemLoader())
+	for i := 0; i < 20; i++ {
+		set.AddGlobal(fmt.Sprintf("g%d", i), i)
+	}
+	tt, _ := set.Parse("/globals.jet", "{{ g0 }}{{ g5 }}{{ g10 }}{{ g15 }}{{ g19 }}")
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				set.AddGlobal("counter", i)
+				time.Sleep(10 * time.Microsecond)
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tt.Execute(ioutil.Discard, nil, nil)
+		}
+	})
+}
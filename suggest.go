@@ -0,0 +1,168 @@
+package jet
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSuggestions is the maximum number of close matches mentioned in an error message.
+const maxSuggestions = 3
+
+// didYouMean returns a hint listing the candidates closest to name, e.g. ` (did you mean "user" or "users"?)`,
+// or an empty string if none of the candidates is close enough.
+func didYouMean(name string, candidates []string) string {
+	matches := closestMatches(name, candidates)
+	switch len(matches) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf(" (did you mean %q?)", matches[0])
+	}
+	quoted := make([]string, len(matches))
+	for i, m := range matches {
+		quoted[i] = fmt.Sprintf("%q", m)
+	}
+	return fmt.Sprintf(" (did you mean %s or %s?)", strings.Join(quoted[:len(quoted)-1], ", "), quoted[len(quoted)-1])
+}
+
+// closestMatches returns up to maxSuggestions candidates within an edit distance of a third of name's length,
+// ignoring case, best match first.
+func closestMatches(name string, candidates []string) []string {
+	type match struct {
+		candidate string
+		distance  int
+	}
+
+	maxDistance := utf8.RuneCountInString(name) / 3
+	lowerName := strings.ToLower(name)
+	seen := make(map[string]bool, len(candidates))
+	var matches []match
+	for _, c := range candidates {
+		if c == name || seen[c] {
+			continue
+		}
+		seen[c] = true
+		if d := editDistance(lowerName, strings.ToLower(c)); d <= maxDistance {
+			matches = append(matches, match{c, d})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].candidate < matches[j].candidate
+	})
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+
+	result := make([]string, len(matches))
+	for i, m := range matches {
+		result[i] = m.candidate
+	}
+	return result
+}
+
+// editDistance returns the optimal string alignment distance between a and b, i.e. the number of rune
+// insertions, deletions, substitutions and transpositions of adjacent runes needed to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// d[i][j] holds the distance between ra[:i] and rb[:j]
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// identifierNames returns the names of all variables visible from the current scope, the globals of
+// the Set, and the default variables.
+func (state *Runtime) identifierNames() []string {
+	var names []string
+	for sc := state.scope; sc != nil; sc = sc.parent {
+		names = append(names, sc.variableNames()...)
+	}
+	for name := range state.set.loadGlobals() {
+		names = append(names, name)
+	}
+	for name := range defaultVariables {
+		names = append(names, name)
+	}
+	return names
+}
+
+// blockNames returns the names of all blocks visible from the current scope.
+func (st *scope) blockNames() []string {
+	var names []string
+	for ; st != nil; st = st.parent {
+		for name := range st.blocks {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// memberNames returns the names that can follow a '.' on v: exported methods, exported struct fields,
+// and the keys of maps with string keys.
+func memberNames(v reflect.Value) []string {
+	var names []string
+	v, _ = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+
+	typ := v.Type()
+	methods := typ
+	if typ.Kind() != reflect.Interface && typ.Kind() != reflect.Ptr {
+		methods = reflect.PtrTo(typ)
+	}
+	for i := 0; i < methods.NumMethod(); i++ {
+		names = append(names, methods.Method(i).Name)
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		for name, m := range membersOf(typ) {
+			if m.field != nil && m.exported {
+				names = append(names, name)
+			}
+		}
+	case reflect.Map:
+		if typ.Key().Kind() == reflect.String {
+			for _, key := range v.MapKeys() {
+				names = append(names, key.String())
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,84 @@
+package jet
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"user", "user", 0},
+		{"usr", "user", 1},
+		{"user", "users", 1},
+		{"nmae", "name", 1},
+		{"kitten", "sitting", 3},
+		{"héllo", "hello", 1},
+	}
+	for _, test := range tests {
+		if d := editDistance(test.a, test.b); d != test.distance {
+			t.Errorf("editDistance(%q, %q): expected %d, got %d", test.a, test.b, test.distance, d)
+		}
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	candidates := []string{"user", "users", "User", "title", "id"}
+	tests := []struct {
+		name, hint string
+	}{
+		{"usr", ` (did you mean "User" or "user"?)`},
+		{"usre", ` (did you mean "User" or "user"?)`},
+		{"titel", ` (did you mean "title"?)`},
+		{"ID", ` (did you mean "id"?)`},
+		{"xy", ``},
+		{"user", ` (did you mean "User" or "users"?)`},
+	}
+	for _, test := range tests {
+		if hint := didYouMean(test.name, candidates); hint != test.hint {
+			t.Errorf("didYouMean(%q): expected %q, got %q", test.name, test.hint, hint)
+		}
+	}
+}
+
+type suggestUser struct {
+	Name  string
+	Email string
+}
+
+func (suggestUser) Greeting() string { return "hi" }
+
+func TestSuggestionsInErrors(t *testing.T) {
+	loader := NewInMemLoader()
+	set := NewSet(loader)
+	set.AddGlobal("siteName", "jet")
+
+	tests := []struct {
+		template, hint string
+	}{
+		{`{{ sitename }}`, `(did you mean "siteName"?)`},
+		{`{{ usr := 1 }}{{ user }}`, `(did you mean "usr"?)`},
+		{`{{ lne(.Name) }}`, `(did you mean "len"?)`},
+		{`{{ .Emial }}`, `(did you mean "Email"?)`},
+		{`{{ .Greting() }}`, `(did you mean "Greeting"?)`},
+		{`{{ u := . }}{{ u.Nmae }}`, `(did you mean "Name"?)`},
+		{`{{ block menu() }}{{ end }}{{ yield mneu() }}`, `(did you mean "menu"?)`},
+	}
+	for i, test := range tests {
+		name := "/suggest" + string(rune('a'+i))
+		loader.Set(name, test.template)
+		tt, err := set.GetTemplate(name)
+		if err != nil {
+			t.Errorf("%s: parsing template: %v", test.template, err)
+			continue
+		}
+		err = tt.Execute(ioutil.Discard, nil, &suggestUser{})
+		if err == nil || !strings.Contains(err.Error(), test.hint) {
+			t.Errorf("%s: expected error containing %q, got %v", test.template, test.hint, err)
+		}
+	}
+}
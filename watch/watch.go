@@ -0,0 +1,192 @@
+// Package watch reloads the templates of a jet.Set when they change on disk (or in any other Loader that
+// can list its templates and tell their versions), without putting the Set into development mode.
+//
+// A Watcher polls the Loader at a fixed interval instead of relying on platform-specific notification APIs,
+// so it works the same everywhere, including on network file systems and in containers:
+//
+//	loader := jet.NewOSFileSystemLoader("./views")
+//	set := jet.NewSet(loader)
+//	w, err := watch.New(set, loader, watch.WithInterval(time.Second), watch.WithReparse())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	go w.Run(ctx)
+package watch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// DefaultInterval is the polling interval of a Watcher created without WithInterval().
+const DefaultInterval = 2 * time.Second
+
+// Loader is a jet.Loader that can list its templates and tell their versions, like jet.OSFileSystemLoader.
+type Loader interface {
+	jet.Lister
+	jet.Versioner
+}
+
+// Watcher polls a Loader for added, changed and removed templates and invalidates them and the templates
+// depending on them in a Set (see jet.Set.Invalidate()), so they are parsed again when they are used next.
+type Watcher struct {
+	set      *jet.Set
+	loader   Loader
+	interval time.Duration
+	reparse  bool
+	onError  func(templatePath string, err error)
+
+	mu       sync.Mutex
+	versions map[string]string // version of every listed file, by path
+}
+
+// Option configures a Watcher.
+type Option func(*Watcher)
+
+// WithInterval sets the interval between two polls of the Loader. The default is DefaultInterval.
+func WithInterval(interval time.Duration) Option {
+	return func(w *Watcher) {
+		w.interval = interval
+	}
+}
+
+// WithReparse makes the Watcher parse changed templates and the templates depending on them right away,
+// instead of when they are used next. Templates failing to parse are reported to the OnError() callback.
+func WithReparse() Option {
+	return func(w *Watcher) {
+		w.reparse = true
+	}
+}
+
+// OnError sets a callback receiving the errors found while polling: templates failing to load or parse
+// again (with WithReparse()) and failures to list the Loader, which are reported with templatePath "/".
+// Without a callback, errors are ignored.
+func OnError(fn func(templatePath string, err error)) Option {
+	return func(w *Watcher) {
+		w.onError = fn
+	}
+}
+
+// New returns a Watcher for the templates of set served by loader, which is usually the Loader set uses.
+// The Set's Cache must implement jet.Evicter, like the default cache does; otherwise New returns an error,
+// since the Watcher couldn't invalidate changed templates (see jet.Set.CanInvalidate()). New takes a
+// snapshot of the versions of all templates; changes are detected relative to it.
+func New(set *jet.Set, loader Loader, opts ...Option) (*Watcher, error) {
+	if !set.CanInvalidate() {
+		return nil, fmt.Errorf("watch: the Set's Cache must implement jet.Evicter to invalidate changed templates")
+	}
+	w := &Watcher{
+		set:      set,
+		loader:   loader,
+		interval: DefaultInterval,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	versions, err := w.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	w.versions = versions
+	return w, nil
+}
+
+// Run polls the Loader every interval until ctx is done, and then returns ctx.Err().
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := w.Poll(); err != nil {
+				w.report("/", err)
+			}
+		}
+	}
+}
+
+// Poll checks the Loader for changes once and invalidates the changed templates and their dependents. It
+// returns the paths of the added, changed and removed files, in lexical order. Poll is called by Run() and
+// may also be called directly, e.g. from a handler triggered by a deployment.
+func (w *Watcher) Poll() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	versions, err := w.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for templatePath, version := range versions {
+		if previous, ok := w.versions[templatePath]; !ok || previous != version {
+			changed = append(changed, templatePath)
+		}
+	}
+	for templatePath := range w.versions {
+		if _, ok := versions[templatePath]; !ok {
+			changed = append(changed, templatePath)
+		}
+	}
+	sort.Strings(changed)
+
+	// dependents must be collected before invalidating, which drops them from the Set's dependency graph
+	reparse := map[string]bool{}
+	for _, templatePath := range changed {
+		if !w.reparse {
+			break
+		}
+		if _, ok := versions[templatePath]; ok && w.set.IsTemplateFile(templatePath) {
+			reparse[templatePath] = true
+		}
+		for _, dependent := range w.set.Dependents(templatePath) {
+			reparse[dependent] = true
+		}
+	}
+	for _, templatePath := range changed {
+		if err := w.set.Invalidate(templatePath); err != nil {
+			return nil, err
+		}
+	}
+	// only now, so changes failing to be invalidated are detected again by the next poll
+	w.versions = versions
+
+	paths := make([]string, 0, len(reparse))
+	for templatePath := range reparse {
+		paths = append(paths, templatePath)
+	}
+	sort.Strings(paths)
+	for _, templatePath := range paths {
+		if _, err := w.set.GetTemplate(templatePath); err != nil {
+			w.report(templatePath, err)
+		}
+	}
+	return changed, nil
+}
+
+// snapshot returns the current version of every file of the Loader. Files removed while listing are missing.
+func (w *Watcher) snapshot() (map[string]string, error) {
+	files, err := w.loader.List("/")
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]string, len(files))
+	for _, templatePath := range files {
+		if version, err := w.loader.Version(templatePath); err == nil {
+			versions[templatePath] = version
+		}
+	}
+	return versions, nil
+}
+
+func (w *Watcher) report(templatePath string, err error) {
+	if w.onError != nil {
+		w.onError(templatePath, err)
+	}
+}
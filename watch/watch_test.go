@@ -0,0 +1,210 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/loaders/theme"
+)
+
+func render(t *testing.T, set *jet.Set, templatePath string) string {
+	t.Helper()
+	tt, err := set.GetTemplate(templatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestPoll(t *testing.T) {
+	loader := jet.NewInMemLoader()
+	loader.Set("/layout.jet", `<{{ block body() }}{{ end }}>`)
+	loader.Set("/index.jet", `{{ extends "layout.jet" }}{{ block body() }}index{{ end }}`)
+	loader.Set("/other.jet", `other`)
+	set := jet.NewSet(loader)
+	w, err := New(set, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := render(t, set, "/index.jet"); got != "<index>" {
+		t.Errorf("expected %q, got %q", "<index>", got)
+	}
+	other, _ := set.GetTemplate("/other.jet")
+
+	changed, err := w.Poll()
+	if err != nil || len(changed) != 0 {
+		t.Errorf("expected no changes, got %v, %v", changed, err)
+	}
+
+	loader.Set("/layout.jet", `[{{ block body() }}{{ end }}]`)
+	loader.Set("/new.jet", `new`)
+	changed, err = w.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/layout.jet", "/new.jet"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed: expected %v, got %v", want, changed)
+	}
+	if got := render(t, set, "/index.jet"); got != "[index]" {
+		t.Errorf("expected the dependent template to be reloaded as %q, got %q", "[index]", got)
+	}
+	if tt, _ := set.GetTemplate("/other.jet"); tt != other {
+		t.Errorf("an unchanged template was invalidated")
+	}
+
+	loader.Delete("/new.jet")
+	changed, err = w.Poll()
+	if want := []string{"/new.jet"}; err != nil || !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed: expected %v, got %v, %v", want, changed, err)
+	}
+}
+
+func TestPollTheme(t *testing.T) {
+	base := jet.NewInMemLoader()
+	base.Set("/base.jet", `<{{ block header() }}default{{ end }}|{{ block body() }}{{ end }}>`)
+	base.Set("/page.jet", `{{ extends "base.jet" }}{{ block body() }}page{{ end }}`)
+	brand := jet.NewInMemLoader()
+	brand.Set("/base.jet", `{{ extends parent }}{{ block header() }}brand{{ end }}`)
+	loader := theme.NewLoader(brand, base)
+	set := jet.NewSet(loader)
+	w, err := New(set, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := render(t, set, "/page.jet"); got != "<brand|page>" {
+		t.Errorf("expected %q, got %q", "<brand|page>", got)
+	}
+
+	// the overridden template of the default layer changes
+	base.Set("/base.jet", `[{{ block header() }}default{{ end }}|{{ block body() }}{{ end }}]`)
+	changed, err := w.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/base.jet#1"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed: expected %v, got %v", want, changed)
+	}
+	if got := render(t, set, "/page.jet"); got != "[brand|page]" {
+		t.Errorf("expected the page to be reloaded as %q, got %q", "[brand|page]", got)
+	}
+
+	// the theme stops overriding the template
+	brand.Delete("/base.jet")
+	if _, err := w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(t, set, "/page.jet"); got != "[default|page]" {
+		t.Errorf("expected the page to be reloaded as %q, got %q", "[default|page]", got)
+	}
+}
+
+func TestReparse(t *testing.T) {
+	loader := jet.NewInMemLoader()
+	loader.Set("/layout.jet", `<{{ block body() }}{{ end }}>`)
+	loader.Set("/index.jet", `{{ extends "layout.jet" }}{{ block body() }}index{{ end }}`)
+	loader.Set("/style.css", `body {}`)
+	set := jet.NewSet(loader)
+
+	var mu sync.Mutex
+	failed := map[string]error{}
+	w, err := New(set, loader, WithReparse(), OnError(func(templatePath string, err error) {
+		mu.Lock()
+		failed[templatePath] = err
+		mu.Unlock()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.GetTemplate("/index.jet"); err != nil {
+		t.Fatal(err)
+	}
+
+	loader.Set("/layout.jet", `<{{ block body() }}{{ end }>`)
+	loader.Set("/style.css", `body { color: red }`)
+	if _, err := w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 || failed["/layout.jet"] == nil || failed["/index.jet"] == nil {
+		t.Errorf("expected the broken template and its dependent to be reported, got %v", failed)
+	}
+
+	loader.Set("/layout.jet", `<{{ block body() }}{{ end }}>`)
+	failed = map[string]error{}
+	if _, err := w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("expected no errors after fixing the template, got %v", failed)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jet-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "index.jet")
+	if err := ioutil.WriteFile(file, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := jet.NewOSFileSystemLoader(dir)
+	set := jet.NewSet(loader)
+	w, err := New(set, loader, WithInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := render(t, set, "/index.jet"); got != "v1" {
+		t.Fatalf("expected %q, got %q", "v1", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	// the size changes as well, so the change is noticed even with a coarse modification time
+	if err := ioutil.WriteFile(file, []byte("v22"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for render(t, set, "/index.jet") != "v22" {
+		if time.Now().After(deadline) {
+			t.Fatal("the changed template wasn't reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected Run to return %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestNewNeedsEvicter(t *testing.T) {
+	loader := jet.NewInMemLoader()
+	set := jet.NewSet(loader, jet.WithCache(struct{ jet.Cache }{jet.NewVersionedCache(loader)}))
+	if _, err := New(set, loader); err == nil {
+		t.Errorf("expected an error watching a Set with a Cache that can't evict")
+	}
+}
+
+func TestNewListError(t *testing.T) {
+	loader := jet.NewOSFileSystemLoader(filepath.Join(os.TempDir(), "jet-watch-missing-dir"))
+	if _, err := New(jet.NewSet(loader), loader); err == nil {
+		t.Errorf("expected an error watching a missing directory")
+	}
+}